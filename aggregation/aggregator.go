@@ -0,0 +1,305 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+type seriesKind int
+
+const (
+	kindCounter seriesKind = iota
+	kindGauge
+	kindSummary
+)
+
+func (k seriesKind) String() string {
+	switch k {
+	case kindCounter:
+		return "counter"
+	case kindGauge:
+		return "gauge"
+	default:
+		return "summary"
+	}
+}
+
+type series struct {
+	name string
+	dims dimensions.NormalizedDimensionList
+	kind seriesKind
+
+	// value holds the counter delta or the gauge value.
+	value float64
+
+	min, max, sum float64
+	// count is the sum of the weights of the summary observations.
+	count float64
+}
+
+// AggregatorOption represents the function interface used to configure the Aggregator.
+type AggregatorOption func(a *Aggregator)
+
+// WithAggregatorPrefix sets a prefix that is prepended to all metric keys.
+func WithAggregatorPrefix(prefix string) AggregatorOption {
+	return func(a *Aggregator) {
+		a.prefix = prefix
+	}
+}
+
+// WithAggregatorDefaultDimensions sets dimensions that are added to all metrics. Dimensions of a series
+// overwrite default dimensions with the same key.
+func WithAggregatorDefaultDimensions(dims dimensions.NormalizedDimensionList) AggregatorOption {
+	return func(a *Aggregator) {
+		a.defaultDimensions = dims
+	}
+}
+
+// WithAggregatorDimensionsFunc sets a function that returns dimensions that are added to all metrics on every Collect,
+// e.g. the dimensions of an EnrichmentProvider. They overwrite default dimensions and dimensions of a series with the
+// same key.
+func WithAggregatorDimensionsFunc(fn func() dimensions.NormalizedDimensionList) AggregatorOption {
+	return func(a *Aggregator) {
+		a.dimensionsFunc = fn
+	}
+}
+
+// Aggregator aggregates counter increments, gauge values and summary observations per series until they are collected.
+// A series is identified by its name and dimensions, independent of the order of the dimensions.
+// A name can only be used with one kind of series per dimension list; recording a different kind for an existing
+// series is ignored and reported by the next Collect. It is safe for concurrent use.
+type Aggregator struct {
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	dimensionsFunc    func() dimensions.NormalizedDimensionList
+
+	mu       sync.Mutex
+	series   map[string]*series
+	mismatch []string
+	stats    AggregatorStats
+}
+
+// AggregatorStats holds the number of values recorded by an Aggregator since it was created.
+type AggregatorStats struct {
+	// Series is the number of series that are currently held.
+	Series int
+	// Recorded is the number of counter increments, gauge values and summary observations.
+	Recorded uint64
+	// KindMismatches is the number of values that were ignored, because their series has a different kind.
+	KindMismatches uint64
+	// SeriesDropped is the number of series that were dropped by Collect, because they could not be converted.
+	SeriesDropped uint64
+}
+
+// NewAggregator creates a new, empty Aggregator.
+func NewAggregator(opts ...AggregatorOption) *Aggregator {
+	a := &Aggregator{
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		series:            map[string]*series{},
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// get returns the series for name and dims, creating it if it does not exist. Returns nil if the series exists
+// with a different kind. Must be called with a.mu held.
+func (a *Aggregator) get(name string, dims dimensions.NormalizedDimensionList, kind seriesKind) *series {
+	key := SeriesKey(name, dims)
+	s, ok := a.series[key]
+	if !ok {
+		s = &series{name: name, dims: dims, kind: kind}
+		a.series[key] = s
+		a.stats.Recorded++
+		return s
+	}
+	if s.kind != kind {
+		a.stats.KindMismatches++
+		a.mismatch = append(a.mismatch, fmt.Sprintf("'%s' recorded as %s, but is a %s", key, kind, s.kind))
+		return nil
+	}
+	a.stats.Recorded++
+	return s
+}
+
+// AddCount adds delta to the counter series. The sum of all deltas since the last Collect is exported as
+// "count,delta=<sum>".
+func (a *Aggregator) AddCount(name string, dims dimensions.NormalizedDimensionList, delta float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if s := a.get(name, dims, kindCounter); s != nil {
+		s.value += delta
+	}
+}
+
+// SetGauge sets the value of the gauge series. Gauges keep their last value and are exported by every Collect,
+// until they are removed with RemoveGauge.
+func (a *Aggregator) SetGauge(name string, dims dimensions.NormalizedDimensionList, value float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if s := a.get(name, dims, kindGauge); s != nil {
+		s.value = value
+	}
+}
+
+// AdjustGauge adds delta to the current value of the gauge series. A gauge that was not set before starts at 0.
+func (a *Aggregator) AdjustGauge(name string, dims dimensions.NormalizedDimensionList, delta float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if s := a.get(name, dims, kindGauge); s != nil {
+		s.value += delta
+	}
+}
+
+// RemoveGauge removes the gauge series, so that it is no longer exported.
+func (a *Aggregator) RemoveGauge(name string, dims dimensions.NormalizedDimensionList) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := SeriesKey(name, dims)
+	if s, ok := a.series[key]; ok && s.kind == kindGauge {
+		delete(a.series, key)
+	}
+}
+
+// RecordSummary adds an observation to the summary series. The minimum, maximum, sum and count of all observations
+// since the last Collect are exported as "gauge,min=<min>,max=<max>,sum=<sum>,count=<count>".
+func (a *Aggregator) RecordSummary(name string, dims dimensions.NormalizedDimensionList, value float64) {
+	a.RecordWeightedSummary(name, dims, value, 1)
+}
+
+// RecordWeightedSummary adds an observation that stands for weight observations of value, e.g. the inverse of the
+// sample rate of a sampled observation, to the summary series. The weight is added to the count and value*weight to
+// the sum; the exported count is rounded. Observations with a non-positive weight are ignored.
+func (a *Aggregator) RecordWeightedSummary(name string, dims dimensions.NormalizedDimensionList, value, weight float64) {
+	if weight <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := a.get(name, dims, kindSummary)
+	if s == nil {
+		return
+	}
+
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+	s.sum += value * weight
+	s.count += weight
+}
+
+// Stats returns the statistics of the Aggregator.
+func (a *Aggregator) Stats() AggregatorStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := a.stats
+	stats.Series = len(a.series)
+	return stats
+}
+
+// Len returns the number of series that are currently held.
+func (a *Aggregator) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.series)
+}
+
+// Collect returns the aggregated metrics and resets the counters and summaries. Gauges are retained.
+// Series that cannot be converted, e.g. because of non-finite values, are dropped and reported in the returned error
+// together with all other metrics.
+func (a *Aggregator) Collect() ([]*metric.Metric, error) {
+	a.mu.Lock()
+	collected := make([]*series, 0, len(a.series))
+	for key, s := range a.series {
+		if s.kind == kindGauge {
+			copied := *s
+			collected = append(collected, &copied)
+			continue
+		}
+		collected = append(collected, s)
+		delete(a.series, key)
+	}
+	errs := a.mismatch
+	a.mismatch = nil
+	a.mu.Unlock()
+	mismatches := len(errs)
+
+	overwrite := dimensions.NewNormalizedDimensionList()
+	if a.dimensionsFunc != nil {
+		overwrite = a.dimensionsFunc()
+	}
+
+	result := make([]*metric.Metric, 0, len(collected))
+	for _, s := range collected {
+		var value metric.MetricOption
+		switch s.kind {
+		case kindCounter:
+			value = metric.WithFloatCounterValueDelta(s.value)
+		case kindGauge:
+			value = metric.WithFloatGaugeValue(s.value)
+		case kindSummary:
+			// a series holds at least one observation, even if its weights round down to zero.
+			count := int64(math.Round(s.count))
+			if count < 1 {
+				count = 1
+			}
+			value = metric.WithFloatSummaryValue(s.min, s.max, s.sum, count)
+		}
+
+		m, err := metric.NewMetric(
+			s.name,
+			metric.WithPrefix(a.prefix),
+			metric.WithDimensions(dimensions.MergeLists(a.defaultDimensions, s.dims, overwrite)),
+			value,
+		)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("'%s': %v", s.name, err))
+			continue
+		}
+		result = append(result, m)
+	}
+
+	if dropped := len(errs) - mismatches; dropped > 0 {
+		a.mu.Lock()
+		a.stats.SeriesDropped += uint64(dropped)
+		a.mu.Unlock()
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("could not collect %d series: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return result, nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func collectLines(t *testing.T, a *Aggregator) []string {
+	t.Helper()
+
+	metrics, err := a.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	return linetest.Serialize(t, metrics)
+}
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator(
+		WithAggregatorPrefix("app"),
+		WithAggregatorDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("env", "test"))),
+	)
+
+	get := dimensions.NewNormalizedDimensionList(dimensions.NewDimension("method", "GET"), dimensions.NewDimension("status", "2xx"))
+	// same series in a different order
+	get2 := dimensions.NewNormalizedDimensionList(dimensions.NewDimension("status", "2xx"), dimensions.NewDimension("method", "GET"))
+	post := dimensions.NewNormalizedDimensionList(dimensions.NewDimension("method", "POST"))
+
+	a.AddCount("requests", get, 1)
+	a.AddCount("requests", get2, 2)
+	a.AddCount("requests", post, 0.5)
+	a.RecordSummary("latency", get, 3)
+	a.RecordSummary("latency", get, 1)
+	a.RecordSummary("latency", get, 2)
+	a.SetGauge("connections", dimensions.NewNormalizedDimensionList(), 7)
+	a.AdjustGauge("connections", dimensions.NewNormalizedDimensionList(), -2)
+
+	want := linetest.CanonicalLines([]string{
+		"app.connections,env=test gauge,5",
+		"app.latency,env=test,method=GET,status=2xx gauge,min=1,max=3,sum=6,count=3",
+		"app.requests,env=test,method=GET,status=2xx count,delta=3",
+		"app.requests,env=test,method=POST count,delta=0.5",
+	})
+	if got := collectLines(t, a); !reflect.DeepEqual(got, want) {
+		t.Errorf("first Collect() = %v, want %v", got, want)
+	}
+
+	// counters and summaries are reset, gauges are retained
+	a.AddCount("requests", post, 1)
+	want = linetest.CanonicalLines([]string{
+		"app.connections,env=test gauge,5",
+		"app.requests,env=test,method=POST count,delta=1",
+	})
+	if got := collectLines(t, a); !reflect.DeepEqual(got, want) {
+		t.Errorf("second Collect() = %v, want %v", got, want)
+	}
+
+	a.RemoveGauge("connections", dimensions.NewNormalizedDimensionList())
+	if got := collectLines(t, a); len(got) != 0 {
+		t.Errorf("Collect() after RemoveGauge = %v, want no lines", got)
+	}
+	if a.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", a.Len())
+	}
+}
+
+func TestAggregator_RecordWeightedSummary(t *testing.T) {
+	a := NewAggregator()
+	dims := dimensions.NewNormalizedDimensionList()
+
+	a.RecordWeightedSummary("latency", dims, 10, 10)
+	a.RecordWeightedSummary("latency", dims, 30, 2.5)
+	a.RecordSummary("latency", dims, 20)
+	a.RecordWeightedSummary("latency", dims, 100, 0)
+	a.RecordWeightedSummary("rare", dims, 5, 0.25)
+
+	want := linetest.CanonicalLines([]string{
+		"latency gauge,min=10,max=30,sum=195,count=14",
+		"rare gauge,min=5,max=5,sum=1.25,count=1",
+	})
+	if got := collectLines(t, a); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %v, want %v", got, want)
+	}
+}
+
+func TestAggregator_DimensionsFunc(t *testing.T) {
+	host := "a"
+	a := NewAggregator(
+		WithAggregatorDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("host", "default"))),
+		WithAggregatorDimensionsFunc(func() dimensions.NormalizedDimensionList {
+			return dimensions.NewNormalizedDimensionList(dimensions.NewDimension("host", host))
+		}),
+	)
+	dims := dimensions.NewNormalizedDimensionList(dimensions.NewDimension("host", "series"))
+
+	a.SetGauge("g", dims, 1)
+	if got := collectLines(t, a); !reflect.DeepEqual(got, []string{"g,host=a gauge,1"}) {
+		t.Errorf("Collect() = %v", got)
+	}
+
+	// the function is called on every Collect
+	host = "b"
+	if got := collectLines(t, a); !reflect.DeepEqual(got, []string{"g,host=b gauge,1"}) {
+		t.Errorf("second Collect() = %v", got)
+	}
+}
+
+func TestAggregator_KindMismatch(t *testing.T) {
+	a := NewAggregator()
+	dims := dimensions.NewNormalizedDimensionList()
+
+	a.AddCount("m", dims, 1)
+	a.SetGauge("m", dims, 5)
+
+	metrics, err := a.Collect()
+	if err == nil || !strings.Contains(err.Error(), "recorded as gauge, but is a counter") {
+		t.Errorf("Collect() error = %v, want kind mismatch", err)
+	}
+	if got := linetest.Serialize(t, metrics); !reflect.DeepEqual(got, []string{"m count,delta=1"}) {
+		t.Errorf("Collect() = %v", got)
+	}
+
+	// the error is only reported once
+	if _, err := a.Collect(); err != nil {
+		t.Errorf("second Collect() error = %v", err)
+	}
+	if got, want := a.Stats(), (AggregatorStats{Recorded: 1, KindMismatches: 1}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAggregator_InvalidValues(t *testing.T) {
+	a := NewAggregator()
+	dims := dimensions.NewNormalizedDimensionList()
+
+	a.SetGauge("nan", dims, math.NaN())
+	a.AddCount("valid", dims, 1)
+
+	metrics, err := a.Collect()
+	if err == nil {
+		t.Error("Collect() expected error for NaN gauge")
+	}
+	if got := linetest.Serialize(t, metrics); !reflect.DeepEqual(got, []string{"valid count,delta=1"}) {
+		t.Errorf("Collect() = %v", got)
+	}
+	// the NaN gauge is retained, but dropped by every Collect
+	if got, want := a.Stats(), (AggregatorStats{Series: 1, Recorded: 2, SeriesDropped: 1}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAggregator_Concurrent(t *testing.T) {
+	a := NewAggregator()
+	dims := dimensions.NewNormalizedDimensionList(dimensions.NewDimension("a", "b"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				a.AddCount("c", dims, 1)
+				a.RecordSummary("s", dims, float64(j))
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := []string{
+		"c,a=b count,delta=1000",
+		"s,a=b gauge,min=0,max=99,sum=49500,count=1000",
+	}
+	if got := collectLines(t, a); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+type cumulativeEntry struct {
+	floatValue float64
+	intValue   int64
+	seen       bool
+}
+
+// CumulativeTracker converts cumulative values, like monotonic counters, to deltas by remembering the last value of
+// each series. It is safe for concurrent use.
+type CumulativeTracker struct {
+	mu      sync.Mutex
+	entries map[string]*cumulativeEntry
+}
+
+// NewCumulativeTracker creates a new, empty CumulativeTracker.
+func NewCumulativeTracker() *CumulativeTracker {
+	return &CumulativeTracker{entries: map[string]*cumulativeEntry{}}
+}
+
+func (t *CumulativeTracker) entry(key string) (*cumulativeEntry, bool) {
+	e, ok := t.entries[key]
+	if !ok {
+		e = &cumulativeEntry{}
+		t.entries[key] = e
+	}
+	e.seen = true
+	return e, ok
+}
+
+// FloatDelta stores the passed cumulative value for the series identified by key and returns the difference to
+// the previously stored value. The first value of a series does not produce a delta, in which case ok is false.
+// If the value decreased, the counter is assumed to have been reset, and the value itself is returned as delta.
+func (t *CumulativeTracker) FloatDelta(key string, value float64) (delta float64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, existed := t.entry(key)
+	previous := e.floatValue
+	e.floatValue = value
+
+	if !existed {
+		return 0, false
+	}
+	if value < previous {
+		return value, true
+	}
+	return value - previous, true
+}
+
+// IntDelta works like FloatDelta for integer values.
+func (t *CumulativeTracker) IntDelta(key string, value int64) (delta int64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, existed := t.entry(key)
+	previous := e.intValue
+	e.intValue = value
+
+	if !existed {
+		return 0, false
+	}
+	if value < previous {
+		return value, true
+	}
+	return value - previous, true
+}
+
+// Sweep removes all series that have not been passed to FloatDelta or IntDelta since the last call to Sweep.
+// Call it periodically to prevent series that disappeared from using memory forever.
+func (t *CumulativeTracker) Sweep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, e := range t.entries {
+		if !e.seen {
+			delete(t.entries, key)
+			continue
+		}
+		e.seen = false
+	}
+}
+
+// Len returns the number of tracked series.
+func (t *CumulativeTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.entries)
+}
+
+// SeriesKey creates a key that identifies a series by its name and dimensions, independent of the order of the dimensions.
+func SeriesKey(name string, dims dimensions.NormalizedDimensionList) string {
+	var sb strings.Builder
+	sb.WriteString(name)
+
+	dims.Format(func(ds []dimensions.Dimension) string {
+		pairs := make([]string, 0, len(ds))
+		for _, d := range ds {
+			pairs = append(pairs, d.Key+"="+d.Value)
+		}
+		sort.Strings(pairs)
+
+		for _, pair := range pairs {
+			// normalized dimension values have commas escaped, so the comma can be used as separator.
+			sb.WriteString(",")
+			sb.WriteString(pair)
+		}
+		return ""
+	})
+
+	return sb.String()
+}
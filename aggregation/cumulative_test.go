@@ -0,0 +1,110 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestCumulativeTracker_FloatDelta(t *testing.T) {
+	tracker := NewCumulativeTracker()
+
+	steps := []struct {
+		key       string
+		value     float64
+		wantDelta float64
+		wantOk    bool
+	}{
+		{key: "a", value: 10, wantOk: false},
+		{key: "a", value: 12.5, wantDelta: 2.5, wantOk: true},
+		{key: "b", value: 3, wantOk: false},
+		{key: "a", value: 12.5, wantDelta: 0, wantOk: true},
+		// reset
+		{key: "a", value: 4, wantDelta: 4, wantOk: true},
+		{key: "b", value: 5, wantDelta: 2, wantOk: true},
+	}
+	for i, step := range steps {
+		delta, ok := tracker.FloatDelta(step.key, step.value)
+		if delta != step.wantDelta || ok != step.wantOk {
+			t.Errorf("step %d: FloatDelta(%q, %v) = (%v, %v), want (%v, %v)", i, step.key, step.value, delta, ok, step.wantDelta, step.wantOk)
+		}
+	}
+}
+
+func TestCumulativeTracker_IntDelta(t *testing.T) {
+	tracker := NewCumulativeTracker()
+
+	steps := []struct {
+		value     int64
+		wantDelta int64
+		wantOk    bool
+	}{
+		{value: 1 << 60, wantOk: false},
+		{value: 1<<60 + 1, wantDelta: 1, wantOk: true},
+		{value: 7, wantDelta: 7, wantOk: true},
+	}
+	for i, step := range steps {
+		delta, ok := tracker.IntDelta("key", step.value)
+		if delta != step.wantDelta || ok != step.wantOk {
+			t.Errorf("step %d: IntDelta(%v) = (%v, %v), want (%v, %v)", i, step.value, delta, ok, step.wantDelta, step.wantOk)
+		}
+	}
+}
+
+func TestCumulativeTracker_Sweep(t *testing.T) {
+	tracker := NewCumulativeTracker()
+	tracker.FloatDelta("a", 1)
+	tracker.FloatDelta("b", 1)
+	tracker.Sweep()
+
+	if got := tracker.Len(); got != 2 {
+		t.Fatalf("Len() = %d after first sweep, want 2", got)
+	}
+
+	tracker.FloatDelta("a", 2)
+	tracker.Sweep()
+
+	if got := tracker.Len(); got != 1 {
+		t.Fatalf("Len() = %d after second sweep, want 1", got)
+	}
+	if _, ok := tracker.FloatDelta("b", 2); ok {
+		t.Error("FloatDelta() for swept series returned ok, want first observation")
+	}
+}
+
+func TestSeriesKey(t *testing.T) {
+	a := SeriesKey("name", dimensions.NewNormalizedDimensionList(
+		dimensions.NewDimension("k1", "v1"),
+		dimensions.NewDimension("k2", "v2"),
+	))
+	b := SeriesKey("name", dimensions.NewNormalizedDimensionList(
+		dimensions.NewDimension("k2", "v2"),
+		dimensions.NewDimension("k1", "v1"),
+	))
+	if a != b {
+		t.Errorf("SeriesKey() depends on dimension order: %q != %q", a, b)
+	}
+
+	c := SeriesKey("name", dimensions.NewNormalizedDimensionList(dimensions.NewDimension("k1", "v1,k2=v2")))
+	if a == c {
+		t.Errorf("SeriesKey() = %q for different dimensions", c)
+	}
+
+	if got := SeriesKey("name", dimensions.NewNormalizedDimensionList()); got != "name" {
+		t.Errorf("SeriesKey() = %q, want %q", got, "name")
+	}
+}
@@ -0,0 +1,398 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudenrichment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// Dimension keys set by this package.
+const (
+	CloudProviderDimension         = "cloud.provider"
+	CloudRegionDimension           = "cloud.region"
+	CloudAvailabilityZoneDimension = "cloud.availability_zone"
+	CloudAccountIDDimension        = "cloud.account.id"
+	HostIDDimension                = "host.id"
+	HostTypeDimension              = "host.type"
+)
+
+// Values of the cloud.provider dimension.
+const (
+	ProviderAWS   = "aws"
+	ProviderGCP   = "gcp"
+	ProviderAzure = "azure"
+)
+
+const (
+	defaultAWSBaseURL   = "http://169.254.169.254"
+	defaultGCPBaseURL   = "http://metadata.google.internal"
+	defaultAzureBaseURL = "http://169.254.169.254"
+	defaultTimeout      = time.Second
+	defaultCacheTTL     = time.Hour
+
+	awsTokenTTLSeconds = "21600"
+	azureAPIVersion    = "2021-02-01"
+	maxResponseBytes   = 1 << 20
+)
+
+// ErrNoCloudProvider is returned if none of the instance metadata endpoints responded successfully.
+// This is the case if the process is not running on a cloud VM, or if the endpoints are not reachable.
+var ErrNoCloudProvider = errors.New("no cloud instance metadata endpoint responded")
+
+// Option represents the function interface used to configure the Detector.
+type Option func(d *Detector)
+
+// WithAWSBaseURL sets the base URL of the AWS instance metadata service (IMDSv2). An empty URL disables AWS detection.
+// Defaults to http://169.254.169.254.
+func WithAWSBaseURL(url string) Option {
+	return func(d *Detector) {
+		d.awsBaseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithGCPBaseURL sets the base URL of the GCP metadata server. An empty URL disables GCP detection.
+// Defaults to http://metadata.google.internal.
+func WithGCPBaseURL(url string) Option {
+	return func(d *Detector) {
+		d.gcpBaseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithAzureBaseURL sets the base URL of the Azure instance metadata service. An empty URL disables Azure detection.
+// Defaults to http://169.254.169.254.
+func WithAzureBaseURL(url string) Option {
+	return func(d *Detector) {
+		d.azureBaseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithTimeout sets the time after which detection is aborted. All providers are queried in parallel.
+// Defaults to one second.
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *Detector) {
+		d.timeout = timeout
+	}
+}
+
+// WithCacheTTL sets the duration for which detection results are cached. Failed detections are cached as well,
+// so that processes that are not running in a cloud do not wait for the timeout repeatedly. Defaults to one hour.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(d *Detector) {
+		d.cacheTTL = ttl
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to query the metadata endpoints. Defaults to a client without proxy,
+// since the metadata endpoints are only reachable directly.
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Detector) {
+		d.client = client
+	}
+}
+
+// Detector queries the instance metadata endpoints of AWS, GCP and Azure and caches the results.
+// It is safe for concurrent use.
+type Detector struct {
+	client       *http.Client
+	awsBaseURL   string
+	gcpBaseURL   string
+	azureBaseURL string
+	timeout      time.Duration
+	cacheTTL     time.Duration
+	now          func() time.Time
+
+	mu        sync.Mutex
+	cached    dimensions.NormalizedDimensionList
+	cachedErr error
+	expiry    time.Time
+}
+
+// NewDetector creates a new Detector. No requests are sent before GetCloudMetadata is called.
+func NewDetector(opts ...Option) *Detector {
+	d := &Detector{
+		client:       &http.Client{Transport: &http.Transport{Proxy: nil}},
+		awsBaseURL:   defaultAWSBaseURL,
+		gcpBaseURL:   defaultGCPBaseURL,
+		azureBaseURL: defaultAzureBaseURL,
+		timeout:      defaultTimeout,
+		cacheTTL:     defaultCacheTTL,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// GetCloudMetadata returns the cloud metadata of the current instance as NormalizedDimensionList.
+// The result of the first successful provider is used, in the order AWS, GCP, Azure.
+// If no provider responds, an empty list and an error wrapping ErrNoCloudProvider are returned.
+// Results are cached for the configured TTL.
+func (d *Detector) GetCloudMetadata(ctx context.Context) (dimensions.NormalizedDimensionList, error) {
+	dims, _, err := d.lookup(ctx)
+	return dims, err
+}
+
+// lookup returns the cached result, or detects the metadata if the cache expired. detected is true in the latter case.
+func (d *Detector) lookup(ctx context.Context) (dims dimensions.NormalizedDimensionList, detected bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.now().Before(d.expiry) {
+		return d.cached, false, d.cachedErr
+	}
+
+	d.cached, d.cachedErr = d.detect(ctx)
+	// do not cache the result if the caller gave up, as that says nothing about the environment.
+	if ctx.Err() == nil {
+		d.expiry = d.now().Add(d.cacheTTL)
+	}
+
+	return d.cached, true, d.cachedErr
+}
+
+type probe func(ctx context.Context) ([]dimensions.Dimension, error)
+
+type probeResult struct {
+	dims []dimensions.Dimension
+	err  error
+}
+
+func (d *Detector) detect(ctx context.Context) (dimensions.NormalizedDimensionList, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	names := []string{}
+	probes := []probe{}
+	if d.awsBaseURL != "" {
+		names = append(names, ProviderAWS)
+		probes = append(probes, d.probeAWS)
+	}
+	if d.gcpBaseURL != "" {
+		names = append(names, ProviderGCP)
+		probes = append(probes, d.probeGCP)
+	}
+	if d.azureBaseURL != "" {
+		names = append(names, ProviderAzure)
+		probes = append(probes, d.probeAzure)
+	}
+
+	results := make([]probeResult, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func(i int, p probe) {
+			defer wg.Done()
+			dims, err := p(ctx)
+			results[i] = probeResult{dims: dims, err: err}
+		}(i, p)
+	}
+	wg.Wait()
+
+	errs := []string{}
+	for i, result := range results {
+		if result.err == nil {
+			return dimensions.NewNormalizedDimensionList(result.dims...), nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", names[i], result.err))
+	}
+
+	return dimensions.NewNormalizedDimensionList(), fmt.Errorf("%w (%s)", ErrNoCloudProvider, strings.Join(errs, "; "))
+}
+
+// request sends a request and returns the response body if the status code is 200.
+func (d *Detector) request(ctx context.Context, method, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s returned status %d", method, url, resp.StatusCode)
+	}
+
+	return body, nil
+}
+
+func appendIfSet(dims []dimensions.Dimension, key, value string) []dimensions.Dimension {
+	if value == "" {
+		return dims
+	}
+	return append(dims, dimensions.NewDimension(key, value))
+}
+
+type awsIdentityDocument struct {
+	AccountID        string `json:"accountId"`
+	AvailabilityZone string `json:"availabilityZone"`
+	Region           string `json:"region"`
+	InstanceID       string `json:"instanceId"`
+	InstanceType     string `json:"instanceType"`
+}
+
+// probeAWS fetches a session token and the instance identity document from IMDSv2.
+func (d *Detector) probeAWS(ctx context.Context) ([]dimensions.Dimension, error) {
+	token, err := d.request(ctx, http.MethodPut, d.awsBaseURL+"/latest/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": awsTokenTTLSeconds})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := d.request(ctx, http.MethodGet, d.awsBaseURL+"/latest/dynamic/instance-identity/document",
+		map[string]string{"X-aws-ec2-metadata-token": string(token)})
+	if err != nil {
+		return nil, err
+	}
+
+	var doc awsIdentityDocument
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("could not parse instance identity document: %w", err)
+	}
+	if doc.InstanceID == "" {
+		return nil, errors.New("instance identity document does not contain an instance ID")
+	}
+
+	dims := []dimensions.Dimension{dimensions.NewDimension(CloudProviderDimension, ProviderAWS)}
+	dims = appendIfSet(dims, CloudRegionDimension, doc.Region)
+	dims = appendIfSet(dims, CloudAvailabilityZoneDimension, doc.AvailabilityZone)
+	dims = appendIfSet(dims, CloudAccountIDDimension, doc.AccountID)
+	dims = appendIfSet(dims, HostIDDimension, doc.InstanceID)
+	dims = appendIfSet(dims, HostTypeDimension, doc.InstanceType)
+	return dims, nil
+}
+
+type gcpInstance struct {
+	ID          json.Number `json:"id"`
+	Zone        string      `json:"zone"`
+	MachineType string      `json:"machineType"`
+}
+
+// lastPathSegment returns the last segment of GCP resource names like "projects/123/zones/us-central1-a".
+func lastPathSegment(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
+
+// probeGCP fetches the instance attributes and the project ID from the GCP metadata server.
+func (d *Detector) probeGCP(ctx context.Context) ([]dimensions.Dimension, error) {
+	headers := map[string]string{"Metadata-Flavor": "Google"}
+
+	body, err := d.request(ctx, http.MethodGet, d.gcpBaseURL+"/computeMetadata/v1/instance/?recursive=true", headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var instance gcpInstance
+	if err := json.Unmarshal(body, &instance); err != nil {
+		return nil, fmt.Errorf("could not parse instance metadata: %w", err)
+	}
+	if instance.ID == "" {
+		return nil, errors.New("instance metadata does not contain an instance ID")
+	}
+
+	// the project ID is optional, detection succeeds without it.
+	projectID, _ := d.request(ctx, http.MethodGet, d.gcpBaseURL+"/computeMetadata/v1/project/project-id", headers)
+
+	zone := lastPathSegment(instance.Zone)
+	region := ""
+	if index := strings.LastIndex(zone, "-"); index > 0 {
+		region = zone[:index]
+	}
+
+	dims := []dimensions.Dimension{dimensions.NewDimension(CloudProviderDimension, ProviderGCP)}
+	dims = appendIfSet(dims, CloudRegionDimension, region)
+	dims = appendIfSet(dims, CloudAvailabilityZoneDimension, zone)
+	dims = appendIfSet(dims, CloudAccountIDDimension, strings.TrimSpace(string(projectID)))
+	dims = appendIfSet(dims, HostIDDimension, instance.ID.String())
+	dims = appendIfSet(dims, HostTypeDimension, lastPathSegment(instance.MachineType))
+	return dims, nil
+}
+
+type azureCompute struct {
+	Location       string `json:"location"`
+	Zone           string `json:"zone"`
+	VMID           string `json:"vmId"`
+	SubscriptionID string `json:"subscriptionId"`
+	VMSize         string `json:"vmSize"`
+}
+
+// probeAzure fetches the compute metadata from the Azure instance metadata service.
+func (d *Detector) probeAzure(ctx context.Context) ([]dimensions.Dimension, error) {
+	body, err := d.request(ctx, http.MethodGet,
+		d.azureBaseURL+"/metadata/instance/compute?api-version="+azureAPIVersion+"&format=json",
+		map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
+	}
+
+	var compute azureCompute
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return nil, fmt.Errorf("could not parse compute metadata: %w", err)
+	}
+	if compute.VMID == "" {
+		return nil, errors.New("compute metadata does not contain a VM ID")
+	}
+
+	dims := []dimensions.Dimension{dimensions.NewDimension(CloudProviderDimension, ProviderAzure)}
+	dims = appendIfSet(dims, CloudRegionDimension, compute.Location)
+	dims = appendIfSet(dims, CloudAvailabilityZoneDimension, compute.Zone)
+	dims = appendIfSet(dims, CloudAccountIDDimension, compute.SubscriptionID)
+	dims = appendIfSet(dims, HostIDDimension, compute.VMID)
+	dims = appendIfSet(dims, HostTypeDimension, compute.VMSize)
+	return dims, nil
+}
+
+var defaultDetector = NewDetector()
+
+// GetCloudMetadata returns the cloud metadata of the current instance as NormalizedDimensionList, using the default
+// endpoints, timeout and cache. An empty list is returned if the process is not running on a cloud VM.
+func GetCloudMetadata() dimensions.NormalizedDimensionList {
+	return getCloudMetadata(defaultDetector)
+}
+
+// getCloudMetadata logs a failed detection once, and not again while the failure is cached.
+func getCloudMetadata(d *Detector) dimensions.NormalizedDimensionList {
+	dims, detected, err := d.lookup(context.Background())
+	if err != nil && detected {
+		logging.GetLogger().Infof("Could not read cloud metadata. This is normal if you are not running on AWS, GCP or Azure: %v", err)
+	}
+
+	return dims
+}
@@ -0,0 +1,320 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudenrichment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func awsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("session-token"))
+	})
+	mux.HandleFunc("/latest/dynamic/instance-identity/document", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aws-ec2-metadata-token") != "session-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{
+			"accountId": "123456789012",
+			"architecture": "x86_64",
+			"availabilityZone": "eu-central-1b",
+			"instanceId": "i-0123456789abcdef0",
+			"instanceType": "m5.large",
+			"region": "eu-central-1"
+		}`))
+	})
+	return mux
+}
+
+func gcpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/computeMetadata/v1/instance/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Query().Get("recursive") != "true" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{
+			"id": 4520031799277581759,
+			"machineType": "projects/123456789/machineTypes/e2-medium",
+			"name": "my-instance",
+			"zone": "projects/123456789/zones/us-central1-a"
+		}`))
+	})
+	mux.HandleFunc("/computeMetadata/v1/project/project-id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("my-project"))
+	})
+	return mux
+}
+
+func azureHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata/instance/compute", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("api-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{
+			"location": "westeurope",
+			"name": "my-vm",
+			"subscriptionId": "8d10da13-8125-4ba9-a717-bf7490507b3d",
+			"vmId": "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+			"vmSize": "Standard_D2s_v3",
+			"zone": "1"
+		}`))
+	})
+	return mux
+}
+
+func notFound() http.Handler {
+	return http.NotFoundHandler()
+}
+
+func TestDetector_GetCloudMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		aws     http.Handler
+		gcp     http.Handler
+		azure   http.Handler
+		want    dimensions.NormalizedDimensionList
+		wantErr bool
+	}{
+		{
+			name:  "aws",
+			aws:   awsHandler(),
+			gcp:   notFound(),
+			azure: notFound(),
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(CloudProviderDimension, ProviderAWS),
+				dimensions.NewDimension(CloudRegionDimension, "eu-central-1"),
+				dimensions.NewDimension(CloudAvailabilityZoneDimension, "eu-central-1b"),
+				dimensions.NewDimension(CloudAccountIDDimension, "123456789012"),
+				dimensions.NewDimension(HostIDDimension, "i-0123456789abcdef0"),
+				dimensions.NewDimension(HostTypeDimension, "m5.large"),
+			),
+		},
+		{
+			name:  "gcp",
+			aws:   notFound(),
+			gcp:   gcpHandler(),
+			azure: notFound(),
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(CloudProviderDimension, ProviderGCP),
+				dimensions.NewDimension(CloudRegionDimension, "us-central1"),
+				dimensions.NewDimension(CloudAvailabilityZoneDimension, "us-central1-a"),
+				dimensions.NewDimension(CloudAccountIDDimension, "my-project"),
+				dimensions.NewDimension(HostIDDimension, "4520031799277581759"),
+				dimensions.NewDimension(HostTypeDimension, "e2-medium"),
+			),
+		},
+		{
+			name:  "azure",
+			aws:   notFound(),
+			gcp:   notFound(),
+			azure: azureHandler(),
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(CloudProviderDimension, ProviderAzure),
+				dimensions.NewDimension(CloudRegionDimension, "westeurope"),
+				dimensions.NewDimension(CloudAvailabilityZoneDimension, "1"),
+				dimensions.NewDimension(CloudAccountIDDimension, "8d10da13-8125-4ba9-a717-bf7490507b3d"),
+				dimensions.NewDimension(HostIDDimension, "02aab8a4-74ef-476e-8182-f6d2ba4166a6"),
+				dimensions.NewDimension(HostTypeDimension, "Standard_D2s_v3"),
+			),
+		},
+		{
+			name:  "aws takes precedence",
+			aws:   awsHandler(),
+			gcp:   gcpHandler(),
+			azure: azureHandler(),
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(CloudProviderDimension, ProviderAWS),
+				dimensions.NewDimension(CloudRegionDimension, "eu-central-1"),
+				dimensions.NewDimension(CloudAvailabilityZoneDimension, "eu-central-1b"),
+				dimensions.NewDimension(CloudAccountIDDimension, "123456789012"),
+				dimensions.NewDimension(HostIDDimension, "i-0123456789abcdef0"),
+				dimensions.NewDimension(HostTypeDimension, "m5.large"),
+			),
+		},
+		{
+			name:    "no cloud",
+			aws:     notFound(),
+			gcp:     notFound(),
+			azure:   notFound(),
+			want:    dimensions.NewNormalizedDimensionList(),
+			wantErr: true,
+		},
+		{
+			name: "invalid response",
+			aws: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("not json"))
+			}),
+			gcp:     notFound(),
+			azure:   notFound(),
+			want:    dimensions.NewNormalizedDimensionList(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aws := httptest.NewServer(tt.aws)
+			defer aws.Close()
+			gcp := httptest.NewServer(tt.gcp)
+			defer gcp.Close()
+			azure := httptest.NewServer(tt.azure)
+			defer azure.Close()
+
+			d := NewDetector(
+				WithAWSBaseURL(aws.URL),
+				WithGCPBaseURL(gcp.URL+"/"),
+				WithAzureBaseURL(azure.URL),
+			)
+
+			got, err := d.GetCloudMetadata(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetCloudMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrNoCloudProvider) {
+				t.Errorf("GetCloudMetadata() error = %v, want %v", err, ErrNoCloudProvider)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetCloudMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetector_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	d := NewDetector(
+		WithAWSBaseURL(slow.URL),
+		WithGCPBaseURL(slow.URL),
+		WithAzureBaseURL(""),
+		WithTimeout(50*time.Millisecond),
+	)
+
+	start := time.Now()
+	_, err := d.GetCloudMetadata(context.Background())
+	if !errors.Is(err, ErrNoCloudProvider) {
+		t.Errorf("GetCloudMetadata() error = %v, want %v", err, ErrNoCloudProvider)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetCloudMetadata() took %v, expected to time out after 50ms", elapsed)
+	}
+}
+
+func TestDetector_Cache(t *testing.T) {
+	var requests int32
+	counting := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	azure := httptest.NewServer(counting(azureHandler()))
+	defer azure.Close()
+
+	now := time.Date(2021, 11, 3, 12, 0, 0, 0, time.UTC)
+	d := NewDetector(
+		WithAWSBaseURL(""),
+		WithGCPBaseURL(""),
+		WithAzureBaseURL(azure.URL),
+		WithCacheTTL(time.Minute),
+	)
+	d.now = func() time.Time { return now }
+
+	first, err := d.GetCloudMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.GetCloudMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("cached result %v differs from first result %v", second, first)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("sent %d requests, want 1", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := d.GetCloudMetadata(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("sent %d requests after the cache expired, want 2", got)
+	}
+}
+
+func TestDetector_NoProvidersEnabled(t *testing.T) {
+	d := NewDetector(WithAWSBaseURL(""), WithGCPBaseURL(""), WithAzureBaseURL(""))
+	got, err := d.GetCloudMetadata(context.Background())
+	if !errors.Is(err, ErrNoCloudProvider) {
+		t.Errorf("GetCloudMetadata() error = %v, want %v", err, ErrNoCloudProvider)
+	}
+	if !reflect.DeepEqual(got, dimensions.NewNormalizedDimensionList()) {
+		t.Errorf("GetCloudMetadata() = %v, want empty list", got)
+	}
+}
+
+func TestGetCloudMetadata_LogsOncePerDetection(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	now := time.Date(2021, 11, 3, 12, 0, 0, 0, time.UTC)
+	d := NewDetector(WithAWSBaseURL(""), WithGCPBaseURL(""), WithAzureBaseURL(""), WithCacheTTL(time.Minute))
+	d.now = func() time.Time { return now }
+
+	getCloudMetadata(d)
+	getCloudMetadata(d)
+	if got := strings.Count(buf.String(), "Could not read cloud metadata"); got != 1 {
+		t.Errorf("logged %d times while the failure is cached, want 1:\n%s", got, buf.String())
+	}
+
+	now = now.Add(2 * time.Minute)
+	getCloudMetadata(d)
+	if got := strings.Count(buf.String(), "Could not read cloud metadata"); got != 2 {
+		t.Errorf("logged %d times after the cache expired, want 2:\n%s", got, buf.String())
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command statsd listens for StatsD metrics over UDP and forwards them to Dynatrace.
+//
+// Usage:
+//
+//	DT_API_TOKEN=<token> statsd -listen :8125 -endpoint https://{your-environment-id}.live.dynatrace.com/api/v2/metrics/ingest
+//
+// Without -endpoint, the metrics are sent to the local OneAgent.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/exporter"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/apiconstants"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/oneagentenrichment"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/statsd"
+)
+
+func main() {
+	listen := flag.String("listen", ":8125", "UDP address to listen on")
+	endpoint := flag.String("endpoint", apiconstants.GetDefaultOneAgentEndpoint(), "metrics ingest endpoint")
+	prefix := flag.String("prefix", "", "prefix for all metric keys")
+	flushInterval := flag.Duration("flush-interval", 10*time.Second, "interval in which aggregated metrics are sent")
+	flag.Parse()
+
+	client := exporter.NewClient(
+		exporter.WithEndpoint(*endpoint),
+		exporter.WithAPIToken(os.Getenv("DT_API_TOKEN")),
+	)
+	exp := exporter.NewBatchExporter(client)
+
+	server := statsd.NewServer(exp,
+		statsd.WithFlushInterval(*flushInterval),
+		statsd.WithPrefix(*prefix),
+		statsd.WithDefaultDimensions(oneagentenrichment.GetOneAgentMetadata()),
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Listening for StatsD metrics on %s", *listen)
+	err := server.ListenAndServe(ctx, *listen)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if shutdownErr := exp.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Printf("Could not send remaining metrics: %v", shutdownErr)
+	}
+	if err != nil && err != context.Canceled {
+		log.Fatal(err)
+	}
+}
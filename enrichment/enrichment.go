@@ -0,0 +1,371 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrichment
+
+import (
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/oneagentenrichment"
+)
+
+const (
+	defaultRefreshInterval = time.Minute
+	defaultWatchInterval   = 5 * time.Second
+)
+
+// Source provides enrichment dimensions. Sources are re-read by the EnrichmentProvider on every refresh.
+type Source interface {
+	Dimensions() (dimensions.NormalizedDimensionList, error)
+}
+
+// SourceFunc allows using ordinary functions as Source.
+type SourceFunc func() (dimensions.NormalizedDimensionList, error)
+
+// Dimensions calls f.
+func (f SourceFunc) Dimensions() (dimensions.NormalizedDimensionList, error) {
+	return f()
+}
+
+// OneAgentSource returns a Source that reads the OneAgent metadata from fsys.
+// If fsys is nil, the metadata is read from the OS file system.
+func OneAgentSource(fsys fs.FS, opts ...oneagentenrichment.Option) Source {
+	return SourceFunc(func() (dimensions.NormalizedDimensionList, error) {
+		return oneagentenrichment.GetOneAgentMetadataFrom(fsys, opts...)
+	})
+}
+
+// Option represents the function interface used to configure the EnrichmentProvider.
+type Option func(p *EnrichmentProvider)
+
+// WithRefreshInterval sets the interval in which all sources are re-read after Start was called.
+// Intervals smaller than or equal to 0 disable periodic refreshes. Defaults to one minute.
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(p *EnrichmentProvider) {
+		p.refreshInterval = interval
+	}
+}
+
+// WithWatchedFiles sets files that are checked for changes after Start was called. If the modification time or the size
+// of any of the files changes, or if a file is created or removed, all sources are re-read.
+func WithWatchedFiles(paths ...string) Option {
+	return func(p *EnrichmentProvider) {
+		p.watchedFiles = append(p.watchedFiles, paths...)
+	}
+}
+
+// WithWatchInterval sets the interval in which the watched files are checked for changes. Defaults to five seconds.
+func WithWatchInterval(interval time.Duration) Option {
+	return func(p *EnrichmentProvider) {
+		p.watchInterval = interval
+	}
+}
+
+// WithErrorHandler sets a function that is called with every error returned by a source.
+// By default, errors are ignored, and the dimensions returned alongside the error are used.
+func WithErrorHandler(handler func(error)) Option {
+	return func(p *EnrichmentProvider) {
+		p.errorHandler = handler
+	}
+}
+
+// EnrichmentProvider periodically re-reads a list of sources and holds the merged result.
+// The dimensions of sources passed further right overwrite dimensions with the same key from sources further left,
+// in the same way as dimensions.MergeLists does.
+type EnrichmentProvider struct {
+	sources         []Source
+	refreshInterval time.Duration
+	watchedFiles    []string
+	watchInterval   time.Duration
+	errorHandler    func(error)
+
+	// current holds the latest snapshot.
+	current atomic.Value
+	// refreshMutex ensures that only one refresh runs at a time, and guards fileStates.
+	refreshMutex sync.Mutex
+	// fileStates holds the state of the watched files at the time of the last refresh.
+	fileStates []fileState
+
+	subscriberMutex sync.Mutex
+	subscribers     map[int]func(dimensions.NormalizedDimensionList)
+	nextSubscriber  int
+
+	// notifyMutex guards notifying and delivered. Only one goroutine notifies the subscribers at a time, so that
+	// they receive the snapshots in order.
+	notifyMutex sync.Mutex
+	notifying   bool
+	// delivered is the version of the snapshot that was passed to the subscribers last.
+	delivered uint64
+
+	lifecycleMutex sync.Mutex
+	stop           chan struct{}
+	done           chan struct{}
+}
+
+// snapshot is a version of the merged dimensions. The version is incremented whenever the dimensions change.
+type snapshot struct {
+	dims    dimensions.NormalizedDimensionList
+	version uint64
+}
+
+// NewEnrichmentProvider creates a new EnrichmentProvider and reads all sources once, so that Get returns
+// the current dimensions right away. Call Start to keep the dimensions up to date.
+func NewEnrichmentProvider(sources []Source, opts ...Option) *EnrichmentProvider {
+	p := &EnrichmentProvider{
+		sources:         sources,
+		refreshInterval: defaultRefreshInterval,
+		watchInterval:   defaultWatchInterval,
+		subscribers:     map[int]func(dimensions.NormalizedDimensionList){},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.current.Store(snapshot{dims: dimensions.NewNormalizedDimensionList()})
+	p.Refresh()
+
+	return p
+}
+
+// Get returns the current dimensions. It is safe to call Get from multiple goroutines.
+func (p *EnrichmentProvider) Get() dimensions.NormalizedDimensionList {
+	return p.load().dims
+}
+
+func (p *EnrichmentProvider) load() snapshot {
+	return p.current.Load().(snapshot)
+}
+
+// Subscribe registers a function that is called with the new dimensions whenever they change.
+// Subscribers are called by one goroutine at a time, usually the one that performs the refresh. If dimensions change
+// while the subscribers are being notified, the goroutine that is notifying delivers the latest dimensions afterwards,
+// so subscribers never end up with outdated dimensions. Subscribers may call Refresh themselves.
+// Call the returned function to unsubscribe.
+func (p *EnrichmentProvider) Subscribe(subscriber func(dimensions.NormalizedDimensionList)) (unsubscribe func()) {
+	p.subscriberMutex.Lock()
+	defer p.subscriberMutex.Unlock()
+
+	id := p.nextSubscriber
+	p.nextSubscriber++
+	p.subscribers[id] = subscriber
+
+	return func() {
+		p.subscriberMutex.Lock()
+		defer p.subscriberMutex.Unlock()
+		delete(p.subscribers, id)
+	}
+}
+
+// Refresh re-reads all sources and notifies the subscribers if the dimensions changed.
+// Returns true if the dimensions changed.
+func (p *EnrichmentProvider) Refresh() bool {
+	p.refreshMutex.Lock()
+
+	// record the file states before reading the sources, so that changes during the refresh are not missed.
+	p.fileStates = statFiles(p.watchedFiles)
+
+	lists := make([]dimensions.NormalizedDimensionList, 0, len(p.sources))
+	for _, source := range p.sources {
+		dims, err := source.Dimensions()
+		if err != nil && p.errorHandler != nil {
+			p.errorHandler(err)
+		}
+		lists = append(lists, dims)
+	}
+
+	merged := dimensions.MergeLists(lists...)
+	previous := p.load()
+	if equal(merged, previous.dims) {
+		p.refreshMutex.Unlock()
+		return false
+	}
+
+	p.current.Store(snapshot{dims: merged, version: previous.version + 1})
+	// subscribers are notified without holding the lock, so that they can call Refresh themselves.
+	p.refreshMutex.Unlock()
+
+	p.notify()
+	return true
+}
+
+// notify passes the current dimensions to the subscribers, unless another call is already notifying. In that case,
+// the other call delivers the latest dimensions once its subscribers returned.
+func (p *EnrichmentProvider) notify() {
+	p.notifyMutex.Lock()
+	if p.notifying {
+		p.notifyMutex.Unlock()
+		return
+	}
+	p.notifying = true
+
+	for {
+		current := p.load()
+		if current.version == p.delivered {
+			p.notifying = false
+			p.notifyMutex.Unlock()
+			return
+		}
+		p.delivered = current.version
+		p.notifyMutex.Unlock()
+
+		p.callSubscribers(current.dims)
+
+		p.notifyMutex.Lock()
+	}
+}
+
+func (p *EnrichmentProvider) callSubscribers(dims dimensions.NormalizedDimensionList) {
+	p.subscriberMutex.Lock()
+	subscribers := make([]func(dimensions.NormalizedDimensionList), 0, len(p.subscribers))
+	for _, subscriber := range p.subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+	p.subscriberMutex.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(dims)
+	}
+}
+
+// Start starts refreshing the dimensions in the background. Calling Start on a running provider has no effect.
+func (p *EnrichmentProvider) Start() {
+	p.lifecycleMutex.Lock()
+	defer p.lifecycleMutex.Unlock()
+
+	if p.stop != nil {
+		return
+	}
+
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run(p.stop, p.done)
+}
+
+// Stop stops the background refreshes and waits until they have finished.
+func (p *EnrichmentProvider) Stop() {
+	p.lifecycleMutex.Lock()
+	defer p.lifecycleMutex.Unlock()
+
+	if p.stop == nil {
+		return
+	}
+
+	close(p.stop)
+	<-p.done
+	p.stop = nil
+	p.done = nil
+}
+
+func (p *EnrichmentProvider) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	var refreshTicks, watchTicks <-chan time.Time
+	if p.refreshInterval > 0 {
+		ticker := time.NewTicker(p.refreshInterval)
+		defer ticker.Stop()
+		refreshTicks = ticker.C
+	}
+
+	if len(p.watchedFiles) > 0 && p.watchInterval > 0 {
+		ticker := time.NewTicker(p.watchInterval)
+		defer ticker.Stop()
+		watchTicks = ticker.C
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-refreshTicks:
+			p.Refresh()
+		case <-watchTicks:
+			if p.filesChanged() {
+				p.Refresh()
+			}
+		}
+	}
+}
+
+// filesChanged checks if any of the watched files changed since the last refresh.
+func (p *EnrichmentProvider) filesChanged() bool {
+	states := statFiles(p.watchedFiles)
+
+	p.refreshMutex.Lock()
+	defer p.refreshMutex.Unlock()
+
+	return !equalFileStates(p.fileStates, states)
+}
+
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+func statFiles(paths []string) []fileState {
+	states := make([]fileState, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			states = append(states, fileState{})
+			continue
+		}
+		states = append(states, fileState{exists: true, modTime: info.ModTime(), size: info.Size()})
+	}
+	return states
+}
+
+func equalFileStates(a, b []fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].exists != b[i].exists || a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// asMap extracts the dimensions from a NormalizedDimensionList. The list is expected to be de-duplicated.
+func asMap(list dimensions.NormalizedDimensionList) map[string]string {
+	result := map[string]string{}
+	list.Format(func(dims []dimensions.Dimension) string {
+		for _, dim := range dims {
+			result[dim.Key] = dim.Value
+		}
+		return ""
+	})
+	return result
+}
+
+// equal compares two de-duplicated dimension lists, ignoring the order of the dimensions.
+func equal(a, b dimensions.NormalizedDimensionList) bool {
+	mapA, mapB := asMap(a), asMap(b)
+	if len(mapA) != len(mapB) {
+		return false
+	}
+	for k, v := range mapA {
+		if other, ok := mapB[k]; !ok || other != v {
+			return false
+		}
+	}
+	return true
+}
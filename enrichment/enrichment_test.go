@@ -0,0 +1,277 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrichment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/oneagentenrichment"
+)
+
+// mutableSource returns whatever dimensions were set last.
+type mutableSource struct {
+	mu   sync.Mutex
+	dims []dimensions.Dimension
+	err  error
+}
+
+func (s *mutableSource) set(err error, dims ...dimensions.Dimension) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dims = dims
+	s.err = err
+}
+
+func (s *mutableSource) Dimensions() (dimensions.NormalizedDimensionList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return dimensions.NewNormalizedDimensionList(s.dims...), s.err
+}
+
+func TestEnrichmentProvider_Get(t *testing.T) {
+	first := &mutableSource{}
+	first.set(nil, dimensions.NewDimension("key1", "first"), dimensions.NewDimension("key2", "first"))
+	second := &mutableSource{}
+	second.set(nil, dimensions.NewDimension("key2", "second"))
+
+	p := NewEnrichmentProvider([]Source{first, second})
+
+	want := map[string]string{"key1": "first", "key2": "second"}
+	if got := asMap(p.Get()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %v, want %v", got, want)
+	}
+}
+
+func TestEnrichmentProvider_Refresh(t *testing.T) {
+	source := &mutableSource{}
+	source.set(nil, dimensions.NewDimension("key", "value"))
+
+	var errs []error
+	p := NewEnrichmentProvider([]Source{source}, WithErrorHandler(func(err error) { errs = append(errs, err) }))
+
+	var notified []map[string]string
+	unsubscribe := p.Subscribe(func(dims dimensions.NormalizedDimensionList) {
+		notified = append(notified, asMap(dims))
+	})
+
+	if p.Refresh() {
+		t.Error("Refresh() = true for unchanged source, want false")
+	}
+
+	source.set(nil, dimensions.NewDimension("key", "changed"), dimensions.NewDimension("other", "value"))
+	if !p.Refresh() {
+		t.Error("Refresh() = false for changed source, want true")
+	}
+
+	sourceErr := errors.New("source failed")
+	source.set(sourceErr)
+	if !p.Refresh() {
+		t.Error("Refresh() = false for failed source, want true")
+	}
+
+	unsubscribe()
+	source.set(nil, dimensions.NewDimension("key", "value"))
+	p.Refresh()
+
+	wantNotified := []map[string]string{
+		{"key": "changed", "other": "value"},
+		{},
+	}
+	if !reflect.DeepEqual(notified, wantNotified) {
+		t.Errorf("subscriber notified with %v, want %v", notified, wantNotified)
+	}
+
+	if !reflect.DeepEqual(errs, []error{sourceErr}) {
+		t.Errorf("error handler called with %v, want %v", errs, []error{sourceErr})
+	}
+
+	if got := asMap(p.Get()); !reflect.DeepEqual(got, map[string]string{"key": "value"}) {
+		t.Errorf("Get() = %v, want %v", got, map[string]string{"key": "value"})
+	}
+}
+
+func TestEnrichmentProvider_SubscriberCallsRefresh(t *testing.T) {
+	source := &mutableSource{}
+	source.set(nil, dimensions.NewDimension("key", "value"))
+	p := NewEnrichmentProvider([]Source{source})
+
+	var nested []bool
+	p.Subscribe(func(dims dimensions.NormalizedDimensionList) {
+		nested = append(nested, p.Refresh())
+	})
+
+	done := make(chan bool)
+	go func() {
+		source.set(nil, dimensions.NewDimension("key", "changed"))
+		done <- p.Refresh()
+	}()
+
+	select {
+	case changed := <-done:
+		if !changed {
+			t.Error("Refresh() = false for changed source, want true")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Refresh() deadlocked when called from a subscriber")
+	}
+
+	if want := []bool{false}; !reflect.DeepEqual(nested, want) {
+		t.Errorf("nested Refresh() = %v, want %v", nested, want)
+	}
+}
+
+func TestEnrichmentProvider_ConcurrentRefresh(t *testing.T) {
+	var reads int64
+	source := SourceFunc(func() (dimensions.NormalizedDimensionList, error) {
+		n := atomic.AddInt64(&reads, 1)
+		return dimensions.NewNormalizedDimensionList(dimensions.NewDimension("n", strconv.FormatInt(n, 10))), nil
+	})
+	p := NewEnrichmentProvider([]Source{source})
+
+	var mu sync.Mutex
+	var notified []int64
+	p.Subscribe(func(dims dimensions.NormalizedDimensionList) {
+		n, err := strconv.ParseInt(asMap(dims)["n"], 10, 64)
+		if err != nil {
+			t.Error(err)
+		}
+		// give overlapping refreshes the chance to notify in between
+		runtime.Gosched()
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, n)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				p.Refresh()
+				unsubscribe := p.Subscribe(func(dimensions.NormalizedDimensionList) {})
+				unsubscribe()
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i < len(notified); i++ {
+		if notified[i] <= notified[i-1] {
+			t.Fatalf("subscriber notified with %d after %d", notified[i], notified[i-1])
+		}
+	}
+	want := asMap(p.Get())["n"]
+	if len(notified) == 0 || strconv.FormatInt(notified[len(notified)-1], 10) != want {
+		t.Errorf("subscriber was last notified with %v, want %s", notified, want)
+	}
+}
+
+func TestEnrichmentProvider_StartRefreshesPeriodically(t *testing.T) {
+	source := &mutableSource{}
+	p := NewEnrichmentProvider([]Source{source}, WithRefreshInterval(5*time.Millisecond))
+
+	changed := make(chan dimensions.NormalizedDimensionList, 1)
+	p.Subscribe(func(dims dimensions.NormalizedDimensionList) { changed <- dims })
+
+	p.Start()
+	defer p.Stop()
+	// starting twice has no effect
+	p.Start()
+
+	source.set(nil, dimensions.NewDimension("dt.entity.process_group_instance", "PROCESS_GROUP_INSTANCE-1"))
+
+	select {
+	case dims := <-changed:
+		want := map[string]string{"dt.entity.process_group_instance": "PROCESS_GROUP_INSTANCE-1"}
+		if got := asMap(dims); !reflect.DeepEqual(got, want) {
+			t.Errorf("subscriber notified with %v, want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for refresh")
+	}
+}
+
+func TestEnrichmentProvider_StartRefreshesOnFileChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metadata.properties")
+
+	source := SourceFunc(func() (dimensions.NormalizedDimensionList, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return dimensions.NewNormalizedDimensionList(), err
+		}
+		return dimensions.NewNormalizedDimensionList(dimensions.NewDimension("content", string(content))), nil
+	})
+
+	p := NewEnrichmentProvider(
+		[]Source{source},
+		WithRefreshInterval(0),
+		WithWatchedFiles(path),
+		WithWatchInterval(5*time.Millisecond),
+	)
+	if got := asMap(p.Get()); len(got) != 0 {
+		t.Errorf("Get() = %v, want empty", got)
+	}
+
+	changed := make(chan dimensions.NormalizedDimensionList, 1)
+	p.Subscribe(func(dims dimensions.NormalizedDimensionList) { changed <- dims })
+
+	p.Start()
+	defer p.Stop()
+
+	if err := os.WriteFile(path, []byte("value"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case dims := <-changed:
+		want := map[string]string{"content": "value"}
+		if got := asMap(dims); !reflect.DeepEqual(got, want) {
+			t.Errorf("subscriber notified with %v, want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for refresh")
+	}
+}
+
+func TestOneAgentSource(t *testing.T) {
+	fsys := fstest.MapFS{
+		"indirection.properties": {Data: []byte("metadata.properties")},
+		"metadata.properties":    {Data: []byte("dt.entity.process_group_instance=PROCESS_GROUP_INSTANCE-1")},
+	}
+
+	p := NewEnrichmentProvider([]Source{
+		OneAgentSource(fsys, oneagentenrichment.WithIndirectionFilename("indirection.properties")),
+	})
+
+	want := map[string]string{"dt.entity.process_group_instance": "PROCESS_GROUP_INSTANCE-1"}
+	if got := asMap(p.Get()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,430 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/apiconstants"
+)
+
+const defaultFlushInterval = 10 * time.Second
+
+// ErrClosed is returned when lines are exported after the BatchExporter was closed.
+var ErrClosed = errors.New("exporter is closed")
+
+// LineExporter receives serialized metric lines, e.g. from the scrape, statsd, graphite, runtimemetrics and registry
+// packages. *BatchExporter satisfies this interface.
+type LineExporter interface {
+	Export(ctx context.Context, lines ...string) error
+}
+
+// Option represents the function interface used to configure the BatchExporter.
+type Option func(e *BatchExporter)
+
+// WithBatchSize sets the maximum number of lines per payload. Defaults to apiconstants.GetPayloadLinesLimit().
+func WithBatchSize(size int) Option {
+	return func(e *BatchExporter) {
+		e.batchSize = size
+	}
+}
+
+// WithFlushInterval sets the interval in which pending lines are sent, even if the batch is not full.
+// Defaults to ten seconds.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(e *BatchExporter) {
+		e.flushInterval = interval
+	}
+}
+
+// WithErrorHandler sets a function that is called with errors that occur while sending in the background.
+// By default, errors are logged.
+func WithErrorHandler(handler func(error)) Option {
+	return func(e *BatchExporter) {
+		e.errorHandler = handler
+	}
+}
+
+// WithQueue sets the queue that holds the lines until they are sent. Defaults to a queue created by NewQueue.
+// A queue must not be used by more than one BatchExporter.
+func WithQueue(queue *Queue) Option {
+	return func(e *BatchExporter) {
+		e.queue = queue
+	}
+}
+
+type flushRequest struct {
+	ctx    context.Context
+	result chan error
+}
+
+// BatchExporter collects metric lines and sends them in payloads of at most the batch size.
+// Full batches are sent right away, the remaining lines are sent periodically. Sending happens on a background
+// goroutine, which is started by NewBatchExporter and stopped by Shutdown or Close. It is safe for concurrent use.
+type BatchExporter struct {
+	sender        Sender
+	batchSize     int
+	flushInterval time.Duration
+	errorHandler  func(error)
+
+	queue *Queue
+
+	mu         sync.Mutex
+	closed     bool
+	collectors []Collector
+	stats      Stats
+
+	batchFull chan struct{}
+	queueFull chan struct{}
+	flushes   chan flushRequest
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewBatchExporter creates a BatchExporter that sends its payloads using sender, and starts sending in the background.
+func NewBatchExporter(sender Sender, opts ...Option) *BatchExporter {
+	e := &BatchExporter{
+		sender:        sender,
+		batchSize:     apiconstants.GetPayloadLinesLimit(),
+		flushInterval: defaultFlushInterval,
+		errorHandler: func(err error) {
+			logging.GetLogger().Errorf("Could not export metrics: %v", err)
+		},
+		batchFull: make(chan struct{}, 1),
+		queueFull: make(chan struct{}, 1),
+		flushes:   make(chan flushRequest),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = apiconstants.GetPayloadLinesLimit()
+	}
+	if e.queue == nil {
+		e.queue = NewQueue()
+	}
+	// with OverflowBlock, producers wait for room, so the queued lines are sent without waiting for a full batch.
+	e.queue.blocked = func() {
+		select {
+		case e.queueFull <- struct{}{}:
+		default:
+		}
+	}
+
+	go e.run()
+	return e
+}
+
+// Stats holds the number of lines and payloads handled by a BatchExporter since it was created.
+type Stats struct {
+	// LinesExported is the number of lines passed to Export and TryExport.
+	LinesExported uint64
+	// LinesDropped is the number of lines the queue dropped, because they did not fit.
+	LinesDropped uint64
+	// QueuedLines and QueuedBytes describe the lines that are currently queued.
+	QueuedLines int
+	QueuedBytes int
+	// PayloadsSent and LinesSent count the successful sends, PayloadsFailed and LinesFailed the failed ones.
+	PayloadsSent   uint64
+	LinesSent      uint64
+	PayloadsFailed uint64
+	LinesFailed    uint64
+}
+
+// Stats returns the statistics of the BatchExporter.
+func (e *BatchExporter) Stats() Stats {
+	e.mu.Lock()
+	stats := e.stats
+	e.mu.Unlock()
+
+	stats.LinesDropped = e.queue.Dropped()
+	stats.QueuedLines = e.queue.Len()
+	stats.QueuedBytes = e.queue.Bytes()
+	return stats
+}
+
+// Export adds serialized metric lines to the queue. Lines that do not fit into the queue are handled according to
+// its OverflowPolicy. Returns ErrClosed if the exporter was closed, or the context error if ctx is done.
+func (e *BatchExporter) Export(ctx context.Context, lines ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	closed := e.closed
+	if !closed {
+		e.stats.LinesExported += uint64(len(lines))
+	}
+	e.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+
+	err := e.queue.Enqueue(ctx, lines...)
+	e.notifyIfFull()
+	return err
+}
+
+// TryExport adds serialized metric lines to the queue without blocking, for use in hot paths.
+// Returns false if any line was dropped, or if the exporter was closed. See Queue.TryEnqueue.
+func (e *BatchExporter) TryExport(lines ...string) bool {
+	e.mu.Lock()
+	closed := e.closed
+	if !closed {
+		e.stats.LinesExported += uint64(len(lines))
+	}
+	e.mu.Unlock()
+	if closed {
+		return false
+	}
+
+	ok := e.queue.TryEnqueue(lines...)
+	e.notifyIfFull()
+	return ok
+}
+
+// notifyIfFull wakes up the background goroutine if a full batch is queued.
+func (e *BatchExporter) notifyIfFull() {
+	if e.queue.Len() >= e.batchSize {
+		select {
+		case e.batchFull <- struct{}{}:
+		default:
+			// the worker was already notified
+		}
+	}
+}
+
+// ExportMetrics serializes the metrics and adds them to the queue, see ExportMetrics.
+func (e *BatchExporter) ExportMetrics(ctx context.Context, metrics ...*metric.Metric) error {
+	return ExportMetrics(ctx, e, metrics...)
+}
+
+// Flush sends all pending lines and waits until they are sent, or until ctx is done.
+// Returns the errors that occurred while sending.
+func (e *BatchExporter) Flush(ctx context.Context) error {
+	req := flushRequest{ctx: ctx, result: make(chan error, 1)}
+
+	select {
+	case e.flushes <- req:
+	case <-e.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CollectOnShutdown registers a collector, like an aggregation.Aggregator, that is collected one last time by
+// Shutdown, so that the values it aggregated since its last export are not lost.
+func (e *BatchExporter) CollectOnShutdown(collector Collector) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.collectors = append(e.collectors, collector)
+}
+
+// Shutdown stops accepting lines, collects the registered collectors and sends all pending lines, until ctx is done.
+// Lines that could not be sent are listed in the returned *ShutdownError. Lines that are still being sent by
+// the background goroutine when ctx is done are not listed. Returns ErrClosed if the exporter was already shut down.
+func (e *BatchExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return ErrClosed
+	}
+	e.closed = true
+	collectors := e.collectors
+	e.mu.Unlock()
+
+	shutdownErr := &ShutdownError{}
+	for _, c := range collectors {
+		metrics, err := c.Collect()
+		if err != nil {
+			shutdownErr.Errs = append(shutdownErr.Errs, err)
+		}
+
+		lines := make([]string, 0, len(metrics))
+		for _, m := range metrics {
+			line, err := m.Serialize()
+			if err != nil {
+				shutdownErr.Errs = append(shutdownErr.Errs, err)
+				continue
+			}
+			lines = append(lines, line)
+		}
+
+		if err := e.queue.Enqueue(ctx, lines...); err != nil {
+			shutdownErr.Unsent = append(shutdownErr.Unsent, lines...)
+			shutdownErr.Errs = append(shutdownErr.Errs, err)
+		}
+	}
+
+	// wake up producers that wait for room in the queue
+	e.queue.Close()
+	close(e.stop)
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+	}
+
+	for {
+		batch := e.takeBatch(false)
+		if batch == nil {
+			break
+		}
+
+		if err := ctx.Err(); err != nil {
+			shutdownErr.Unsent = append(shutdownErr.Unsent, batch...)
+			continue
+		}
+		if err := e.send(ctx, batch); err != nil {
+			shutdownErr.Unsent = append(shutdownErr.Unsent, batch...)
+			shutdownErr.Errs = append(shutdownErr.Errs, fmt.Errorf("could not send %d line(s): %w", len(batch), err))
+		}
+	}
+	if err := ctx.Err(); err != nil && len(shutdownErr.Unsent) > 0 {
+		shutdownErr.Errs = append(shutdownErr.Errs, err)
+	}
+
+	if len(shutdownErr.Unsent) > 0 || len(shutdownErr.Errs) > 0 {
+		return shutdownErr
+	}
+	return nil
+}
+
+// Close shuts the exporter down without a deadline. See Shutdown.
+func (e *BatchExporter) Close() error {
+	return e.Shutdown(context.Background())
+}
+
+func (e *BatchExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			e.handleError(e.sendPending(context.Background(), false))
+		case <-e.batchFull:
+			e.handleError(e.sendPending(context.Background(), true))
+		case <-e.queueFull:
+			e.handleError(e.sendPending(context.Background(), false))
+		case req := <-e.flushes:
+			req.result <- e.sendPending(req.ctx, false)
+		}
+	}
+}
+
+func (e *BatchExporter) handleError(err error) {
+	if err != nil && e.errorHandler != nil {
+		e.errorHandler(err)
+	}
+}
+
+// takeBatch removes the next batch from the queue. If onlyFull is true, nil is returned
+// unless a full batch is available.
+func (e *BatchExporter) takeBatch(onlyFull bool) []string {
+	if onlyFull && e.queue.Len() < e.batchSize {
+		return nil
+	}
+	return e.queue.Dequeue(e.batchSize)
+}
+
+// send sends one batch and counts the result.
+func (e *BatchExporter) send(ctx context.Context, batch []string) error {
+	err := e.sender.Send(ctx, batch)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.stats.PayloadsFailed++
+		e.stats.LinesFailed += uint64(len(batch))
+	} else {
+		e.stats.PayloadsSent++
+		e.stats.LinesSent += uint64(len(batch))
+	}
+	return err
+}
+
+// sendPending sends batches until no (full) batch is left. All batches are attempted, even if some fail.
+func (e *BatchExporter) sendPending(ctx context.Context, onlyFull bool) error {
+	errs := []string{}
+	for {
+		batch := e.takeBatch(onlyFull)
+		if batch == nil {
+			break
+		}
+
+		if err := e.send(ctx, batch); err != nil {
+			errs = append(errs, fmt.Sprintf("could not send %d line(s): %v", len(batch), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ExportMetrics serializes the metrics and passes the lines to exp. Metrics that cannot be serialized are skipped
+// and reported in the returned error, all other metrics are exported. exp is not called if no line remains.
+// If only the export fails, its error is returned unchanged.
+func ExportMetrics(ctx context.Context, exp LineExporter, metrics ...*metric.Metric) error {
+	lines := make([]string, 0, len(metrics))
+	errs := []string{}
+
+	for _, m := range metrics {
+		line, err := m.Serialize()
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var exportErr error
+	if len(lines) > 0 {
+		exportErr = exp.Export(ctx, lines...)
+	}
+
+	if len(errs) == 0 {
+		return exportErr
+	}
+	serializeErr := fmt.Sprintf("could not serialize %d metric(s): %s", len(errs), strings.Join(errs, "; "))
+	if exportErr != nil {
+		return errors.New(exportErr.Error() + "; " + serializeErr)
+	}
+	return errors.New(serializeErr)
+}
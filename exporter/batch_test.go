@@ -0,0 +1,271 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// recordingSender records all payloads and fails while err is set.
+type recordingSender struct {
+	mu       sync.Mutex
+	payloads [][]string
+	err      error
+	sent     chan struct{}
+}
+
+func newRecordingSender() *recordingSender {
+	return &recordingSender{sent: make(chan struct{}, 100)}
+}
+
+func (s *recordingSender) Send(ctx context.Context, lines []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer func() { s.sent <- struct{}{} }()
+	if s.err != nil {
+		return s.err
+	}
+	s.payloads = append(s.payloads, lines)
+	return nil
+}
+
+func (s *recordingSender) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *recordingSender) getPayloads() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads
+}
+
+func lines(n int) []string {
+	result := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		result = append(result, "metric gauge,"+strconv.Itoa(i))
+	}
+	return result
+}
+
+func TestBatchExporter_Flush(t *testing.T) {
+	sender := newRecordingSender()
+	e := NewBatchExporter(sender, WithFlushInterval(time.Hour))
+	defer e.Close()
+
+	ctx := context.Background()
+	if err := e.Export(ctx, lines(3)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	want := [][]string{lines(3)}
+	if got := sender.getPayloads(); !reflect.DeepEqual(got, want) {
+		t.Errorf("payloads = %v, want %v", got, want)
+	}
+
+	sender.setErr(errors.New("unavailable"))
+	if err := e.Export(ctx, lines(2)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Flush(ctx); err == nil {
+		t.Fatal("Flush() expected error")
+	}
+	wantStats := Stats{LinesExported: 5, PayloadsSent: 1, LinesSent: 3, PayloadsFailed: 1, LinesFailed: 2}
+	if got := e.Stats(); got != wantStats {
+		t.Errorf("Stats() = %+v, want %+v", got, wantStats)
+	}
+}
+
+func TestBatchExporter_SplitsIntoBatches(t *testing.T) {
+	sender := newRecordingSender()
+	e := NewBatchExporter(sender, WithBatchSize(2), WithFlushInterval(time.Hour))
+	defer e.Close()
+
+	all := lines(5)
+	if err := e.Export(context.Background(), all...); err != nil {
+		t.Fatal(err)
+	}
+
+	// full batches are sent without flushing
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sender.sent:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for full batches")
+		}
+	}
+
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{all[0:2], all[2:4], all[4:5]}
+	if got := sender.getPayloads(); !reflect.DeepEqual(got, want) {
+		t.Errorf("payloads = %v, want %v", got, want)
+	}
+}
+
+func TestBatchExporter_FlushInterval(t *testing.T) {
+	sender := newRecordingSender()
+	e := NewBatchExporter(sender, WithFlushInterval(5*time.Millisecond))
+	defer e.Close()
+
+	if err := e.Export(context.Background(), "a gauge,1"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-sender.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for periodic flush")
+	}
+}
+
+func TestBatchExporter_SendErrors(t *testing.T) {
+	sender := newRecordingSender()
+	sender.setErr(errors.New("unreachable"))
+
+	var handled []error
+	e := NewBatchExporter(sender, WithFlushInterval(time.Hour), WithErrorHandler(func(err error) { handled = append(handled, err) }))
+	defer e.Close()
+
+	e.Export(context.Background(), lines(2)...)
+	if err := e.Flush(context.Background()); err == nil {
+		t.Error("Flush() expected error")
+	}
+}
+
+func TestBatchExporter_Close(t *testing.T) {
+	sender := newRecordingSender()
+	e := NewBatchExporter(sender, WithFlushInterval(time.Hour))
+
+	e.Export(context.Background(), lines(2)...)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if got := sender.getPayloads(); !reflect.DeepEqual(got, [][]string{lines(2)}) {
+		t.Errorf("payloads = %v, want pending lines to be sent on close", got)
+	}
+
+	if err := e.Export(context.Background(), "a gauge,1"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Export() after Close() error = %v, want %v", err, ErrClosed)
+	}
+	if err := e.Flush(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Flush() after Close() error = %v, want %v", err, ErrClosed)
+	}
+	if err := e.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("second Close() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestBatchExporter_ExportMetrics(t *testing.T) {
+	sender := newRecordingSender()
+	e := NewBatchExporter(sender, WithFlushInterval(time.Hour))
+	defer e.Close()
+
+	valid, err := metric.NewMetric("valid", metric.WithIntGaugeValue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dims := make([]dimensions.Dimension, 0, 300)
+	for i := 0; i < 300; i++ {
+		dims = append(dims, dimensions.NewDimension("dim"+strconv.Itoa(i), strings.Repeat("v", 250)))
+	}
+	tooLong, err := metric.NewMetric("too_long", metric.WithIntGaugeValue(1), metric.WithDimensions(dimensions.NewNormalizedDimensionList(dims...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.ExportMetrics(context.Background(), valid, tooLong); err == nil {
+		t.Error("ExportMetrics() expected error for metric that cannot be serialized")
+	}
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sender.getPayloads(); !reflect.DeepEqual(got, [][]string{{"valid gauge,1"}}) {
+		t.Errorf("payloads = %v", got)
+	}
+}
+
+// lineExporterFunc adapts a function to the LineExporter interface.
+type lineExporterFunc func(ctx context.Context, lines ...string) error
+
+func (f lineExporterFunc) Export(ctx context.Context, lines ...string) error {
+	return f(ctx, lines...)
+}
+
+func TestExportMetrics(t *testing.T) {
+	valid, err := metric.NewMetric("valid", metric.WithIntGaugeValue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dims := make([]dimensions.Dimension, 0, 300)
+	for i := 0; i < 300; i++ {
+		dims = append(dims, dimensions.NewDimension("dim"+strconv.Itoa(i), strings.Repeat("v", 250)))
+	}
+	tooLong, err := metric.NewMetric("too_long", metric.WithIntGaugeValue(1), metric.WithDimensions(dimensions.NewNormalizedDimensionList(dims...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := [][]string{}
+	exportErr := errors.New("export failed")
+	var failExport bool
+	exp := lineExporterFunc(func(ctx context.Context, lines ...string) error {
+		calls = append(calls, lines)
+		if failExport {
+			return exportErr
+		}
+		return nil
+	})
+
+	if err := ExportMetrics(context.Background(), exp); err != nil {
+		t.Errorf("ExportMetrics() without metrics error = %v", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("ExportMetrics() without metrics exported %v", calls)
+	}
+
+	failExport = true
+	if err := ExportMetrics(context.Background(), exp, valid); err != exportErr {
+		t.Errorf("ExportMetrics() error = %v, want %v", err, exportErr)
+	}
+
+	err = ExportMetrics(context.Background(), exp, valid, tooLong)
+	if err == nil || !strings.Contains(err.Error(), "export failed") || !strings.Contains(err.Error(), "could not serialize 1 metric(s)") {
+		t.Errorf("ExportMetrics() error = %v, want export and serialization errors", err)
+	}
+
+	if want := [][]string{{"valid gauge,1"}, {"valid gauge,1"}}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("exported lines = %v, want %v", calls, want)
+	}
+}
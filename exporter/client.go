@@ -0,0 +1,172 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/apiconstants"
+)
+
+const (
+	defaultClientTimeout = 10 * time.Second
+	maxErrorBodyBytes    = 4096
+)
+
+// Sender sends one payload of metric lines to an ingest endpoint.
+type Sender interface {
+	Send(ctx context.Context, lines []string) error
+}
+
+// StatusError is returned by the Client if the ingest endpoint responds with a status code other than 2xx.
+type StatusError struct {
+	StatusCode int
+	// Body contains the beginning of the response body, which describes the problem.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("ingest endpoint returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// ClientOption represents the function interface used to configure the Client.
+type ClientOption func(c *Client)
+
+// WithEndpoint sets the metrics ingest endpoint. Defaults to the local OneAgent endpoint,
+// see apiconstants.GetDefaultOneAgentEndpoint.
+func WithEndpoint(endpoint string) ClientOption {
+	return func(c *Client) {
+		c.endpoint = endpoint
+	}
+}
+
+// WithAPIToken sets the API token that is sent in the Authorization header. It is required for SaaS and
+// ActiveGate endpoints, but not for the local OneAgent endpoint.
+func WithAPIToken(token string) ClientOption {
+	return func(c *Client) {
+		c.apiToken = token
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send requests. Defaults to a client with a ten second timeout.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// Client sends payloads to a Dynatrace metrics ingest endpoint. It is safe for concurrent use.
+type Client struct {
+	endpoint   string
+	apiToken   string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	stats ClientStats
+}
+
+// ClientStats holds the number of requests sent by a Client since it was created.
+type ClientStats struct {
+	// Requests is the number of requests sent to the endpoint.
+	Requests uint64
+	// StatusCodes is the number of responses by HTTP status code.
+	StatusCodes map[int]uint64
+	// TransportErrors is the number of requests that failed without a response.
+	TransportErrors uint64
+}
+
+// Stats returns the statistics of the Client.
+func (c *Client) Stats() ClientStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.StatusCodes = make(map[int]uint64, len(c.stats.StatusCodes))
+	for code, n := range c.stats.StatusCodes {
+		stats.StatusCodes[code] = n
+	}
+	return stats
+}
+
+func (c *Client) count(statusCode int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Requests++
+	if err != nil {
+		c.stats.TransportErrors++
+		return
+	}
+	if c.stats.StatusCodes == nil {
+		c.stats.StatusCodes = map[int]uint64{}
+	}
+	c.stats.StatusCodes[statusCode]++
+}
+
+// NewClient creates a new Client.
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
+		endpoint:   apiconstants.GetDefaultOneAgentEndpoint(),
+		httpClient: &http.Client{Timeout: defaultClientTimeout},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Send posts the lines to the ingest endpoint in one request. The caller is responsible for keeping the number of
+// lines below the limit accepted by the endpoint (see apiconstants.GetPayloadLinesLimit).
+// A *StatusError is returned if the endpoint does not accept the payload.
+func (c *Client) Send(ctx context.Context, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "dynatrace-metric-utils-go")
+	if c.apiToken != "" {
+		req.Header.Set("Authorization", "Api-Token "+c.apiToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.count(0, err)
+		return err
+	}
+	defer resp.Body.Close()
+	c.count(resp.StatusCode, nil)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	// drain the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClient_Send(t *testing.T) {
+	var gotBody, gotAuth, gotContentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotAuth = r.Header.Get("Authorization")
+		gotContentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	c := NewClient(WithEndpoint(server.URL), WithAPIToken("dt0c01.token"))
+	if err := c.Send(context.Background(), []string{"a gauge,1", "b count,delta=2"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if gotBody != "a gauge,1\nb count,delta=2" {
+		t.Errorf("body = %q", gotBody)
+	}
+	if gotAuth != "Api-Token dt0c01.token" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	if gotContentType != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", gotContentType)
+	}
+}
+
+func TestClient_SendWithoutToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header["Authorization"]; ok {
+			t.Error("Authorization header set without token")
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	if err := NewClient(WithEndpoint(server.URL)).Send(context.Background(), []string{"a gauge,1"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+}
+
+func TestClient_SendStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"linesOk":0,"linesInvalid":1,"error":{"code":400,"message":"1 invalid line"}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(WithEndpoint(server.URL))
+	err := c.Send(context.Background(), []string{"invalid"})
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Send() error = %v, want *StatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusBadRequest || statusErr.Body == "" {
+		t.Errorf("StatusError = %+v", statusErr)
+	}
+
+	want := ClientStats{Requests: 1, StatusCodes: map[int]uint64{http.StatusBadRequest: 1}}
+	if got := c.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestClient_SendTransportError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	c := NewClient(WithEndpoint(server.URL))
+	if err := c.Send(context.Background(), []string{"a gauge,1"}); err == nil {
+		t.Fatal("Send() expected error for closed server")
+	}
+	if got, want := c.Stats(), (ClientStats{Requests: 1, TransportErrors: 1, StatusCodes: map[int]uint64{}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestClient_SendEmpty(t *testing.T) {
+	c := NewClient(WithEndpoint("http://127.0.0.1:0/unreachable"))
+	if err := c.Send(context.Background(), nil); err != nil {
+		t.Errorf("Send() error = %v, want nil for empty payload", err)
+	}
+}
@@ -0,0 +1,583 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxQueueSize   = 64 << 20
+	defaultSegmentSize    = 4 << 20
+	defaultMaxPayloadAge  = time.Hour
+	segmentSuffix         = ".seg"
+	cursorFile            = "cursor"
+	recordHeaderSize      = 16
+	cursorSize            = 20
+	segmentFilePermission = 0o600
+)
+
+// errCorruptRecord is returned when a record does not match its checksum or is truncated.
+var errCorruptRecord = errors.New("corrupt record")
+
+// DiskQueueOption represents the function interface used to configure the DiskQueue.
+type DiskQueueOption func(q *DiskQueue)
+
+// WithMaxQueueSize sets the maximum size of all segments in bytes. If it is exceeded, the oldest segments are
+// dropped. As the segment that is written to is never dropped, the queue can exceed the limit by up to one segment.
+// Payloads that are larger than the limit are rejected. Defaults to 64 MiB.
+func WithMaxQueueSize(bytes int64) DiskQueueOption {
+	return func(q *DiskQueue) {
+		q.maxSize = bytes
+	}
+}
+
+// WithSegmentSize sets the size in bytes at which a new segment file is started. Defaults to 4 MiB.
+func WithSegmentSize(bytes int64) DiskQueueOption {
+	return func(q *DiskQueue) {
+		q.segmentSize = bytes
+	}
+}
+
+// WithMaxPayloadAge sets the age after which queued payloads are dropped instead of sent. Defaults to one hour,
+// the maximum age of timestamps accepted by the ingest API.
+func WithMaxPayloadAge(age time.Duration) DiskQueueOption {
+	return func(q *DiskQueue) {
+		q.maxAge = age
+	}
+}
+
+type segment struct {
+	seq  uint64
+	size int64
+}
+
+// position is the place of the next record to send.
+type position struct {
+	seq    uint64
+	offset int64
+}
+
+// DiskQueue is a Sender that persists payloads in a directory before they are sent with another Sender, so that
+// they survive outages of the ingest endpoint and restarts of the process.
+//
+// Payloads are appended as checksummed records to segment files and sent in the order they were queued.
+// The position of the next payload to send is stored in a cursor file, so that a restarted process continues where
+// the previous one stopped. Segments whose payloads were all sent are deleted. Records that do not match their
+// checksum, e.g. because the process crashed while writing them, are skipped. It is safe for concurrent use.
+type DiskQueue struct {
+	dir         string
+	sender      Sender
+	maxSize     int64
+	segmentSize int64
+	maxAge      time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	segments []segment
+	active   *os.File
+	cursor   position
+	// retrying is set if sending the record at the cursor failed before.
+	retrying bool
+	stats    DiskQueueStats
+}
+
+// DiskQueueStats holds the number of payloads handled by a DiskQueue since it was opened.
+type DiskQueueStats struct {
+	// Queued is the number of payloads written to the queue.
+	Queued uint64
+	// Sent is the number of payloads sent from the queue.
+	Sent uint64
+	// Retries is the number of attempts to send a payload whose previous attempt failed.
+	Retries uint64
+	// Dropped is the number of payloads that were too old, corrupt or rejected by the endpoint.
+	Dropped uint64
+	// SegmentsDropped is the number of segments that were dropped because the queue exceeded its maximum size.
+	SegmentsDropped uint64
+	// Bytes is the current size of all segments.
+	Bytes int64
+}
+
+// NewDiskQueue opens the queue in dir, which is created if it does not exist, and validates the segment that was
+// written last. Payloads that were queued by a previous process are sent by the next Send or Replay.
+func NewDiskQueue(dir string, sender Sender, opts ...DiskQueueOption) (*DiskQueue, error) {
+	q := &DiskQueue{
+		dir:         dir,
+		sender:      sender,
+		maxSize:     defaultMaxQueueSize,
+		segmentSize: defaultSegmentSize,
+		maxAge:      defaultMaxPayloadAge,
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+	if q.segmentSize <= 0 {
+		q.segmentSize = defaultSegmentSize
+	}
+	if q.maxSize <= 0 {
+		q.maxSize = defaultMaxQueueSize
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := q.open(); err != nil {
+		return nil, fmt.Errorf("could not open queue in %s: %w", dir, err)
+	}
+	return q, nil
+}
+
+func (q *DiskQueue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+// open reads the cursor and the existing segments, and opens the last segment for appending.
+func (q *DiskQueue) open() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := q.readCursor()
+	if err != nil {
+		return err
+	}
+	q.cursor = cursor
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		if seq < q.cursor.seq {
+			// all payloads of the segment were sent, but it was not deleted.
+			if err := os.Remove(filepath.Join(q.dir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		q.segments = append(q.segments, segment{seq: seq, size: info.Size()})
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].seq < q.segments[j].seq })
+
+	if len(q.segments) == 0 {
+		seq := q.cursor.seq
+		if seq == 0 {
+			seq = 1
+		}
+		return q.startSegment(seq)
+	}
+
+	// the last segment may end with a record that was only partially written.
+	last := &q.segments[len(q.segments)-1]
+	valid, err := validLength(q.segmentPath(last.seq), q.maxSize)
+	if err != nil {
+		return err
+	}
+	if valid < last.size {
+		if err := os.Truncate(q.segmentPath(last.seq), valid); err != nil {
+			return err
+		}
+		last.size = valid
+	}
+
+	q.active, err = os.OpenFile(q.segmentPath(last.seq), os.O_WRONLY|os.O_APPEND, segmentFilePermission)
+	return err
+}
+
+// validLength returns the length of the segment up to the first corrupt record.
+func validLength(path string, maxRecordSize int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var length int64
+	for {
+		n, _, _, err := readRecord(r, maxRecordSize)
+		if err != nil {
+			if err == io.EOF || errors.Is(err, errCorruptRecord) {
+				return length, nil
+			}
+			return 0, err
+		}
+		length += n
+	}
+}
+
+func (q *DiskQueue) startSegment(seq uint64) error {
+	if q.active != nil {
+		if err := q.active.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_WRONLY|os.O_APPEND|os.O_CREATE, segmentFilePermission)
+	if err != nil {
+		return err
+	}
+	q.active = f
+	q.segments = append(q.segments, segment{seq: seq})
+	return nil
+}
+
+// Send appends the payload to the queue and then sends all queued payloads in order, until one fails.
+// Send returns nil once the payload is persisted, even if it could not be sent yet; Replay returns the send errors.
+// Payloads that the endpoint rejects as invalid are dropped and reported in the returned error.
+func (q *DiskQueue) Send(ctx context.Context, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.append([]byte(strings.Join(lines, "\n"))); err != nil {
+		return fmt.Errorf("could not queue %d line(s): %w", len(lines), err)
+	}
+
+	err := q.replay(ctx)
+	var dropped *droppedError
+	if errors.As(err, &dropped) {
+		return err
+	}
+	return nil
+}
+
+// Replay sends all queued payloads in order, until one fails, and returns the error of the failed payload.
+func (q *DiskQueue) Replay(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.replay(ctx)
+}
+
+// Size returns the size of all segments in bytes, including payloads that were already sent from the oldest segment.
+func (q *DiskQueue) Size() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var size int64
+	for _, s := range q.segments {
+		size += s.size
+	}
+	return size
+}
+
+// Stats returns the statistics of the DiskQueue.
+func (q *DiskQueue) Stats() DiskQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	for _, s := range q.segments {
+		stats.Bytes += s.size
+	}
+	return stats
+}
+
+// Close closes the segment file. Queued payloads remain on disk.
+func (q *DiskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.active == nil {
+		return nil
+	}
+	err := q.active.Close()
+	q.active = nil
+	return err
+}
+
+// append writes a record to the active segment, starts a new segment if it is full and drops the oldest segments
+// if the queue is too large.
+func (q *DiskQueue) append(payload []byte) error {
+	if q.active == nil {
+		return ErrClosed
+	}
+
+	if int64(recordHeaderSize+len(payload)) > q.maxSize {
+		return fmt.Errorf("payload of %d bytes exceeds the maximum queue size of %d bytes", len(payload), q.maxSize)
+	}
+
+	last := &q.segments[len(q.segments)-1]
+	record := encodeRecord(payload, q.now())
+	if _, err := q.active.Write(record); err != nil {
+		// remove a partially written record, so that later records can be read.
+		_ = q.active.Truncate(last.size)
+		return err
+	}
+	if err := q.active.Sync(); err != nil {
+		return err
+	}
+	last.size += int64(len(record))
+	q.stats.Queued++
+	if last.size >= q.segmentSize {
+		if err := q.startSegment(last.seq + 1); err != nil {
+			return err
+		}
+	}
+
+	var total int64
+	for _, s := range q.segments {
+		total += s.size
+	}
+	if total <= q.maxSize {
+		return nil
+	}
+	for total > q.maxSize && len(q.segments) > 1 {
+		oldest := q.segments[0]
+		if err := os.Remove(q.segmentPath(oldest.seq)); err != nil {
+			return err
+		}
+		q.segments = q.segments[1:]
+		total -= oldest.size
+		q.stats.SegmentsDropped++
+		if q.cursor.seq <= oldest.seq {
+			q.cursor = position{seq: q.segments[0].seq}
+			q.retrying = false
+		}
+	}
+	return q.writeCursor()
+}
+
+// droppedError reports payloads that were dropped while replaying.
+type droppedError struct {
+	errs []string
+}
+
+func (e *droppedError) Error() string {
+	return fmt.Sprintf("dropped %d queued payload(s): %s", len(e.errs), strings.Join(e.errs, "; "))
+}
+
+// replay sends the queued records from the cursor on, until one fails or all are sent.
+func (q *DiskQueue) replay(ctx context.Context) error {
+	dropped := []string{}
+
+	for len(q.segments) > 0 {
+		current := q.segments[0]
+		if q.cursor.seq < current.seq {
+			q.cursor = position{seq: current.seq}
+		}
+		isActive := len(q.segments) == 1
+
+		corrupt, err := q.replaySegment(ctx, current.seq, &dropped)
+		if err != nil {
+			if len(dropped) > 0 {
+				return fmt.Errorf("%w; %v", &droppedError{errs: dropped}, err)
+			}
+			return err
+		}
+		if isActive {
+			if !corrupt {
+				break
+			}
+			// records after a corrupt record cannot be found, so the payloads that are queued later are written
+			// to a new segment, and the corrupt segment is deleted like a sent one.
+			if err := q.startSegment(current.seq + 1); err != nil {
+				return err
+			}
+		}
+
+		// all records of the segment were sent
+		if err := os.Remove(q.segmentPath(current.seq)); err != nil {
+			return err
+		}
+		q.segments = q.segments[1:]
+		q.cursor = position{seq: q.segments[0].seq}
+		if err := q.writeCursor(); err != nil {
+			return err
+		}
+	}
+
+	if len(dropped) > 0 {
+		return &droppedError{errs: dropped}
+	}
+	return nil
+}
+
+// replaySegment sends the records of one segment from the cursor on. A corrupt record ends the segment, in which
+// case corrupt is true.
+func (q *DiskQueue) replaySegment(ctx context.Context, seq uint64, dropped *[]string) (corrupt bool, err error) {
+	f, err := os.Open(q.segmentPath(seq))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(q.cursor.offset, io.SeekStart); err != nil {
+		return false, err
+	}
+	r := bufio.NewReader(f)
+
+	for {
+		n, timestamp, payload, err := readRecord(r, q.maxSize)
+		if err == io.EOF {
+			return false, nil
+		}
+		if errors.Is(err, errCorruptRecord) {
+			q.stats.Dropped++
+			q.retrying = false
+			*dropped = append(*dropped, fmt.Sprintf("segment %d at offset %d: %v", seq, q.cursor.offset, err))
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if q.maxAge > 0 && q.now().Sub(timestamp) > q.maxAge {
+			q.stats.Dropped++
+			*dropped = append(*dropped, fmt.Sprintf("payload queued at %s is older than %s", timestamp.Format(time.RFC3339), q.maxAge))
+		} else {
+			if q.retrying {
+				q.stats.Retries++
+			}
+			if err := q.sender.Send(ctx, strings.Split(string(payload), "\n")); err != nil {
+				if !isPermanent(err) {
+					q.retrying = true
+					return false, err
+				}
+				q.stats.Dropped++
+				*dropped = append(*dropped, err.Error())
+			} else {
+				q.stats.Sent++
+			}
+		}
+		q.retrying = false
+
+		q.cursor.offset += n
+		if err := q.writeCursor(); err != nil {
+			return false, err
+		}
+	}
+}
+
+// isPermanent returns true if resending the payload cannot succeed, because the endpoint rejected it as invalid.
+func isPermanent(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 &&
+		statusErr.StatusCode != http.StatusRequestTimeout && statusErr.StatusCode != http.StatusTooManyRequests
+}
+
+// encodeRecord creates a record of a 4 byte payload length, a 4 byte CRC-32 checksum of the timestamp and
+// the payload, the 8 byte timestamp in Unix nanoseconds and the payload.
+func encodeRecord(payload []byte, timestamp time.Time) []byte {
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(record[8:16], uint64(timestamp.UnixNano()))
+	copy(record[recordHeaderSize:], payload)
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(record[8:]))
+	return record
+}
+
+// readRecord reads the next record and returns its length on disk. Records that are larger than maxRecordSize are
+// reported as corrupt. Returns io.EOF if no record is left.
+func readRecord(r io.Reader, maxRecordSize int64) (n int64, timestamp time.Time, payload []byte, err error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return 0, time.Time{}, nil, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return 0, time.Time{}, nil, fmt.Errorf("%w: truncated header", errCorruptRecord)
+		}
+		return 0, time.Time{}, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if int64(recordHeaderSize)+int64(length) > maxRecordSize {
+		return 0, time.Time{}, nil, fmt.Errorf("%w: invalid length %d", errCorruptRecord, length)
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, time.Time{}, nil, fmt.Errorf("%w: truncated payload", errCorruptRecord)
+		}
+		return 0, time.Time{}, nil, err
+	}
+
+	checksum := crc32.NewIEEE()
+	checksum.Write(header[8:16])
+	checksum.Write(payload)
+	if checksum.Sum32() != binary.BigEndian.Uint32(header[4:8]) {
+		return 0, time.Time{}, nil, fmt.Errorf("%w: checksum mismatch", errCorruptRecord)
+	}
+
+	timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16])))
+	return int64(recordHeaderSize) + int64(length), timestamp, payload, nil
+}
+
+// readCursor reads the position of the next record to send. A missing or corrupt cursor starts at the beginning.
+func (q *DiskQueue) readCursor() (position, error) {
+	data, err := os.ReadFile(filepath.Join(q.dir, cursorFile))
+	if os.IsNotExist(err) {
+		return position{}, nil
+	}
+	if err != nil {
+		return position{}, err
+	}
+	if len(data) != cursorSize || crc32.ChecksumIEEE(data[:16]) != binary.BigEndian.Uint32(data[16:20]) {
+		return position{}, nil
+	}
+
+	return position{
+		seq:    binary.BigEndian.Uint64(data[0:8]),
+		offset: int64(binary.BigEndian.Uint64(data[8:16])),
+	}, nil
+}
+
+// writeCursor replaces the cursor file atomically.
+func (q *DiskQueue) writeCursor() error {
+	data := make([]byte, cursorSize)
+	binary.BigEndian.PutUint64(data[0:8], q.cursor.seq)
+	binary.BigEndian.PutUint64(data[8:16], uint64(q.cursor.offset))
+	binary.BigEndian.PutUint32(data[16:20], crc32.ChecksumIEEE(data[:16]))
+
+	tmp := filepath.Join(q.dir, cursorFile+".tmp")
+	if err := os.WriteFile(tmp, data, segmentFilePermission); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.dir, cursorFile))
+}
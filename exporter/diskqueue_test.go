@@ -0,0 +1,357 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flippingEndpoint is an ingest endpoint that fails with the configured status code until it is set to 0.
+type flippingEndpoint struct {
+	mu       sync.Mutex
+	failWith int
+	received []string
+}
+
+func (e *flippingEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.failWith != 0 {
+		w.WriteHeader(e.failWith)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	e.received = append(e.received, string(body))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (e *flippingEndpoint) set(status int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failWith = status
+}
+
+func (e *flippingEndpoint) payloads() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string{}, e.received...)
+}
+
+func newFlippingEndpoint(t *testing.T) (*flippingEndpoint, *Client) {
+	t.Helper()
+
+	endpoint := &flippingEndpoint{}
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+	return endpoint, NewClient(WithEndpoint(server.URL))
+}
+
+func openQueue(t *testing.T, dir string, sender Sender, opts ...DiskQueueOption) *DiskQueue {
+	t.Helper()
+
+	q, err := NewDiskQueue(dir, sender, opts...)
+	if err != nil {
+		t.Fatalf("NewDiskQueue() error = %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestDiskQueue_ReplayInOrder(t *testing.T) {
+	endpoint, client := newFlippingEndpoint(t)
+	q := openQueue(t, t.TempDir(), client, WithSegmentSize(64))
+	ctx := context.Background()
+
+	endpoint.set(http.StatusServiceUnavailable)
+	for _, payload := range []string{"a gauge,1", "b gauge,2\nc gauge,3"} {
+		if err := q.Send(ctx, strings.Split(payload, "\n")); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if err := q.Replay(ctx); err == nil {
+		t.Error("Replay() expected error while the endpoint fails")
+	}
+	if got := endpoint.payloads(); len(got) != 0 {
+		t.Fatalf("endpoint received %v while failing", got)
+	}
+
+	endpoint.set(0)
+	if err := q.Send(ctx, []string{"d gauge,4"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	want := []string{"a gauge,1", "b gauge,2\nc gauge,3", "d gauge,4"}
+	if got := endpoint.payloads(); !reflect.DeepEqual(got, want) {
+		t.Errorf("endpoint received %v, want %v", got, want)
+	}
+	// the first payload failed three times: when it was queued, with the second payload and on Replay
+	wantStats := DiskQueueStats{Queued: 3, Sent: 3, Retries: 3}
+	got := q.Stats()
+	if got.Bytes != q.Size() {
+		t.Errorf("Stats().Bytes = %d, want %d", got.Bytes, q.Size())
+	}
+	got.Bytes = 0
+	if got != wantStats {
+		t.Errorf("Stats() = %+v, want %+v", got, wantStats)
+	}
+
+	// sent segments are deleted, only the segment that is written to remains
+	segments, _ := filepath.Glob(filepath.Join(q.dir, "*"+segmentSuffix))
+	if len(segments) != 1 {
+		t.Errorf("segments = %v, want 1", segments)
+	}
+}
+
+func TestDiskQueue_SurvivesRestart(t *testing.T) {
+	endpoint, client := newFlippingEndpoint(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	endpoint.set(http.StatusBadGateway)
+	q := openQueue(t, dir, client)
+	for _, line := range []string{"a gauge,1", "b gauge,2"} {
+		if err := q.Send(ctx, []string{line}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	q.Close()
+
+	endpoint.set(0)
+	q = openQueue(t, dir, client)
+	if err := q.Replay(ctx); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	q.Close()
+
+	// the cursor prevents sending the payloads again
+	q = openQueue(t, dir, client)
+	if err := q.Replay(ctx); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if got, want := endpoint.payloads(), []string{"a gauge,1", "b gauge,2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("endpoint received %v, want %v", got, want)
+	}
+}
+
+func TestDiskQueue_CorruptRecord(t *testing.T) {
+	endpoint, client := newFlippingEndpoint(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	endpoint.set(http.StatusServiceUnavailable)
+	q := openQueue(t, dir, client)
+	for _, line := range []string{"a gauge,1", "b gauge,2", "c gauge,3"} {
+		if err := q.Send(ctx, []string{line}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	q.Close()
+
+	// flip a byte in the payload of the second record
+	path := q.segmentPath(1)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordSize := recordHeaderSize + len("a gauge,1")
+	data[recordSize+recordHeaderSize] ^= 0xff
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the segment is truncated before the corrupt record
+	endpoint.set(0)
+	q = openQueue(t, dir, client)
+	if got := q.Size(); got != int64(recordSize) {
+		t.Errorf("Size() = %d, want %d", got, recordSize)
+	}
+	if err := q.Send(ctx, []string{"d gauge,4"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got, want := endpoint.payloads(), []string{"a gauge,1", "d gauge,4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("endpoint received %v, want %v", got, want)
+	}
+}
+
+func TestDiskQueue_CorruptRecordInActiveSegment(t *testing.T) {
+	endpoint, client := newFlippingEndpoint(t)
+	q := openQueue(t, t.TempDir(), client)
+	ctx := context.Background()
+
+	endpoint.set(http.StatusServiceUnavailable)
+	for _, line := range []string{"a gauge,1", "b gauge,2"} {
+		if err := q.Send(ctx, []string{line}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	// flip a byte in the payload of the second record, while the segment is still written to
+	path := q.segmentPath(1)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordSize := recordHeaderSize + len("a gauge,1")
+	data[recordSize+recordHeaderSize] ^= 0xff
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint.set(0)
+	err = q.Send(ctx, []string{"c gauge,3"})
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 queued payload(s)") {
+		t.Errorf("Send() error = %v, want dropped payload", err)
+	}
+	// the corrupt record is reported once. The payload that was appended behind it in the same segment cannot be
+	// found anymore, but payloads queued later are written to a new segment and sent.
+	for _, line := range []string{"d gauge,4", "e gauge,5"} {
+		if err := q.Send(ctx, []string{line}); err != nil {
+			t.Errorf("Send() error = %v", err)
+		}
+	}
+	if got, want := endpoint.payloads(), []string{"a gauge,1", "d gauge,4", "e gauge,5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("endpoint received %v, want %v", got, want)
+	}
+	if got := q.Stats(); got.Dropped != 1 || got.Sent != 3 {
+		t.Errorf("Stats() = %+v, want 1 dropped and 3 sent payloads", got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("corrupt segment was not deleted: %v", err)
+	}
+}
+
+func TestDiskQueue_PayloadSize(t *testing.T) {
+	_, client := newFlippingEndpoint(t)
+	q := openQueue(t, t.TempDir(), client, WithMaxQueueSize(64))
+
+	if err := q.Send(context.Background(), []string{strings.Repeat("a", 64)}); err == nil {
+		t.Error("Send() expected error for payload larger than the maximum queue size")
+	}
+	if got := q.Stats().Queued; got != 0 {
+		t.Errorf("Stats().Queued = %d, want 0", got)
+	}
+}
+
+func TestDiskQueue_LargeRecordSurvivesRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes a payload larger than the default maximum queue size")
+	}
+
+	endpoint, client := newFlippingEndpoint(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+	opts := []DiskQueueOption{WithMaxQueueSize(2 * defaultMaxQueueSize), WithSegmentSize(2 * defaultMaxQueueSize)}
+
+	endpoint.set(http.StatusServiceUnavailable)
+	q := openQueue(t, dir, client, opts...)
+	line := strings.Repeat("a", defaultMaxQueueSize+1)
+	if err := q.Send(ctx, []string{line}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	q.Close()
+
+	// the record is valid for the configured limit, so it is not truncated on open
+	q = openQueue(t, dir, client, opts...)
+	if got, want := q.Size(), int64(recordHeaderSize+len(line)); got != want {
+		t.Errorf("Size() = %d, want %d", got, want)
+	}
+	endpoint.set(0)
+	if err := q.Replay(ctx); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if got := endpoint.payloads(); len(got) != 1 || got[0] != line {
+		t.Errorf("endpoint received %d payload(s), want the large payload", len(got))
+	}
+}
+
+func TestDiskQueue_MaxAge(t *testing.T) {
+	endpoint, client := newFlippingEndpoint(t)
+	q := openQueue(t, t.TempDir(), client, WithMaxPayloadAge(time.Minute))
+	now := time.Now()
+	q.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	endpoint.set(http.StatusServiceUnavailable)
+	if err := q.Send(ctx, []string{"old gauge,1"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	endpoint.set(0)
+	err := q.Send(ctx, []string{"new gauge,1"})
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 queued payload(s)") {
+		t.Errorf("Send() error = %v, want dropped payload", err)
+	}
+	if got, want := endpoint.payloads(), []string{"new gauge,1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("endpoint received %v, want %v", got, want)
+	}
+}
+
+func TestDiskQueue_MaxSize(t *testing.T) {
+	endpoint, client := newFlippingEndpoint(t)
+	line := "metric gauge,1"
+	recordSize := int64(recordHeaderSize + len(line))
+	// one record per segment, at most three segments
+	q := openQueue(t, t.TempDir(), client, WithSegmentSize(recordSize), WithMaxQueueSize(3*recordSize))
+	ctx := context.Background()
+
+	endpoint.set(http.StatusServiceUnavailable)
+	for i := 0; i < 5; i++ {
+		if err := q.Send(ctx, []string{line}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if got := q.Size(); got > 3*recordSize {
+		t.Errorf("Size() = %d, want at most %d", got, 3*recordSize)
+	}
+
+	endpoint.set(0)
+	if err := q.Replay(ctx); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if got := endpoint.payloads(); len(got) != 3 {
+		t.Errorf("endpoint received %d payloads, want the 3 newest", len(got))
+	}
+}
+
+func TestDiskQueue_PermanentError(t *testing.T) {
+	endpoint, client := newFlippingEndpoint(t)
+	q := openQueue(t, t.TempDir(), client)
+
+	endpoint.set(http.StatusBadRequest)
+	err := q.Send(context.Background(), []string{"invalid"})
+	if err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("Send() error = %v, want dropped payload", err)
+	}
+
+	// the rejected payload is not sent again
+	endpoint.set(0)
+	if err := q.Send(context.Background(), []string{"a gauge,1"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got, want := endpoint.payloads(), []string{"a gauge,1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("endpoint received %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	defaultMaxQueuedLines = 100000
+	defaultMaxQueuedBytes = 32 << 20
+)
+
+// OverflowPolicy decides what happens to lines that do not fit into a full Queue.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest removes the oldest queued lines to make room for new ones.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDropNewest drops the lines that do not fit.
+	OverflowDropNewest
+	// OverflowBlock makes Enqueue wait until there is room. TryEnqueue drops the lines that do not fit instead.
+	OverflowBlock
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropOldest:
+		return "drop oldest"
+	case OverflowDropNewest:
+		return "drop newest"
+	default:
+		return "block"
+	}
+}
+
+// QueueOption represents the function interface used to configure the Queue.
+type QueueOption func(q *Queue)
+
+// WithMaxLines sets the maximum number of queued lines. Defaults to 100000.
+func WithMaxLines(lines int) QueueOption {
+	return func(q *Queue) {
+		q.maxLines = lines
+	}
+}
+
+// WithMaxBytes sets the maximum size of all queued lines in bytes. Defaults to 32 MiB.
+func WithMaxBytes(bytes int) QueueOption {
+	return func(q *Queue) {
+		q.maxBytes = bytes
+	}
+}
+
+// WithOverflowPolicy sets what happens to lines that do not fit into the full queue. Defaults to OverflowDropOldest.
+func WithOverflowPolicy(policy OverflowPolicy) QueueOption {
+	return func(q *Queue) {
+		q.policy = policy
+	}
+}
+
+// Queue holds serialized lines until they are sent, bounded by a maximum number of lines and bytes.
+// Lines that do not fit are handled according to the OverflowPolicy and counted as dropped. A line that is larger
+// than the byte limit is always dropped. It is safe for concurrent use.
+type Queue struct {
+	maxLines int
+	maxBytes int
+	policy   OverflowPolicy
+
+	mu      sync.Mutex
+	lines   []string
+	bytes   int
+	dropped uint64
+	closed  bool
+	// space is closed and replaced whenever lines are removed, to wake up blocked producers.
+	space chan struct{}
+	// blocked is called without q.mu held when a producer starts to wait for room, so the consumer can make room.
+	blocked func()
+}
+
+// NewQueue creates an empty Queue.
+func NewQueue(opts ...QueueOption) *Queue {
+	q := &Queue{
+		maxLines: defaultMaxQueuedLines,
+		maxBytes: defaultMaxQueuedBytes,
+		space:    make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+	if q.maxLines <= 0 {
+		q.maxLines = defaultMaxQueuedLines
+	}
+	if q.maxBytes <= 0 {
+		q.maxBytes = defaultMaxQueuedBytes
+	}
+
+	return q
+}
+
+// Enqueue adds the lines to the queue. With OverflowBlock, Enqueue waits until all lines fit, and returns the context
+// error if ctx is done first, or ErrClosed if the queue is closed first. Lines that were added before remain queued.
+// Returns ErrClosed if the queue is closed.
+func (q *Queue) Enqueue(ctx context.Context, lines ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, line := range lines {
+		for {
+			if q.closed {
+				return ErrClosed
+			}
+			if _, full := q.offer(line); !full {
+				break
+			}
+
+			space := q.space
+			q.mu.Unlock()
+			if q.blocked != nil {
+				q.blocked()
+			}
+			select {
+			case <-space:
+			case <-ctx.Done():
+				q.mu.Lock()
+				return ctx.Err()
+			}
+			q.mu.Lock()
+		}
+	}
+	return nil
+}
+
+// TryEnqueue adds the lines to the queue without blocking, for use in hot paths. Lines that do not fit are handled
+// according to the OverflowPolicy, except that OverflowBlock drops them like OverflowDropNewest.
+// Returns false if any of the lines was not queued, or if the queue is closed.
+func (q *Queue) TryEnqueue(lines ...string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+
+	all := true
+	for _, line := range lines {
+		queued, full := q.offer(line)
+		if full {
+			q.dropped++
+		}
+		all = all && queued
+	}
+	return all
+}
+
+// offer adds the line according to the policy. Returns full if the line does not fit and the policy is OverflowBlock,
+// in which case the line is neither queued nor dropped. Must be called with q.mu held.
+func (q *Queue) offer(line string) (queued, full bool) {
+	switch {
+	case len(line) > q.maxBytes:
+		// the line can never fit.
+		q.dropped++
+		return false, false
+	case q.fits(line):
+	case q.policy == OverflowDropNewest:
+		q.dropped++
+		return false, false
+	case q.policy == OverflowDropOldest:
+		for !q.fits(line) {
+			q.bytes -= len(q.lines[0])
+			q.lines[0] = ""
+			q.lines = q.lines[1:]
+			q.dropped++
+		}
+	default:
+		return false, true
+	}
+
+	q.lines = append(q.lines, line)
+	q.bytes += len(line)
+	return true, false
+}
+
+func (q *Queue) fits(line string) bool {
+	return len(q.lines) < q.maxLines && q.bytes+len(line) <= q.maxBytes
+}
+
+// Dequeue removes and returns up to n of the oldest lines. Returns nil if the queue is empty.
+func (q *Queue) Dequeue(n int) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.lines) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(q.lines) {
+		n = len(q.lines)
+	}
+
+	result := make([]string, n)
+	copy(result, q.lines)
+	for i := 0; i < n; i++ {
+		q.bytes -= len(q.lines[i])
+		q.lines[i] = ""
+	}
+	q.lines = q.lines[n:]
+	if len(q.lines) == 0 {
+		// release the underlying array
+		q.lines = nil
+	}
+
+	close(q.space)
+	q.space = make(chan struct{})
+	return result
+}
+
+// Len returns the number of queued lines.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.lines)
+}
+
+// Bytes returns the size of all queued lines in bytes.
+func (q *Queue) Bytes() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.bytes
+}
+
+// Dropped returns the number of lines that were dropped because they did not fit.
+func (q *Queue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.dropped
+}
+
+// Close rejects all further lines and wakes up blocked producers. Queued lines can still be dequeued.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.space)
+		q.space = make(chan struct{})
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueue_Policies(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []QueueOption
+		lines   []string
+		want    []string
+		dropped uint64
+	}{
+		{
+			name:    "drop oldest",
+			opts:    []QueueOption{WithMaxLines(3)},
+			lines:   []string{"a", "b", "c", "d", "e"},
+			want:    []string{"c", "d", "e"},
+			dropped: 2,
+		},
+		{
+			name:    "drop newest",
+			opts:    []QueueOption{WithMaxLines(3), WithOverflowPolicy(OverflowDropNewest)},
+			lines:   []string{"a", "b", "c", "d", "e"},
+			want:    []string{"a", "b", "c"},
+			dropped: 2,
+		},
+		{
+			name:    "max bytes",
+			opts:    []QueueOption{WithMaxBytes(5)},
+			lines:   []string{"aa", "bb", "cc"},
+			want:    []string{"bb", "cc"},
+			dropped: 1,
+		},
+		{
+			name:    "line larger than max bytes",
+			opts:    []QueueOption{WithMaxBytes(5), WithOverflowPolicy(OverflowBlock)},
+			lines:   []string{"a", "toolong", "b"},
+			want:    []string{"a", "b"},
+			dropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(tt.opts...)
+			if err := q.Enqueue(context.Background(), tt.lines...); err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+			if got := q.Dequeue(10); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Dequeue() = %v, want %v", got, tt.want)
+			}
+			if got := q.Dropped(); got != tt.dropped {
+				t.Errorf("Dropped() = %d, want %d", got, tt.dropped)
+			}
+			if q.Len() != 0 || q.Bytes() != 0 {
+				t.Errorf("Len() = %d, Bytes() = %d after Dequeue, want 0", q.Len(), q.Bytes())
+			}
+		})
+	}
+}
+
+func TestQueue_TryEnqueue(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		want   bool
+		queued []string
+	}{
+		{OverflowDropOldest, true, []string{"b", "c"}},
+		{OverflowDropNewest, false, []string{"a", "b"}},
+		{OverflowBlock, false, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			q := NewQueue(WithMaxLines(2), WithOverflowPolicy(tt.policy))
+			if !q.TryEnqueue("a", "b") {
+				t.Fatal("TryEnqueue() = false for lines that fit")
+			}
+			if got := q.TryEnqueue("c"); got != tt.want {
+				t.Errorf("TryEnqueue() = %v, want %v", got, tt.want)
+			}
+			if q.Dropped() != 1 {
+				t.Errorf("Dropped() = %d, want 1", q.Dropped())
+			}
+			if got := q.Dequeue(10); !reflect.DeepEqual(got, tt.queued) {
+				t.Errorf("Dequeue() = %v, want %v", got, tt.queued)
+			}
+		})
+	}
+}
+
+func TestQueue_Block(t *testing.T) {
+	q := NewQueue(WithMaxLines(1), WithOverflowPolicy(OverflowBlock))
+	if err := q.Enqueue(context.Background(), "a"); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Enqueue(ctx, "b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Enqueue() on full queue error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error)
+	go func() { done <- q.Enqueue(context.Background(), "c") }()
+	select {
+	case err := <-done:
+		t.Fatalf("Enqueue() returned %v before there was room", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if got := q.Dequeue(1); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("Dequeue() = %v", got)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	go func() { done <- q.Enqueue(context.Background(), "d") }()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Errorf("Enqueue() after Close() error = %v, want %v", err, ErrClosed)
+	}
+	// queued lines can still be taken
+	if got := q.Dequeue(1); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("Dequeue() after Close() = %v", got)
+	}
+	if q.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", q.Dropped())
+	}
+}
+
+func TestBatchExporter_BlockingQueue(t *testing.T) {
+	sender := newRecordingSender()
+	// the queue is smaller than a batch, so blocked producers have to trigger the sending
+	queue := NewQueue(WithMaxLines(3), WithOverflowPolicy(OverflowBlock))
+	e := NewBatchExporter(sender, WithQueue(queue), WithBatchSize(100), WithFlushInterval(time.Hour))
+	defer e.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Export(ctx, lines(10)...); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if err := e.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	sent := []string{}
+	for _, payload := range sender.getPayloads() {
+		sent = append(sent, payload...)
+	}
+	if !reflect.DeepEqual(sent, lines(10)) {
+		t.Errorf("sent %v, want %v", sent, lines(10))
+	}
+	if queue.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", queue.Dropped())
+	}
+}
+
+func TestBatchExporter_TryExport(t *testing.T) {
+	sender := newRecordingSender()
+	queue := NewQueue(WithMaxLines(2), WithOverflowPolicy(OverflowDropNewest))
+	e := NewBatchExporter(sender, WithQueue(queue), WithFlushInterval(time.Hour))
+
+	if !e.TryExport("a gauge,1", "b gauge,1") {
+		t.Error("TryExport() = false for lines that fit")
+	}
+	if e.TryExport("c gauge,1") {
+		t.Error("TryExport() = true for a full queue")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if e.TryExport("d gauge,1") {
+		t.Error("TryExport() = true after Close()")
+	}
+
+	if got, want := sender.getPayloads(), [][]string{{"a gauge,1", "b gauge,1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+	if queue.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", queue.Dropped())
+	}
+}
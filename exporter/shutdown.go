@@ -0,0 +1,88 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+)
+
+// Collector provides metrics, like the aggregated values of an aggregation.Aggregator.
+type Collector interface {
+	Collect() ([]*metric.Metric, error)
+}
+
+// Shutdowner is implemented by components that send their remaining data when they are shut down,
+// like BatchExporter and registry.Registry.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// ShutdownError is returned by Shutdown if not all data could be sent.
+type ShutdownError struct {
+	// Unsent holds the lines that were not sent.
+	Unsent []string
+	// Errs holds the reasons, e.g. failed payloads, the expired context and metrics that could not be collected.
+	Errs []error
+}
+
+func (e *ShutdownError) Error() string {
+	reasons := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		reasons = append(reasons, err.Error())
+	}
+	return fmt.Sprintf("shutdown incomplete, %d line(s) not sent: %s", len(e.Unsent), strings.Join(reasons, "; "))
+}
+
+// ShutdownOnSignal waits until the process receives SIGTERM or an interrupt, or until ctx is done, and then shuts
+// the components down in the given order, within timeout. Pass components that produce data before the ones that
+// send it, e.g. a registry.Registry before the BatchExporter it exports to. Returns the errors of all components.
+func ShutdownOnSignal(ctx context.Context, timeout time.Duration, components ...Shutdowner) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	return shutdownOn(ctx, signals, timeout, components...)
+}
+
+func shutdownOn(ctx context.Context, signals <-chan os.Signal, timeout time.Duration, components ...Shutdowner) error {
+	select {
+	case <-signals:
+	case <-ctx.Done():
+	}
+
+	// the shutdown gets its own deadline, as ctx may already be done.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	errs := []string{}
+	for _, c := range components {
+		if err := c.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("could not shut down %d component(s): %s", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestBatchExporter_Shutdown(t *testing.T) {
+	sender := newRecordingSender()
+	e := NewBatchExporter(sender, WithBatchSize(2), WithFlushInterval(time.Hour))
+
+	aggregator := aggregation.NewAggregator()
+	aggregator.AddCount("requests", dimensions.NewNormalizedDimensionList(), 3)
+	e.CollectOnShutdown(aggregator)
+
+	if err := e.Export(context.Background(), "a gauge,1"); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	want := [][]string{{"a gauge,1", "requests count,delta=3"}}
+	if got := sender.getPayloads(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+
+	if err := e.Export(context.Background(), "b gauge,1"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Export() after Shutdown() error = %v, want %v", err, ErrClosed)
+	}
+	if err := e.Shutdown(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("second Shutdown() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestBatchExporter_ShutdownSendError(t *testing.T) {
+	sender := newRecordingSender()
+	sender.setErr(errors.New("unavailable"))
+	e := NewBatchExporter(sender, WithBatchSize(2), WithFlushInterval(time.Hour))
+
+	if err := e.Export(context.Background(), lines(3)...); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	// wait for the full batch, which fails in the background
+	<-sender.sent
+
+	err := e.Shutdown(context.Background())
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("Shutdown() error = %v, want *ShutdownError", err)
+	}
+	// the full batch failed before the shutdown and was already reported to the error handler
+	if want := lines(3)[2:]; !reflect.DeepEqual(shutdownErr.Unsent, want) {
+		t.Errorf("Unsent = %v, want %v", shutdownErr.Unsent, want)
+	}
+	if !strings.Contains(err.Error(), "1 line(s) not sent: could not send 1 line(s): unavailable") {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
+
+func TestBatchExporter_ShutdownDeadline(t *testing.T) {
+	sender := newRecordingSender()
+	e := NewBatchExporter(sender, WithFlushInterval(time.Hour))
+
+	if err := e.Export(context.Background(), lines(2)...); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := e.Shutdown(ctx)
+
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("Shutdown() error = %v, want *ShutdownError", err)
+	}
+	if !reflect.DeepEqual(shutdownErr.Unsent, lines(2)) {
+		t.Errorf("Unsent = %v, want %v", shutdownErr.Unsent, lines(2))
+	}
+	if len(shutdownErr.Errs) != 1 || !errors.Is(shutdownErr.Errs[0], context.Canceled) {
+		t.Errorf("Errs = %v, want %v", shutdownErr.Errs, context.Canceled)
+	}
+	if got := sender.getPayloads(); len(got) != 0 {
+		t.Errorf("sent %v after the deadline", got)
+	}
+}
+
+// recordingShutdowner records the order of the shutdowns in calls.
+type recordingShutdowner struct {
+	name  string
+	calls *[]string
+	err   error
+}
+
+func (s recordingShutdowner) Shutdown(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("no deadline")
+	}
+	*s.calls = append(*s.calls, s.name)
+	return s.err
+}
+
+func TestShutdownOn(t *testing.T) {
+	calls := []string{}
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+
+	err := shutdownOn(context.Background(), signals, time.Second,
+		recordingShutdowner{name: "registry", calls: &calls},
+		recordingShutdowner{name: "exporter", calls: &calls, err: errors.New("lines lost")},
+	)
+	if err == nil || !strings.Contains(err.Error(), "could not shut down 1 component(s): lines lost") {
+		t.Errorf("shutdownOn() error = %v", err)
+	}
+	if want := []string{"registry", "exporter"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("shutdown order = %v, want %v", calls, want)
+	}
+}
+
+func TestShutdownOnSignal_ContextDone(t *testing.T) {
+	calls := []string{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := ShutdownOnSignal(ctx, time.Second, recordingShutdowner{name: "exporter", calls: &calls}); err != nil {
+		t.Errorf("ShutdownOnSignal() error = %v", err)
+	}
+	if want := []string{"exporter"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("shutdown order = %v, want %v", calls, want)
+	}
+}
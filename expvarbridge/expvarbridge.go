@@ -0,0 +1,242 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expvarbridge converts variables published with the expvar package to Dynatrace metrics.
+package expvarbridge
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/normalize"
+)
+
+type kind int
+
+const (
+	kindGauge kind = iota
+	kindCounter
+)
+
+// Option represents the function interface used to configure the Bridge.
+type Option func(b *Bridge)
+
+// WithPrefix sets a prefix that is prepended to all metric keys.
+func WithPrefix(prefix string) Option {
+	return func(b *Bridge) {
+		b.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(b *Bridge) {
+		b.defaultDimensions = dims
+	}
+}
+
+// WithCounters registers variables as cumulative counters, which are exported as deltas.
+// See Bridge for how names are matched.
+func WithCounters(names ...string) Option {
+	return func(b *Bridge) {
+		for _, name := range names {
+			b.kinds[name] = kindCounter
+		}
+	}
+}
+
+// WithGauges registers variables as gauges, which are exported as they are. See Bridge for how names are matched.
+func WithGauges(names ...string) Option {
+	return func(b *Bridge) {
+		for _, name := range names {
+			b.kinds[name] = kindGauge
+		}
+	}
+}
+
+// Bridge walks all published expvar variables and converts the numeric ones to metrics.
+// Nested values, like the entries of an expvar.Map or the fields of an expvar.Func returning a struct, are flattened
+// to dotted keys, e.g. "requests.GET". Only registered variables are exported. A registered name matches the
+// flattened key itself and all keys nested below it, and the longest matching name decides whether a value is a
+// counter or a gauge. For example, WithGauges("memstats") exports all fields of the memstats variable, and
+// WithCounters("memstats.NumGC") additionally marks one of them as counter.
+// Counters are only exported from the second Collect on, since their first value does not produce a delta.
+// It is safe for concurrent use.
+type Bridge struct {
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	kinds             map[string]kind
+	tracker           *aggregation.CumulativeTracker
+}
+
+// NewBridge creates a Bridge.
+func NewBridge(opts ...Option) *Bridge {
+	b := &Bridge{
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		kinds:             map[string]kind{},
+		tracker:           aggregation.NewCumulativeTracker(),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// kindOf returns the kind of the longest registered name that matches key.
+func (b *Bridge) kindOf(key string) (kind, bool) {
+	for name := key; ; {
+		if k, ok := b.kinds[name]; ok {
+			return k, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return 0, false
+		}
+		name = name[:i]
+	}
+}
+
+type value struct {
+	key      string
+	intValue int64
+	float    float64
+	isFloat  bool
+}
+
+// flatten appends the numeric values of v to values. Strings, booleans and arrays are skipped.
+func flatten(key string, v interface{}, values []value) []value {
+	switch typed := v.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(typed.String(), 10, 64); err == nil {
+			return append(values, value{key: key, intValue: i})
+		}
+		if f, err := typed.Float64(); err == nil {
+			return append(values, value{key: key, float: f, isFloat: true})
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for k := range typed {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values = flatten(key+"."+k, typed[k], values)
+		}
+	}
+	return values
+}
+
+func flattenVar(key string, v expvar.Var, values []value) []value {
+	switch typed := v.(type) {
+	case *expvar.Int:
+		return append(values, value{key: key, intValue: typed.Value()})
+	case *expvar.Float:
+		return append(values, value{key: key, float: typed.Value(), isFloat: true})
+	case *expvar.Map:
+		typed.Do(func(kv expvar.KeyValue) {
+			values = flattenVar(key+"."+kv.Key, kv.Value, values)
+		})
+		return values
+	case *expvar.String:
+		return values
+	}
+
+	// all other variables, like expvar.Func, are only known by their JSON representation.
+	decoder := json.NewDecoder(strings.NewReader(v.String()))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return values
+	}
+	return flatten(key, decoded, values)
+}
+
+// Collect walks all published variables and returns the registered ones as metrics.
+// Keys that cannot be normalized to a valid metric key are skipped and reported in the returned error.
+func (b *Bridge) Collect() ([]*metric.Metric, error) {
+	values := []value{}
+	expvar.Do(func(kv expvar.KeyValue) {
+		if _, ok := b.kindOf(kv.Key); !ok && !b.hasRegisteredChild(kv.Key) {
+			return
+		}
+		values = flattenVar(kv.Key, kv.Value, values)
+	})
+
+	result := make([]*metric.Metric, 0, len(values))
+	errs := []string{}
+	for _, v := range values {
+		k, ok := b.kindOf(v.key)
+		if !ok {
+			continue
+		}
+
+		key, err := normalize.MetricKey(v.key)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("'%s': %v", v.key, err))
+			continue
+		}
+
+		var option metric.MetricOption
+		switch {
+		case k == kindGauge && v.isFloat:
+			option = metric.WithFloatGaugeValue(v.float)
+		case k == kindGauge:
+			option = metric.WithIntGaugeValue(v.intValue)
+		case v.isFloat:
+			delta, ok := b.tracker.FloatDelta(v.key, v.float)
+			if !ok {
+				continue
+			}
+			option = metric.WithFloatCounterValueDelta(delta)
+		default:
+			delta, ok := b.tracker.IntDelta(v.key, v.intValue)
+			if !ok {
+				continue
+			}
+			option = metric.WithIntCounterValueDelta(delta)
+		}
+
+		m, err := metric.NewMetric(key, metric.WithPrefix(b.prefix), metric.WithDimensions(b.defaultDimensions), option)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("'%s': %v", v.key, err))
+			continue
+		}
+		result = append(result, m)
+	}
+	b.tracker.Sweep()
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("could not convert %d variable(s): %s", len(errs), strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// hasRegisteredChild returns true if a name below the top-level variable name is registered.
+func (b *Bridge) hasRegisteredChild(name string) bool {
+	for registered := range b.kinds {
+		if strings.HasPrefix(registered, name+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expvarbridge
+
+import (
+	"expvar"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// expvar variables are global and cannot be unpublished, so every test uses its own names.
+var (
+	bridgeRequests   = expvar.NewInt("bridgetest_requests")
+	bridgeQueue      = expvar.NewFloat("bridgetest_queue")
+	bridgeByMethod   = expvar.NewMap("bridgetest_by_method")
+	bridgeNested     = expvar.NewMap("bridgetest_nested")
+	bridgeName       = expvar.NewString("bridgetest_name")
+	bridgeUnselected = expvar.NewInt("bridgetest_unselected")
+)
+
+func init() {
+	expvar.Publish("bridgetest_func", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"open":   3,
+			"ratio":  0.5,
+			"label":  "skipped",
+			"inner":  map[string]interface{}{"size": 7},
+			"values": []int{1, 2},
+		}
+	}))
+
+	inner := new(expvar.Map).Init()
+	inner.Add("hits", 2)
+	bridgeNested.Set("cache", inner)
+}
+
+func TestBridge_Collect(t *testing.T) {
+	bridgeRequests.Set(10)
+	bridgeQueue.Set(2.5)
+	bridgeByMethod.Add("GET", 4)
+	bridgeByMethod.Add("POST", 1)
+	bridgeName.Set("ignored")
+	bridgeUnselected.Set(1)
+
+	b := NewBridge(
+		WithPrefix("app"),
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("service", "test"))),
+		WithCounters("bridgetest_requests", "bridgetest_by_method", "bridgetest_nested.cache.hits"),
+		WithGauges("bridgetest_queue", "bridgetest_func", "bridgetest_name"),
+	)
+
+	metrics, err := b.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	// counters are not exported in the first collection
+	want := []string{
+		"app.bridgetest_func.inner.size,service=test gauge,7",
+		"app.bridgetest_func.open,service=test gauge,3",
+		"app.bridgetest_func.ratio,service=test gauge,0.5",
+		"app.bridgetest_queue,service=test gauge,2.5",
+	}
+	if got := linetest.Serialize(t, metrics); !reflect.DeepEqual(got, want) {
+		t.Errorf("first Collect() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	bridgeRequests.Add(5)
+	bridgeByMethod.Add("GET", 2)
+	bridgeByMethod.Add("DELETE", 1)
+
+	metrics, err = b.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	want = []string{
+		"app.bridgetest_by_method.GET,service=test count,delta=2",
+		"app.bridgetest_by_method.POST,service=test count,delta=0",
+		"app.bridgetest_func.inner.size,service=test gauge,7",
+		"app.bridgetest_func.open,service=test gauge,3",
+		"app.bridgetest_func.ratio,service=test gauge,0.5",
+		"app.bridgetest_nested.cache.hits,service=test count,delta=0",
+		"app.bridgetest_queue,service=test gauge,2.5",
+		"app.bridgetest_requests,service=test count,delta=5",
+	}
+	if got := linetest.Serialize(t, metrics); !reflect.DeepEqual(got, want) {
+		t.Errorf("second Collect() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestBridge_LongestMatchWins(t *testing.T) {
+	b := NewBridge(WithGauges("memstats"), WithCounters("memstats.NumGC"))
+
+	tests := []struct {
+		key    string
+		want   kind
+		wantOk bool
+	}{
+		{key: "memstats", want: kindGauge, wantOk: true},
+		{key: "memstats.HeapAlloc", want: kindGauge, wantOk: true},
+		{key: "memstats.NumGC", want: kindCounter, wantOk: true},
+		{key: "memstatsX", wantOk: false},
+		{key: "cmdline", wantOk: false},
+	}
+	for _, tt := range tests {
+		got, ok := b.kindOf(tt.key)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("kindOf(%q) = (%v, %v), want (%v, %v)", tt.key, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestBridge_Memstats(t *testing.T) {
+	b := NewBridge(WithGauges("memstats.HeapAlloc"), WithCounters("memstats.NumGC"))
+
+	metrics, err := b.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := linetest.Serialize(t, metrics)
+	if len(got) != 1 || !strings.HasPrefix(got[0], "memstats.HeapAlloc gauge,") {
+		t.Errorf("Collect() = %v, want only memstats.HeapAlloc", got)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/normalize"
+)
+
+// Option represents the function interface used to configure the Converter.
+type Option func(c *Converter)
+
+// WithPrefix sets a prefix that is prepended to all metric keys.
+func WithPrefix(prefix string) Option {
+	return func(c *Converter) {
+		c.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics. Tags and template dimensions with the same
+// (normalized) key overwrite the default dimensions.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(c *Converter) {
+		c.defaultDimensions = dims
+	}
+}
+
+// WithTemplates sets templates that extract dimensions from the metric path. The first matching template is applied.
+func WithTemplates(templates ...Template) Option {
+	return func(c *Converter) {
+		c.templates = templates
+	}
+}
+
+// Converter converts Graphite samples to gauges. It is safe for concurrent use.
+type Converter struct {
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	templates         []Template
+}
+
+// NewConverter creates a new Converter.
+func NewConverter(opts ...Option) *Converter {
+	c := &Converter{defaultDimensions: dimensions.NewNormalizedDimensionList()}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// ConvertSample converts a sample to a gauge. The path is normalized with normalize.MetricKey after applying the
+// templates. Tags overwrite dimensions extracted by templates.
+func (c *Converter) ConvertSample(s Sample) (*metric.Metric, error) {
+	path := s.Path
+	var templateDims []dimensions.Dimension
+	for _, t := range c.templates {
+		if p, dims, ok := t.Apply(path); ok {
+			path, templateDims = p, dims
+			break
+		}
+	}
+
+	key, err := normalize.MetricKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []metric.MetricOption{
+		metric.WithPrefix(c.prefix),
+		metric.WithDimensions(dimensions.MergeLists(
+			c.defaultDimensions,
+			dimensions.NewNormalizedDimensionList(templateDims...),
+			dimensions.NewNormalizedDimensionList(s.Tags...),
+		)),
+		metric.WithFloatGaugeValue(s.Value),
+	}
+	if !s.Timestamp.IsZero() {
+		opts = append(opts, metric.WithTimestamp(s.Timestamp))
+	}
+
+	return metric.NewMetric(key, opts...)
+}
+
+// ConvertLine parses and converts a single line.
+func (c *Converter) ConvertLine(line string) (*metric.Metric, error) {
+	s, err := ParseLine(line)
+	if err != nil {
+		return nil, err
+	}
+	return c.ConvertSample(s)
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestConverter_ConvertLine(t *testing.T) {
+	tmpl, err := NewTemplate("servers.*.cpu", "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewConverter(
+		WithPrefix("graphite"),
+		WithTemplates(tmpl),
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("env", "test"))),
+	)
+
+	tests := []struct {
+		line    string
+		want    string
+		wantErr bool
+	}{
+		{line: "a.b.c 42 1700000000", want: "graphite.a.b.c,env=test gauge,42 1700000000000"},
+		{line: "servers.web01.cpu 0.5", want: "graphite.servers.cpu,env=test,host=web01 gauge,0.5"},
+		// tags overwrite template dimensions
+		{line: "servers.web01.cpu;host=other;env=prod 1", want: "graphite.servers.cpu,env=prod,host=other gauge,1"},
+		{line: "my-app.request count 5", wantErr: true},
+		// the path is normalized on its own, before the prefix is added
+		{line: "1st.metric 5", want: "graphite._st.metric,env=test gauge,5"},
+		{line: "a$b.c%d 1", want: "graphite.a_b.c_d,env=test gauge,1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			m, err := c.ConvertLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConvertLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			line, err := m.Serialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := linetest.Canonical(line); got != linetest.Canonical(tt.want) {
+				t.Errorf("ConvertLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConverter_InvalidKey(t *testing.T) {
+	if _, err := NewConverter().ConvertLine("... 1"); err == nil {
+		t.Error("ConvertLine() expected error for path without valid key")
+	}
+}
+
+func TestConverter_NoTemplateMatch(t *testing.T) {
+	tmpl, _ := NewTemplate("servers.*", "host")
+	m, err := NewConverter(WithTemplates(tmpl)).ConvertLine("apps.web.requests 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := linetest.Serialize(t, []*metric.Metric{m})
+	if !reflect.DeepEqual(got, []string{"apps.web.requests gauge,3"}) {
+		t.Errorf("ConvertLine() = %v", got)
+	}
+}
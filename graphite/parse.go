@@ -0,0 +1,91 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphite converts the Graphite plaintext protocol to Dynatrace metrics and provides a TCP listener for it.
+package graphite
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// Sample is a single parsed line.
+type Sample struct {
+	// Path is the dotted metric path, without tags.
+	Path string
+	// Tags are the tags of a tagged series ("path;tag=value").
+	Tags  []dimensions.Dimension
+	Value float64
+	// Timestamp is zero if the line has no timestamp, or if the timestamp is -1.
+	Timestamp time.Time
+}
+
+// ParseError is returned if a line is not valid plaintext protocol.
+type ParseError struct {
+	Line string
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid graphite line '%s': %s", e.Line, e.Msg)
+}
+
+// ParseLine parses a line of the form "<path>[;<tag>=<value>...] <value> [<timestamp>]".
+// Timestamps are seconds since the epoch and may have a fractional part.
+func ParseLine(line string) (Sample, error) {
+	fail := func(msg string) (Sample, error) {
+		return Sample{}, &ParseError{Line: line, Msg: msg}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return fail("expected path, value and optional timestamp")
+	}
+
+	s := Sample{}
+	pathAndTags := strings.Split(fields[0], ";")
+	s.Path = pathAndTags[0]
+	if s.Path == "" {
+		return fail("empty path")
+	}
+	for _, tag := range pathAndTags[1:] {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fail(fmt.Sprintf("invalid tag '%s'", tag))
+		}
+		s.Tags = append(s.Tags, dimensions.NewDimension(kv[0], kv[1]))
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return fail(fmt.Sprintf("invalid value '%s'", fields[1]))
+	}
+	s.Value = value
+
+	if len(fields) == 3 && fields[2] != "-1" {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || ts < 0 || math.IsInf(ts, 0) {
+			return fail(fmt.Sprintf("invalid timestamp '%s'", fields[2]))
+		}
+		sec, frac := math.Modf(ts)
+		s.Timestamp = time.Unix(int64(sec), int64(frac*1e9))
+	}
+
+	return s, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{
+			name: "with timestamp",
+			line: "servers.web01.cpu 42 1700000000",
+			want: Sample{Path: "servers.web01.cpu", Value: 42, Timestamp: time.Unix(1700000000, 0)},
+		},
+		{
+			name: "fractional timestamp",
+			line: "a.b 1.5 1700000000.25",
+			want: Sample{Path: "a.b", Value: 1.5, Timestamp: time.Unix(1700000000, 250_000_000)},
+		},
+		{name: "without timestamp", line: "a.b -3", want: Sample{Path: "a.b", Value: -3}},
+		{name: "timestamp -1", line: "a.b 3 -1", want: Sample{Path: "a.b", Value: 3}},
+		{
+			name: "tagged",
+			line: "disk.used;datacenter=dc1;server=web01 0.5 1700000000",
+			want: Sample{
+				Path:      "disk.used",
+				Tags:      []dimensions.Dimension{dimensions.NewDimension("datacenter", "dc1"), dimensions.NewDimension("server", "web01")},
+				Value:     0.5,
+				Timestamp: time.Unix(1700000000, 0),
+			},
+		},
+		{name: "missing value", line: "a.b", wantErr: true},
+		{name: "too many fields", line: "a.b 1 2 3", wantErr: true},
+		{name: "invalid value", line: "a.b x", wantErr: true},
+		{name: "invalid timestamp", line: "a.b 1 x", wantErr: true},
+		{name: "invalid tag", line: "a.b;tag 1", wantErr: true},
+		{name: "empty path", line: ";tag=v 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("ParseLine() timestamp = %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp, tt.want.Timestamp = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/exporter"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
+)
+
+const defaultIdleTimeout = 5 * time.Minute
+
+// ServerOption represents the function interface used to configure the Server.
+type ServerOption func(s *Server)
+
+// WithIdleTimeout sets the time after which connections without data are closed. Defaults to five minutes.
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithErrorHandler sets a function that is called with errors that occur while receiving lines.
+// By default, errors are logged.
+func WithErrorHandler(handler func(error)) ServerOption {
+	return func(s *Server) {
+		s.errorHandler = handler
+	}
+}
+
+// Server accepts Graphite plaintext connections, converts every line, and forwards it to an exporter.LineExporter.
+type Server struct {
+	converter    *Converter
+	exporter     exporter.LineExporter
+	idleTimeout  time.Duration
+	errorHandler func(error)
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// NewServer creates a Server that converts lines with converter and exports them to exporter.
+func NewServer(converter *Converter, exp exporter.LineExporter, opts ...ServerOption) *Server {
+	s := &Server{
+		converter:   converter,
+		exporter:    exp,
+		idleTimeout: defaultIdleTimeout,
+		errorHandler: func(err error) {
+			logging.GetLogger().Errorf("Graphite error: %v", err)
+		},
+		conns: map[net.Conn]struct{}{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *Server) handleError(err error) {
+	if err != nil && s.errorHandler != nil {
+		s.errorHandler(err)
+	}
+}
+
+// Serve accepts connections on listener until ctx is done. The listener and all open connections are closed when
+// ctx is done, and Serve waits for all connections to finish before returning the context error.
+// A Server cannot be reused after Serve returned.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		listener.Close()
+		s.closeConns()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.closeConns()
+			s.wg.Wait()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(ctx, conn)
+		}()
+	}
+}
+
+// ListenAndServe listens on the TCP address addr, e.g. ":2003", and calls Serve.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closing = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for {
+		if s.idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		s.handleError(s.handleLine(ctx, line))
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		s.handleError(fmt.Errorf("connection from %s: %w", conn.RemoteAddr(), err))
+	}
+}
+
+func (s *Server) handleLine(ctx context.Context, line string) error {
+	m, err := s.converter.ConvertLine(line)
+	if err != nil {
+		return err
+	}
+
+	serialized, err := m.Serialize()
+	if err != nil {
+		return err
+	}
+	return s.exporter.Export(ctx, serialized)
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+)
+
+type fakeExporter struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (e *fakeExporter) Export(ctx context.Context, lines ...string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lines = append(e.lines, lines...)
+	return nil
+}
+
+func (e *fakeExporter) len() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.lines)
+}
+
+func TestServer_Serve(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &fakeExporter{}
+	var (
+		errsMu sync.Mutex
+		errs   []error
+	)
+	s := NewServer(NewConverter(), exp, WithErrorHandler(func(err error) {
+		errsMu.Lock()
+		defer errsMu.Unlock()
+		errs = append(errs, err)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Serve(ctx, listener) }()
+
+	// two concurrent connections
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "app.requests;conn=%d 1 1700000000\n\ninvalid\napp.latency;conn=%d 12.5 1700000000\n", i, i)
+		conn.Close()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for exp.len() < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Serve() error = %v, want %v", err, context.Canceled)
+	}
+
+	want := linetest.CanonicalLines([]string{
+		"app.requests,conn=0 gauge,1 1700000000000",
+		"app.latency,conn=0 gauge,12.5 1700000000000",
+		"app.requests,conn=1 gauge,1 1700000000000",
+		"app.latency,conn=1 gauge,12.5 1700000000000",
+	})
+	if got := linetest.CanonicalLines(exp.lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("exported = %v, want %v", got, want)
+	}
+
+	errsMu.Lock()
+	defer errsMu.Unlock()
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "invalid") {
+		t.Errorf("errors = %v, want one error per invalid line", errs)
+	}
+}
+
+func TestServer_ClosesOpenConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(NewConverter(), &fakeExporter{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Serve(ctx, listener) }()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "a.b 1\n")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return while a connection was open")
+	}
+}
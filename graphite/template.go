@@ -0,0 +1,86 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// Template extracts dimensions from the segments of a metric path.
+type Template struct {
+	pattern []string
+	keys    []string
+}
+
+// NewTemplate creates a Template from a dotted pattern, in which "*" matches any single segment.
+// The segments matched by the wildcards are assigned to the dimension keys in order, and are removed from the metric
+// path. A key of "" keeps the segment in the path instead. For example, NewTemplate("servers.*.cpu", "host") turns
+// "servers.web01.cpu.user" into "servers.cpu.user" with the dimension host=web01.
+// A pattern matches all paths that start with it. Returns an error if the number of keys does not match the
+// number of wildcards.
+func NewTemplate(pattern string, keys ...string) (Template, error) {
+	segments := strings.Split(pattern, ".")
+	wildcards := 0
+	for _, s := range segments {
+		if s == "" {
+			return Template{}, fmt.Errorf("template '%s' contains an empty segment", pattern)
+		}
+		if s == "*" {
+			wildcards++
+		}
+	}
+	if wildcards != len(keys) {
+		return Template{}, fmt.Errorf("template '%s' has %d wildcard(s), but %d dimension key(s)", pattern, wildcards, len(keys))
+	}
+
+	return Template{pattern: segments, keys: keys}, nil
+}
+
+// Apply returns the path without the extracted segments and the extracted dimensions.
+// ok is false if the template does not match the path.
+func (t Template) Apply(path string) (newPath string, dims []dimensions.Dimension, ok bool) {
+	segments := strings.Split(path, ".")
+	if len(segments) < len(t.pattern) {
+		return path, nil, false
+	}
+
+	for i, p := range t.pattern {
+		if p != "*" && p != segments[i] {
+			return path, nil, false
+		}
+	}
+
+	kept := make([]string, 0, len(segments))
+	wildcard := 0
+	for i, s := range segments {
+		if i >= len(t.pattern) || t.pattern[i] != "*" {
+			kept = append(kept, s)
+			continue
+		}
+
+		key := t.keys[wildcard]
+		wildcard++
+		if key == "" {
+			kept = append(kept, s)
+			continue
+		}
+		dims = append(dims, dimensions.NewDimension(key, s))
+	}
+
+	return strings.Join(kept, "."), dims, true
+}
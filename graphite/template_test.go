@@ -0,0 +1,86 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestTemplate_Apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		keys     []string
+		path     string
+		wantPath string
+		wantDims []dimensions.Dimension
+		wantOk   bool
+	}{
+		{
+			name:     "extracts segment",
+			pattern:  "servers.*.cpu",
+			keys:     []string{"host"},
+			path:     "servers.web01.cpu",
+			wantPath: "servers.cpu",
+			wantDims: []dimensions.Dimension{dimensions.NewDimension("host", "web01")},
+			wantOk:   true,
+		},
+		{
+			name:     "matches prefix",
+			pattern:  "servers.*",
+			keys:     []string{"host"},
+			path:     "servers.web01.cpu.user",
+			wantPath: "servers.cpu.user",
+			wantDims: []dimensions.Dimension{dimensions.NewDimension("host", "web01")},
+			wantOk:   true,
+		},
+		{
+			name:     "keeps segments without key",
+			pattern:  "*.*.*",
+			keys:     []string{"dc", "", "host"},
+			path:     "dc1.app.web01.requests",
+			wantPath: "app.requests",
+			wantDims: []dimensions.Dimension{dimensions.NewDimension("dc", "dc1"), dimensions.NewDimension("host", "web01")},
+			wantOk:   true,
+		},
+		{name: "different segment", pattern: "servers.*.cpu", keys: []string{"host"}, path: "servers.web01.mem", wantPath: "servers.web01.mem"},
+		{name: "path too short", pattern: "servers.*.cpu", keys: []string{"host"}, path: "servers.web01", wantPath: "servers.web01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := NewTemplate(tt.pattern, tt.keys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, dims, ok := tmpl.Apply(tt.path)
+			if path != tt.wantPath || !reflect.DeepEqual(dims, tt.wantDims) || ok != tt.wantOk {
+				t.Errorf("Apply() = (%q, %v, %v), want (%q, %v, %v)", path, dims, ok, tt.wantPath, tt.wantDims, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestNewTemplate_Invalid(t *testing.T) {
+	if _, err := NewTemplate("servers.*.cpu"); err == nil {
+		t.Error("NewTemplate() expected error for missing key")
+	}
+	if _, err := NewTemplate("servers..cpu"); err == nil {
+		t.Error("NewTemplate() expected error for empty segment")
+	}
+}
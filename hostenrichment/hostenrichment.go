@@ -0,0 +1,204 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostenrichment
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// Dimension keys set by this package.
+const (
+	HostNameDimension    = "host.name"
+	OSTypeDimension      = "os.type"
+	HostArchDimension    = "host.arch"
+	ContainerIDDimension = "container.id"
+)
+
+const defaultProcDir = "proc/self"
+
+var (
+	// matches the last segment of a cgroup path, e.g. "docker-<id>.scope", "cri-containerd-<id>.scope",
+	// "crio-<id>.scope", "libpod-<id>.scope" or just "<id>". conmon scopes of cri-o are not matched on purpose.
+	reCgroupContainerID = regexp.MustCompile(`^(?:docker-|cri-containerd-|crio-|libpod-)?([0-9a-f]{64})(?:\.scope)?$`)
+	// matches the container directories of docker (/var/lib/docker/containers/<id>/) and
+	// cri-o or podman (/var/lib/containers/storage/overlay-containers/<id>/) in mount sources.
+	reMountinfoContainerID = regexp.MustCompile(`/(?:containers|overlay-containers)/([0-9a-f]{64})/`)
+)
+
+// Option represents the function interface used to configure how host metadata is read.
+type Option func(c *config)
+
+type config struct {
+	procDir  string
+	hostname func() (string, error)
+	goos     string
+	goarch   string
+}
+
+// WithProcDir sets the directory that contains the "cgroup" and "mountinfo" files of the current process,
+// relative to the root of the file system. Defaults to "proc/self".
+func WithProcDir(dir string) Option {
+	return func(c *config) {
+		c.procDir = dir
+	}
+}
+
+// WithHostnameFunc sets the function used to get the host name. Defaults to os.Hostname.
+func WithHostnameFunc(hostname func() (string, error)) Option {
+	return func(c *config) {
+		c.hostname = hostname
+	}
+}
+
+// WithPlatform overrides the operating system and architecture, which default to runtime.GOOS and runtime.GOARCH.
+func WithPlatform(goos, goarch string) Option {
+	return func(c *config) {
+		c.goos = goos
+		c.goarch = goarch
+	}
+}
+
+// GetHostMetadataFrom returns the host name, operating system, architecture and, if the process is running in a
+// container, the container ID as NormalizedDimensionList. The container ID is read from the cgroup and mountinfo
+// files in fsys. Missing files are not treated as errors, as they only exist on Linux.
+// If the host name or the files cannot be read, all other dimensions are returned together with the error.
+func GetHostMetadataFrom(fsys fs.FS, opts ...Option) (dimensions.NormalizedDimensionList, error) {
+	c := config{
+		procDir:  defaultProcDir,
+		hostname: os.Hostname,
+		goos:     runtime.GOOS,
+		goarch:   runtime.GOARCH,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	dims := []dimensions.Dimension{}
+	var errs []string
+
+	hostname, err := c.hostname()
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("could not read host name: %v", err))
+	} else if hostname != "" {
+		dims = append(dims, dimensions.NewDimension(HostNameDimension, hostname))
+	}
+
+	if c.goos != "" {
+		dims = append(dims, dimensions.NewDimension(OSTypeDimension, c.goos))
+	}
+	if c.goarch != "" {
+		dims = append(dims, dimensions.NewDimension(HostArchDimension, c.goarch))
+	}
+
+	containerID, err := readContainerID(fsys, c.procDir)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("could not read container ID: %v", err))
+	} else if containerID != "" {
+		dims = append(dims, dimensions.NewDimension(ContainerIDDimension, containerID))
+	}
+
+	list := dimensions.NewNormalizedDimensionList(dims...)
+	if len(errs) > 0 {
+		return list, errors.New(strings.Join(errs, "; "))
+	}
+	return list, nil
+}
+
+// GetHostMetadata returns the host name, operating system, architecture and container ID as NormalizedDimensionList.
+func GetHostMetadata(opts ...Option) dimensions.NormalizedDimensionList {
+	dims, err := GetHostMetadataFrom(os.DirFS("/"), opts...)
+	if err != nil {
+		logging.GetLogger().Warnf("Could not read all host metadata: %v", err)
+	}
+
+	return dims
+}
+
+// readContainerID tries to find the container ID in the cgroup file first, and falls back to the mountinfo file,
+// which is required for cgroup v2 with private cgroup namespaces. Returns an empty string if no ID is found.
+func readContainerID(fsys fs.FS, procDir string) (string, error) {
+	id, err := parseFile(fsys, path.Join(procDir, "cgroup"), containerIDFromCgroup)
+	if err != nil || id != "" {
+		return id, err
+	}
+
+	return parseFile(fsys, path.Join(procDir, "mountinfo"), containerIDFromMountinfo)
+}
+
+func parseFile(fsys fs.FS, name string, parse func(io.Reader) (string, error)) (string, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer file.Close()
+
+	return parse(file)
+}
+
+// containerIDFromCgroup reads a /proc/<pid>/cgroup file, in which every line has the format
+// "hierarchy-ID:controller-list:cgroup-path". The segments of each path are checked starting with the last one.
+func containerIDFromCgroup(reader io.Reader) (string, error) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		split := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 3)
+		if len(split) != 3 {
+			continue
+		}
+
+		segments := strings.Split(split[2], "/")
+		for i := len(segments) - 1; i >= 0; i-- {
+			if match := reCgroupContainerID.FindStringSubmatch(segments[i]); match != nil {
+				return match[1], nil
+			}
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+// containerIDFromMountinfo reads a /proc/<pid>/mountinfo file and looks for container directories
+// in the root of each mount (the fourth field). The last match is used, since mounts that are shared with the
+// pod sandbox (e.g. /etc/resolv.conf for cri-o) come before the mounts specific to the container.
+func containerIDFromMountinfo(reader io.Reader) (string, error) {
+	id := ""
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		if match := reMountinfoContainerID.FindStringSubmatch(fields[3]); match != nil {
+			id = match[1]
+		}
+	}
+
+	return id, scanner.Err()
+}
@@ -0,0 +1,174 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostenrichment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+const (
+	dockerID     = "4c8ab61d2b2d1ad3f6a7b1d9e0f3c8e5a2b4d6f8091a3c5e7f9b1d3f5a7c9e1b"
+	containerdID = "9f3e1a7c5b2d4f6e8a0c1b3d5f7e9a2c4b6d8f0e1a3c5b7d9f2e4a6c8b0d1f3e"
+	crioID       = "2b7d4f9a1c6e8b3d5f0a2c4e6b8d1f3a5c7e9b0d2f4a6c8e1b3d5f7a9c0e2b4d"
+)
+
+func Test_readContainerID(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    string
+	}{
+		{name: "docker cgroup v1", fixture: "docker_v1", want: dockerID},
+		{name: "docker cgroup v2", fixture: "docker_v2", want: dockerID},
+		{name: "containerd cgroup v1", fixture: "containerd_v1", want: containerdID},
+		{name: "containerd cgroup v2", fixture: "containerd_v2", want: containerdID},
+		{name: "cri-o cgroup v1", fixture: "crio_v1", want: crioID},
+		{name: "cri-o cgroup v2", fixture: "crio_v2", want: crioID},
+		{name: "not in a container", fixture: "host", want: ""},
+		{name: "files missing", fixture: "does_not_exist", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readContainerID(os.DirFS(filepath.Join("testdata", tt.fixture)), defaultProcDir)
+			if err != nil {
+				t.Fatalf("readContainerID() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("readContainerID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_containerIDFromCgroup(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "docker with systemd cgroup driver",
+			input: "0::/system.slice/docker-" + dockerID + ".scope",
+			want:  dockerID,
+		},
+		{
+			name:  "podman",
+			input: "0::/machine.slice/libpod-" + crioID + ".scope/container",
+			want:  crioID,
+		},
+		{
+			name:  "cri-o conmon is ignored",
+			input: "0::/kubepods.slice/crio-conmon-" + crioID + ".scope",
+			want:  "",
+		},
+		{
+			name:  "too short",
+			input: "0::/docker/4c8ab61d2b2d",
+			want:  "",
+		},
+		{
+			name:  "malformed lines",
+			input: "garbage\n\n0:/docker/" + dockerID,
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := containerIDFromCgroup(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("containerIDFromCgroup() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("containerIDFromCgroup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHostMetadataFrom(t *testing.T) {
+	hostname := func() (string, error) { return "my-host", nil }
+
+	tests := []struct {
+		name    string
+		fixture string
+		opts    []Option
+		want    dimensions.NormalizedDimensionList
+		wantErr bool
+	}{
+		{
+			name:    "in container",
+			fixture: "docker_v1",
+			opts:    []Option{WithHostnameFunc(hostname), WithPlatform("linux", "amd64")},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(HostNameDimension, "my-host"),
+				dimensions.NewDimension(OSTypeDimension, "linux"),
+				dimensions.NewDimension(HostArchDimension, "amd64"),
+				dimensions.NewDimension(ContainerIDDimension, dockerID),
+			),
+		},
+		{
+			name:    "not in container",
+			fixture: "host",
+			opts:    []Option{WithHostnameFunc(hostname), WithPlatform("windows", "arm64")},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(HostNameDimension, "my-host"),
+				dimensions.NewDimension(OSTypeDimension, "windows"),
+				dimensions.NewDimension(HostArchDimension, "arm64"),
+			),
+		},
+		{
+			name:    "custom proc dir",
+			fixture: "crio_v1/proc",
+			opts:    []Option{WithHostnameFunc(hostname), WithPlatform("linux", "amd64"), WithProcDir("self")},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(HostNameDimension, "my-host"),
+				dimensions.NewDimension(OSTypeDimension, "linux"),
+				dimensions.NewDimension(HostArchDimension, "amd64"),
+				dimensions.NewDimension(ContainerIDDimension, crioID),
+			),
+		},
+		{
+			name:    "host name error",
+			fixture: "host",
+			opts: []Option{
+				WithHostnameFunc(func() (string, error) { return "", errors.New("no host name") }),
+				WithPlatform("linux", "amd64"),
+			},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(OSTypeDimension, "linux"),
+				dimensions.NewDimension(HostArchDimension, "amd64"),
+			),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetHostMetadataFrom(os.DirFS(filepath.Join("testdata", tt.fixture)), tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetHostMetadataFrom() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetHostMetadataFrom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpmetrics records metrics of HTTP requests served by an http.Handler or sent by an http.Client.
+package httpmetrics
+
+import (
+	"net/http"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// Metric keys, without prefix.
+const (
+	// RequestsMetric counts the requests.
+	RequestsMetric = "requests"
+	// ErrorsMetric counts the outbound requests that failed without a response.
+	ErrorsMetric = "errors"
+	// DurationMetric is the summary of the request durations in seconds.
+	DurationMetric = "duration.seconds"
+)
+
+// Dimension keys.
+const (
+	MethodDimension      = "http.method"
+	RouteDimension       = "http.route"
+	StatusClassDimension = "http.status_class"
+	HostDimension        = "http.host"
+	StatusCodeDimension  = "http.status_code"
+)
+
+// Option represents the function interface used to configure the recording of requests.
+type Option func(c *config)
+
+type config struct {
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	routeExtractor    func(r *http.Request) string
+	dimensions        map[string]bool
+}
+
+// WithPrefix sets the prefix of all metric keys.
+func WithPrefix(prefix string) Option {
+	return func(c *config) {
+		c.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(c *config) {
+		c.defaultDimensions = dims
+	}
+}
+
+// WithRouteExtractor sets a function that returns the route of a request, e.g. the pattern "/users/{id}" of the
+// handler that served it. Raw paths should not be returned, as every distinct value creates a new series.
+// Without a route extractor, or if it returns an empty string, the route dimension is omitted.
+func WithRouteExtractor(extractor func(r *http.Request) string) Option {
+	return func(c *config) {
+		c.routeExtractor = extractor
+	}
+}
+
+// WithRequestDimensions restricts the dimensions that are recorded per request to the given keys.
+// By default, all dimensions are recorded.
+func WithRequestDimensions(keys ...string) Option {
+	return func(c *config) {
+		c.dimensions = map[string]bool{}
+		for _, key := range keys {
+			c.dimensions[key] = true
+		}
+	}
+}
+
+func newConfig(prefix string, opts []Option) *config {
+	c := &config{
+		prefix:            prefix,
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// dimension returns the dimension if key is enabled and value is not empty.
+func (c *config) dimension(key, value string, dims []dimensions.Dimension) []dimensions.Dimension {
+	if value == "" || (c.dimensions != nil && !c.dimensions[key]) {
+		return dims
+	}
+	return append(dims, dimensions.NewDimension(key, value))
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+const defaultServerPrefix = "http.server"
+
+// Middleware records the number and the duration of requests served by the handlers it wraps.
+// Requests are counted in the RequestsMetric and their durations are recorded in the DurationMetric summary, both
+// with the method, route and status class (e.g. "2xx") as dimensions. The prefix defaults to "http.server".
+// It is safe for concurrent use.
+type Middleware struct {
+	config     *config
+	aggregator *aggregation.Aggregator
+	now        func() time.Time
+}
+
+// NewMiddleware creates a Middleware.
+func NewMiddleware(opts ...Option) *Middleware {
+	c := newConfig(defaultServerPrefix, opts)
+
+	return &Middleware{
+		config: c,
+		aggregator: aggregation.NewAggregator(
+			aggregation.WithAggregatorPrefix(c.prefix),
+			aggregation.WithAggregatorDefaultDimensions(c.defaultDimensions),
+		),
+		now: time.Now,
+	}
+}
+
+// Wrap returns a handler that calls next and records the request. The route extractor is called after next returned.
+// Requests whose handler panics are recorded with status class "5xx" before the panic is propagated.
+func (m *Middleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := m.now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			status := recorder.status
+			p := recover()
+			if p != nil && !recorder.wroteHeader {
+				status = http.StatusInternalServerError
+			}
+			m.record(r, status, m.now().Sub(start))
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+func (m *Middleware) record(r *http.Request, status int, duration time.Duration) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	route := ""
+	if m.config.routeExtractor != nil {
+		route = m.config.routeExtractor(r)
+	}
+
+	dims := []dimensions.Dimension{}
+	dims = m.config.dimension(MethodDimension, r.Method, dims)
+	dims = m.config.dimension(RouteDimension, route, dims)
+	dims = m.config.dimension(StatusClassDimension, statusClass(status), dims)
+	list := dimensions.NewNormalizedDimensionList(dims...)
+
+	m.aggregator.AddCount(RequestsMetric, list, 1)
+	m.aggregator.RecordSummary(DurationMetric, list, duration.Seconds())
+}
+
+// Collect returns the requests recorded since the last Collect.
+func (m *Middleware) Collect() ([]*metric.Metric, error) {
+	return m.aggregator.Collect()
+}
+
+// statusClass returns the class of an HTTP status code, e.g. "2xx".
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.status = http.StatusOK
+		r.wroteHeader = true
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the wrapped writer does.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		if !r.wroteHeader {
+			r.status = http.StatusOK
+			r.wroteHeader = true
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the wrapped writer does, so that handlers can upgrade connections, e.g. to
+// WebSockets. Hijacked requests without an explicit status are recorded with status 101.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", r.ResponseWriter)
+	}
+
+	conn, rw, err := h.Hijack()
+	if err == nil && !r.wroteHeader {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped writer, so that http.ResponseController can reach it.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
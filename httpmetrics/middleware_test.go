@@ -0,0 +1,226 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// fakeClock advances by step on every call.
+func fakeClock(step time.Duration) func() time.Time {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func collectLines(t *testing.T, m *Middleware) []string {
+	t.Helper()
+
+	metrics, err := m.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	return linetest.CanonicalLines(linetest.Serialize(t, metrics))
+}
+
+func serve(handler http.Handler, method, target string) {
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, nil))
+}
+
+func TestMiddleware(t *testing.T) {
+	m := NewMiddleware(
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("service", "users"))),
+		WithRouteExtractor(func(r *http.Request) string {
+			if strings.HasPrefix(r.URL.Path, "/users/") {
+				return "/users/{id}"
+			}
+			return ""
+		}),
+	)
+	m.now = fakeClock(250 * time.Millisecond)
+
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/missing":
+			http.NotFound(w, r)
+		case "/health":
+			// no explicit status or body
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+
+	serve(handler, http.MethodGet, "/users/1")
+	serve(handler, http.MethodGet, "/users/2")
+	serve(handler, http.MethodGet, "/users/missing")
+	serve(handler, http.MethodPost, "/health")
+
+	want := linetest.CanonicalLines([]string{
+		"http.server.requests,service=users,http.method=GET,http.route=/users/{id},http.status_class=2xx count,delta=2",
+		"http.server.requests,service=users,http.method=GET,http.route=/users/{id},http.status_class=4xx count,delta=1",
+		"http.server.requests,service=users,http.method=POST,http.status_class=2xx count,delta=1",
+		"http.server.duration.seconds,service=users,http.method=GET,http.route=/users/{id},http.status_class=2xx gauge,min=0.25,max=0.25,sum=0.5,count=2",
+		"http.server.duration.seconds,service=users,http.method=GET,http.route=/users/{id},http.status_class=4xx gauge,min=0.25,max=0.25,sum=0.25,count=1",
+		"http.server.duration.seconds,service=users,http.method=POST,http.status_class=2xx gauge,min=0.25,max=0.25,sum=0.25,count=1",
+	})
+	if got := collectLines(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %v, want %v", got, want)
+	}
+
+	// recorded requests are reset by Collect
+	if got := collectLines(t, m); len(got) != 0 {
+		t.Errorf("second Collect() = %v, want no lines", got)
+	}
+}
+
+func TestMiddleware_RequestDimensions(t *testing.T) {
+	m := NewMiddleware(WithPrefix("api"), WithRequestDimensions(StatusClassDimension))
+	m.now = fakeClock(time.Second)
+
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		// later status codes are ignored by net/http and by the middleware
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve(handler, http.MethodGet, "/a")
+	serve(handler, http.MethodDelete, "/b")
+
+	want := linetest.CanonicalLines([]string{
+		"api.requests,http.status_class=5xx count,delta=2",
+		"api.duration.seconds,http.status_class=5xx gauge,min=1,max=1,sum=2,count=2",
+	})
+	if got := collectLines(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %v, want %v", got, want)
+	}
+}
+
+func TestMiddleware_Panic(t *testing.T) {
+	m := NewMiddleware()
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want boom", p)
+			}
+		}()
+		serve(handler, http.MethodGet, "/")
+	}()
+
+	got := collectLines(t, m)
+	if len(got) != 2 || !strings.Contains(got[1], "http.status_class=5xx count,delta=1") {
+		t.Errorf("Collect() = %v, want request recorded as 5xx", got)
+	}
+}
+
+func TestMiddleware_Flusher(t *testing.T) {
+	m := NewMiddleware()
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("wrapped writer does not implement http.Flusher")
+		}
+		f.Flush()
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !recorder.Flushed {
+		t.Error("Flush() was not passed to the wrapped writer")
+	}
+}
+
+func TestMiddleware_Hijacker(t *testing.T) {
+	m := NewMiddleware()
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("wrapped writer does not implement http.Hijacker")
+			return
+		}
+		conn, rw, err := h.Hijack()
+		if err != nil {
+			t.Errorf("Hijack() error = %v", err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+	}))
+
+	served := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+		served <- struct{}{}
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(status, "HTTP/1.1 101") {
+		t.Errorf("status line = %q, want 101", status)
+	}
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the handler")
+	}
+	got := collectLines(t, m)
+	if len(got) != 2 || !strings.Contains(got[1], "http.status_class=1xx count,delta=1") {
+		t.Errorf("Collect() = %v, want request recorded as 1xx", got)
+	}
+
+	// writers that cannot be hijacked return an error
+	unsupported := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			t.Error("Hijack() expected error for writer that does not implement http.Hijacker")
+		}
+	}))
+	serve(unsupported, http.MethodGet, "/")
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := map[int]string{100: "1xx", 200: "2xx", 301: "3xx", 404: "4xx", 599: "5xx", 0: "unknown", 600: "unknown"}
+	for status, want := range tests {
+		if got := statusClass(status); got != want {
+			t.Errorf("statusClass(%d) = %s, want %s", status, got, want)
+		}
+	}
+}
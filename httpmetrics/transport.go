@@ -0,0 +1,90 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+const defaultClientPrefix = "http.client"
+
+// Transport is an http.RoundTripper that records the number and the duration of the requests sent through it.
+// Requests are counted in the RequestsMetric and their durations are recorded in the DurationMetric summary, both
+// with the target host, method and status code as dimensions. Requests that fail without a response are additionally
+// counted in the ErrorsMetric and have no status code. The duration ends when the response headers are received.
+// The prefix defaults to "http.client". The route extractor is not used. It is safe for concurrent use.
+type Transport struct {
+	base       http.RoundTripper
+	config     *config
+	aggregator *aggregation.Aggregator
+	now        func() time.Time
+}
+
+// NewTransport creates a Transport that sends the requests with base. If base is nil, http.DefaultTransport is used.
+func NewTransport(base http.RoundTripper, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c := newConfig(defaultClientPrefix, opts)
+
+	return &Transport{
+		base:   base,
+		config: c,
+		aggregator: aggregation.NewAggregator(
+			aggregation.WithAggregatorPrefix(c.prefix),
+			aggregation.WithAggregatorDefaultDimensions(c.defaultDimensions),
+		),
+		now: time.Now,
+	}
+}
+
+// RoundTrip sends the request with the base transport and records it.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := t.now()
+	resp, err := t.base.RoundTrip(req)
+	duration := t.now().Sub(start)
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	dims := []dimensions.Dimension{}
+	dims = t.config.dimension(HostDimension, req.URL.Host, dims)
+	dims = t.config.dimension(MethodDimension, method, dims)
+	if err == nil {
+		dims = t.config.dimension(StatusCodeDimension, strconv.Itoa(resp.StatusCode), dims)
+	}
+	list := dimensions.NewNormalizedDimensionList(dims...)
+
+	t.aggregator.AddCount(RequestsMetric, list, 1)
+	t.aggregator.RecordSummary(DurationMetric, list, duration.Seconds())
+	if err != nil {
+		t.aggregator.AddCount(ErrorsMetric, list, 1)
+	}
+
+	return resp, err
+}
+
+// Collect returns the requests recorded since the last Collect.
+func (t *Transport) Collect() ([]*metric.Metric, error) {
+	return t.aggregator.Collect()
+}
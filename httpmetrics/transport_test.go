@@ -0,0 +1,97 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+)
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	transport := NewTransport(nil)
+	transport.now = fakeClock(100 * time.Millisecond)
+	client := &http.Client{Transport: transport}
+
+	for _, path := range []string{"/a", "/b", "/missing"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	resp.Body.Close()
+
+	metrics, err := transport.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	want := linetest.CanonicalLines([]string{
+		"http.client.requests,http.host=" + host + ",http.method=GET,http.status_code=200 count,delta=2",
+		"http.client.requests,http.host=" + host + ",http.method=GET,http.status_code=404 count,delta=1",
+		"http.client.requests,http.host=" + host + ",http.method=POST,http.status_code=200 count,delta=1",
+		"http.client.duration.seconds,http.host=" + host + ",http.method=GET,http.status_code=200 gauge,min=0.1,max=0.1,sum=0.2,count=2",
+		"http.client.duration.seconds,http.host=" + host + ",http.method=GET,http.status_code=404 gauge,min=0.1,max=0.1,sum=0.1,count=1",
+		"http.client.duration.seconds,http.host=" + host + ",http.method=POST,http.status_code=200 gauge,min=0.1,max=0.1,sum=0.1,count=1",
+	})
+	if got := linetest.CanonicalLines(linetest.Serialize(t, metrics)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %v, want %v", got, want)
+	}
+}
+
+func TestTransport_Error(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	target := server.URL
+	server.Close()
+
+	transport := NewTransport(http.DefaultTransport, WithPrefix("out"), WithRequestDimensions(HostDimension, StatusCodeDimension))
+	transport.now = fakeClock(time.Second)
+	client := &http.Client{Transport: transport}
+
+	if _, err := client.Get(target); err == nil {
+		t.Fatal("Get() expected error for closed server")
+	}
+
+	metrics, err := transport.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	host := strings.TrimPrefix(target, "http://")
+	want := linetest.CanonicalLines([]string{
+		"out.requests,http.host=" + host + " count,delta=1",
+		"out.errors,http.host=" + host + " count,delta=1",
+		"out.duration.seconds,http.host=" + host + " gauge,min=1,max=1,sum=1,count=1",
+	})
+	if got := linetest.CanonicalLines(linetest.Serialize(t, metrics)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+const (
+	// maxLineLength is the longest line the Converter reads. Longer lines are reported as errors.
+	maxLineLength = 1024 * 1024
+	// maxReportedErrors is the number of invalid lines that Stream describes in its error. Further invalid lines
+	// are only counted, so that long malformed inputs do not use up memory.
+	maxReportedErrors = 10
+)
+
+// Option represents the function interface used to configure the Converter.
+type Option func(c *Converter)
+
+// WithPrefix sets a prefix that is prepended to all metric keys.
+func WithPrefix(prefix string) Option {
+	return func(c *Converter) {
+		c.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics. Tags with the same (normalized) key
+// overwrite the default dimensions.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(c *Converter) {
+		c.defaultDimensions = dims
+	}
+}
+
+// WithPrecision sets the precision of the timestamps, e.g. time.Second. Defaults to time.Nanosecond.
+func WithPrecision(precision time.Duration) Option {
+	return func(c *Converter) {
+		c.precision = precision
+	}
+}
+
+// Converter converts the InfluxDB line protocol to Dynatrace metrics. Every numeric or boolean field becomes a
+// gauge with the key "<measurement>.<field>", and tags become dimensions. String fields are skipped.
+// It is safe for concurrent use.
+type Converter struct {
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	precision         time.Duration
+}
+
+// NewConverter creates a new Converter.
+func NewConverter(opts ...Option) *Converter {
+	c := &Converter{
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		precision:         time.Nanosecond,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.precision <= 0 {
+		c.precision = time.Nanosecond
+	}
+
+	return c
+}
+
+// ConvertPoint converts the fields of a point to metrics. Booleans are converted to 0 and 1.
+func (c *Converter) ConvertPoint(p Point) ([]*metric.Metric, error) {
+	dims := make([]dimensions.Dimension, 0, len(p.Tags))
+	for _, t := range p.Tags {
+		dims = append(dims, dimensions.NewDimension(t.Key, t.Value))
+	}
+	merged := dimensions.MergeLists(c.defaultDimensions, dimensions.NewNormalizedDimensionList(dims...))
+
+	result := make([]*metric.Metric, 0, len(p.Fields))
+	errs := []string{}
+	for _, f := range p.Fields {
+		var value metric.MetricOption
+		switch f.Type {
+		case FieldFloat:
+			if math.IsNaN(f.FloatValue) || math.IsInf(f.FloatValue, 0) {
+				continue
+			}
+			value = metric.WithFloatGaugeValue(f.FloatValue)
+		case FieldInteger:
+			value = metric.WithIntGaugeValue(f.IntValue)
+		case FieldUnsigned:
+			if f.UintValue > math.MaxInt64 {
+				value = metric.WithFloatGaugeValue(float64(f.UintValue))
+			} else {
+				value = metric.WithIntGaugeValue(int64(f.UintValue))
+			}
+		case FieldBoolean:
+			v := int64(0)
+			if f.BoolValue {
+				v = 1
+			}
+			value = metric.WithIntGaugeValue(v)
+		default:
+			continue
+		}
+
+		opts := []metric.MetricOption{metric.WithPrefix(c.prefix), metric.WithDimensions(merged), value}
+		if !p.Timestamp.IsZero() {
+			opts = append(opts, metric.WithTimestamp(p.Timestamp))
+		}
+
+		m, err := metric.NewMetric(p.Measurement+"."+f.Key, opts...)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("field '%s' of '%s': %v", f.Key, p.Measurement, err))
+			continue
+		}
+		result = append(result, m)
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("could not convert %d field(s): %s", len(errs), strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// ConvertLine parses and converts a single line. Empty lines and comments return no metrics.
+func (c *Converter) ConvertLine(line string) ([]*metric.Metric, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	p, err := ParseLine(line, c.precision)
+	if err != nil {
+		return nil, err
+	}
+	return c.ConvertPoint(p)
+}
+
+// Stream reads lines from reader and passes the converted metrics to fn as they are read, so that large inputs are
+// never held in memory. Invalid lines are skipped and reported in the returned error, which describes the first ten
+// of them. If fn returns an error, Stream stops and returns it.
+func (c *Converter) Stream(reader io.Reader, fn func(*metric.Metric) error) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	errs := []string{}
+	failed := 0
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		metrics, err := c.ConvertLine(scanner.Text())
+		if err != nil {
+			failed++
+			if len(errs) < maxReportedErrors {
+				errs = append(errs, fmt.Sprintf("line %d: %v", lineNumber, err))
+			}
+		}
+
+		for _, m := range metrics {
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+	}
+	if failed > len(errs) {
+		errs = append(errs, fmt.Sprintf("%d more", failed-len(errs)))
+	}
+	if err := scanner.Err(); err != nil {
+		failed++
+		errs = append(errs, err.Error())
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("could not convert %d line(s): %s", failed, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Convert reads all lines from reader and returns the converted metrics. If some lines cannot be converted,
+// all other metrics are returned together with an error.
+func (c *Converter) Convert(reader io.Reader) ([]*metric.Metric, error) {
+	result := []*metric.Metric{}
+	err := c.Stream(reader, func(m *metric.Metric) error {
+		result = append(result, m)
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influx
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestConverter_Convert(t *testing.T) {
+	input := `# comment
+cpu,host=a,env=prod usage_user=12.5,cores=4i,online=true,model="xeon" 1700000000123456789
+
+mem,host=a free=1024u
+invalid line
+disk,path=/var\ log used=0.75
+`
+
+	c := NewConverter(
+		WithPrefix("influx"),
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("env", "default"))),
+	)
+	metrics, err := c.Convert(strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "line 5") {
+		t.Errorf("Convert() error = %v, want error for line 5", err)
+	}
+
+	want := linetest.CanonicalLines([]string{
+		"influx.cpu.usage_user,host=a,env=prod gauge,12.5 1700000000123",
+		"influx.cpu.cores,host=a,env=prod gauge,4 1700000000123",
+		"influx.cpu.online,host=a,env=prod gauge,1 1700000000123",
+		"influx.mem.free,host=a,env=default gauge,1024",
+		`influx.disk.used,path=/var\ log,env=default gauge,0.75`,
+	})
+	if got := linetest.Serialize(t, metrics); !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert() = %v, want %v", got, want)
+	}
+}
+
+func TestConverter_Precision(t *testing.T) {
+	c := NewConverter(WithPrecision(time.Millisecond))
+	metrics, err := c.ConvertLine("m f=1 1700000000123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := linetest.Serialize(t, metrics); !reflect.DeepEqual(got, []string{"m.f gauge,1 1700000000123"}) {
+		t.Errorf("ConvertLine() = %v", got)
+	}
+}
+
+func TestConverter_Stream(t *testing.T) {
+	input := strings.Repeat("m,i=x a=1,b=2\n", 10)
+	c := NewConverter()
+
+	count := 0
+	err := c.Stream(strings.NewReader(input), func(m *metric.Metric) error {
+		count++
+		return nil
+	})
+	if err != nil || count != 20 {
+		t.Errorf("Stream() = (%d metrics, %v), want 20 metrics", count, err)
+	}
+
+	stop := errors.New("stop")
+	count = 0
+	err = c.Stream(strings.NewReader(input), func(m *metric.Metric) error {
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || count != 3 {
+		t.Errorf("Stream() = (%d metrics, %v), want to stop after 3 metrics", count, err)
+	}
+}
+
+func TestConverter_StreamLimitsErrors(t *testing.T) {
+	input := strings.Repeat("invalid\n", 1000) + "m a=1\n"
+	c := NewConverter()
+
+	count := 0
+	err := c.Stream(strings.NewReader(input), func(m *metric.Metric) error {
+		count++
+		return nil
+	})
+	if count != 1 {
+		t.Errorf("Stream() passed %d metrics, want 1", count)
+	}
+	if err == nil {
+		t.Fatal("Stream() expected error")
+	}
+
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "could not convert 1000 line(s): line 1: ") {
+		t.Errorf("Stream() error = %q, want the total number of invalid lines", msg)
+	}
+	if got := strings.Count(msg, "line "); got != maxReportedErrors {
+		t.Errorf("Stream() error describes %d lines, want %d", got, maxReportedErrors)
+	}
+	if !strings.HasSuffix(msg, "; 990 more") {
+		t.Errorf("Stream() error = %q, want the number of lines that are not described", msg)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package influx converts the InfluxDB line protocol to Dynatrace metrics.
+package influx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType is the type of a field value.
+type FieldType int
+
+// The field types of the line protocol.
+const (
+	FieldFloat FieldType = iota
+	FieldInteger
+	FieldUnsigned
+	FieldBoolean
+	FieldString
+)
+
+// Tag is a tag key-value pair of a point.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Field is a field of a point. Depending on Type, one of the value fields is set.
+type Field struct {
+	Key         string
+	Type        FieldType
+	FloatValue  float64
+	IntValue    int64
+	UintValue   uint64
+	BoolValue   bool
+	StringValue string
+}
+
+// Point is a single parsed line.
+type Point struct {
+	Measurement string
+	Tags        []Tag
+	Fields      []Field
+	// Timestamp is zero if the line has no timestamp.
+	Timestamp time.Time
+}
+
+// ParseError is returned if a line is not valid line protocol.
+type ParseError struct {
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return e.Msg
+}
+
+// scanUntil returns the part of s up to the first unescaped occurrence of one of the stop characters, and the index
+// of that character (or len(s)). Double quotes are only respected if quotes is true.
+func scanUntil(s string, start int, stop string, quotes bool) (string, int) {
+	inQuotes := false
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+		case quotes && c == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && strings.IndexByte(stop, c) >= 0:
+			return s[start:i], i
+		}
+	}
+	return s[start:], len(s)
+}
+
+// unescape removes the backslashes in front of the characters in special. Other backslashes are kept.
+func unescape(s, special string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(special, s[i+1]) >= 0 {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// ParseLine parses a single line of the form "<measurement>[,<tag>=<value>...] <field>=<value>[,...] [<timestamp>]".
+// The timestamp is interpreted with the given precision, e.g. time.Nanosecond.
+func ParseLine(line string, precision time.Duration) (Point, error) {
+	p := Point{}
+
+	measurement, i := scanUntil(line, 0, ", ", false)
+	if measurement == "" {
+		return p, &ParseError{Msg: "missing measurement"}
+	}
+	p.Measurement = unescape(measurement, ", ")
+
+	for i < len(line) && line[i] == ',' {
+		var tag string
+		tag, i = scanUntil(line, i+1, ", ", false)
+		kv, _ := scanUntil(tag, 0, "=", false)
+		if len(kv) == len(tag) || kv == "" || len(tag) == len(kv)+1 {
+			return p, &ParseError{Msg: fmt.Sprintf("invalid tag '%s'", tag)}
+		}
+		p.Tags = append(p.Tags, Tag{Key: unescape(kv, ",= "), Value: unescape(tag[len(kv)+1:], ",= ")})
+	}
+
+	if i >= len(line) {
+		return p, &ParseError{Msg: "missing fields"}
+	}
+
+	fieldSet, end := scanUntil(line, i+1, " ", true)
+	for start := 0; start < len(fieldSet); {
+		field, next := scanUntil(fieldSet, start, ",", true)
+		f, err := parseField(field)
+		if err != nil {
+			return p, err
+		}
+		p.Fields = append(p.Fields, f)
+		start = next + 1
+	}
+	if len(p.Fields) == 0 {
+		return p, &ParseError{Msg: "missing fields"}
+	}
+
+	if rest := strings.TrimSpace(line[end:]); rest != "" {
+		ts, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return p, &ParseError{Msg: fmt.Sprintf("invalid timestamp '%s'", rest)}
+		}
+		p.Timestamp = time.Unix(0, ts*int64(precision))
+	}
+
+	return p, nil
+}
+
+func parseField(field string) (Field, error) {
+	key, i := scanUntil(field, 0, "=", false)
+	if key == "" || i >= len(field)-1 {
+		return Field{}, &ParseError{Msg: fmt.Sprintf("invalid field '%s'", field)}
+	}
+
+	f := Field{Key: unescape(key, ",= ")}
+	raw := field[i+1:]
+	invalid := func() (Field, error) {
+		return Field{}, &ParseError{Msg: fmt.Sprintf("invalid value '%s' for field '%s'", raw, f.Key)}
+	}
+
+	switch last := raw[len(raw)-1]; {
+	case raw[0] == '"':
+		if len(raw) < 2 || last != '"' {
+			return invalid()
+		}
+		f.Type = FieldString
+		f.StringValue = unescape(raw[1:len(raw)-1], `"\`)
+	case last == 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return invalid()
+		}
+		f.Type, f.IntValue = FieldInteger, v
+	case last == 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return invalid()
+		}
+		f.Type, f.UintValue = FieldUnsigned, v
+	default:
+		switch raw {
+		case "t", "T", "true", "True", "TRUE":
+			f.Type, f.BoolValue = FieldBoolean, true
+			return f, nil
+		case "f", "F", "false", "False", "FALSE":
+			f.Type, f.BoolValue = FieldBoolean, false
+			return f, nil
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return invalid()
+		}
+		f.Type, f.FloatValue = FieldFloat, v
+	}
+	return f, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influx
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Point
+		wantErr bool
+	}{
+		{
+			name: "all field types",
+			line: `cpu,host=a,region=eu usage=0.5,cores=8i,big=18446744073709551615u,on=t,model="x86 \"64\"" 1700000000000000000`,
+			want: Point{
+				Measurement: "cpu",
+				Tags:        []Tag{{"host", "a"}, {"region", "eu"}},
+				Fields: []Field{
+					{Key: "usage", Type: FieldFloat, FloatValue: 0.5},
+					{Key: "cores", Type: FieldInteger, IntValue: 8},
+					{Key: "big", Type: FieldUnsigned, UintValue: 18446744073709551615},
+					{Key: "on", Type: FieldBoolean, BoolValue: true},
+					{Key: "model", Type: FieldString, StringValue: `x86 "64"`},
+				},
+				Timestamp: time.Unix(1700000000, 0),
+			},
+		},
+		{
+			name: "no tags and no timestamp",
+			line: "mem free=1024i",
+			want: Point{Measurement: "mem", Fields: []Field{{Key: "free", Type: FieldInteger, IntValue: 1024}}},
+		},
+		{
+			name: "escaping",
+			line: `my\ measurement,tag\,key=tag\=value\ x field\ key=1,other="a,b c=d" 1`,
+			want: Point{
+				Measurement: "my measurement",
+				Tags:        []Tag{{"tag,key", "tag=value x"}},
+				Fields: []Field{
+					{Key: "field key", Type: FieldFloat, FloatValue: 1},
+					{Key: "other", Type: FieldString, StringValue: "a,b c=d"},
+				},
+				Timestamp: time.Unix(0, 1),
+			},
+		},
+		{
+			name: "negative values and false",
+			line: "m a=-1.5e3,b=-2i,c=false",
+			want: Point{Measurement: "m", Fields: []Field{
+				{Key: "a", Type: FieldFloat, FloatValue: -1500},
+				{Key: "b", Type: FieldInteger, IntValue: -2},
+				{Key: "c", Type: FieldBoolean, BoolValue: false},
+			}},
+		},
+		{name: "missing fields", line: "cpu,host=a", wantErr: true},
+		{name: "missing measurement", line: ",host=a f=1", wantErr: true},
+		{name: "empty tag value", line: "cpu,host= f=1", wantErr: true},
+		{name: "invalid field", line: "cpu f", wantErr: true},
+		{name: "invalid integer", line: "cpu f=1.5i", wantErr: true},
+		{name: "unterminated string", line: `cpu f="abc`, wantErr: true},
+		{name: "invalid timestamp", line: "cpu f=1 abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line, time.Nanosecond)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("ParseLine() timestamp = %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp, tt.want.Timestamp = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLine_Precision(t *testing.T) {
+	p, err := ParseLine("m f=1 1700000000", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Timestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("timestamp = %v", p.Timestamp)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package estimate approximates statistics of values that are only known by the histogram bucket they fall into.
+package estimate
+
+import "math"
+
+// Bucket is the number of values in the range (Lower, Upper]. The outermost buckets of a histogram may be open-ended,
+// i.e. have an infinite boundary.
+type Bucket struct {
+	Lower, Upper float64
+	Count        float64
+}
+
+// Bounds returns the boundaries of the bucket. An infinite boundary is replaced by the finite one, so the values of
+// an open-ended bucket are placed at its finite end.
+func (b Bucket) Bounds() (lower, upper float64) {
+	lower, upper = b.Lower, b.Upper
+	if math.IsInf(lower, -1) {
+		lower = upper
+	}
+	if math.IsInf(upper, 1) {
+		upper = lower
+	}
+	return lower, upper
+}
+
+// MinMax returns the lower bound of the first and the upper bound of the last non-empty bucket, as given by Bounds.
+// The buckets have to be sorted by their boundaries. The mean of the values cannot lie outside of their min and max,
+// so the result is extended to contain it. Without finite bounds, mean is returned as min and max.
+func MinMax(buckets []Bucket, mean float64) (min, max float64) {
+	min, max = mean, mean
+	first := true
+	for _, b := range buckets {
+		if b.Count <= 0 {
+			continue
+		}
+		lower, upper := b.Bounds()
+		if first && !math.IsInf(lower, 0) {
+			min = lower
+			first = false
+		}
+		if !math.IsInf(upper, 0) {
+			max = upper
+		}
+	}
+	return math.Min(min, mean), math.Max(max, mean)
+}
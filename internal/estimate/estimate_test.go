@@ -0,0 +1,103 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package estimate
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBucket_Bounds(t *testing.T) {
+	tests := []struct {
+		name      string
+		bucket    Bucket
+		wantLower float64
+		wantUpper float64
+	}{
+		{"finite", Bucket{Lower: 1, Upper: 2}, 1, 2},
+		{"open below", Bucket{Lower: math.Inf(-1), Upper: 2}, 2, 2},
+		{"open above", Bucket{Lower: 1, Upper: math.Inf(1)}, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lower, upper := tt.bucket.Bounds()
+			if lower != tt.wantLower || upper != tt.wantUpper {
+				t.Errorf("Bounds() = (%v, %v), want (%v, %v)", lower, upper, tt.wantLower, tt.wantUpper)
+			}
+		})
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		name    string
+		buckets []Bucket
+		mean    float64
+		wantMin float64
+		wantMax float64
+	}{
+		{
+			name:    "only first bucket",
+			buckets: []Bucket{{-inf, 1, 2}, {1, 2, 0}},
+			mean:    0.5,
+			wantMin: 0.5,
+			wantMax: 1,
+		},
+		{
+			name:    "middle buckets",
+			buckets: []Bucket{{-inf, 1, 0}, {1, 2, 1}, {2, 5, 2}, {5, 10, 0}},
+			mean:    3,
+			wantMin: 1,
+			wantMax: 5,
+		},
+		{
+			name:    "last bucket",
+			buckets: []Bucket{{-inf, 1, 0}, {1, 2, 1}, {2, inf, 1}},
+			mean:    1.5,
+			wantMin: 1,
+			wantMax: 2,
+		},
+		{
+			name:    "mean outside of estimate",
+			buckets: []Bucket{{-inf, 1, 0}, {1, 2, 1}},
+			mean:    3,
+			wantMin: 1,
+			wantMax: 3,
+		},
+		{
+			name:    "only infinite bounds",
+			buckets: []Bucket{{-inf, inf, 3}},
+			mean:    3,
+			wantMin: 3,
+			wantMax: 3,
+		},
+		{
+			name:    "no buckets",
+			buckets: []Bucket{},
+			mean:    3,
+			wantMin: 3,
+			wantMax: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotMin, gotMax := MinMax(tt.buckets, tt.mean)
+			if gotMin != tt.wantMin || gotMax != tt.wantMax {
+				t.Errorf("MinMax() = (%v, %v), want (%v, %v)", gotMin, gotMax, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
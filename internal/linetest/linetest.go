@@ -0,0 +1,81 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package linetest contains helpers for comparing serialized metric lines in tests.
+// The order of dimensions produced by dimensions.MergeLists is not guaranteed, so lines are
+// brought into a canonical form with sorted dimensions before comparing them.
+package linetest
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+)
+
+// splitUnescaped splits s at every occurrence of sep that is not preceded by an odd number of backslashes.
+func splitUnescaped(s string, sep byte, limit int) []string {
+	parts := []string{}
+	start := 0
+	backslashes := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' {
+			backslashes++
+			continue
+		}
+		if c == sep && backslashes%2 == 0 && (limit < 0 || len(parts) < limit-1) {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+		backslashes = 0
+	}
+	return append(parts, s[start:])
+}
+
+// Canonical sorts the dimensions of a serialized metric line.
+func Canonical(line string) string {
+	parts := splitUnescaped(line, ' ', 2)
+	keyAndDims := splitUnescaped(parts[0], ',', -1)
+	sort.Strings(keyAndDims[1:])
+
+	parts[0] = strings.Join(keyAndDims, ",")
+	return strings.Join(parts, " ")
+}
+
+// CanonicalLines returns the canonical form of all lines, sorted.
+func CanonicalLines(lines []string) []string {
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, Canonical(line))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Serialize serializes all metrics and returns the sorted canonical lines. Fails the test if a metric cannot be serialized.
+func Serialize(t testing.TB, metrics []*metric.Metric) []string {
+	t.Helper()
+
+	lines := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		line, err := m.Serialize()
+		if err != nil {
+			t.Fatalf("could not serialize metric: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	return CanonicalLines(lines)
+}
@@ -0,0 +1,306 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package properties reads files in the Java .properties format, which is used by the
+// OneAgent and other file-based enrichment sources.
+// See https://docs.oracle.com/javase/8/docs/api/java/util/Properties.html#load-java.io.Reader- for the format.
+package properties
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Property is a single key-value pair read from a properties file.
+type Property struct {
+	Key   string
+	Value string
+	// Line is the number of the (first) line the property was read from, starting at 1.
+	Line int
+	// Raw is the logical line the property was read from, with line continuations joined but escapes not resolved.
+	Raw string
+}
+
+// SyntaxError describes a logical line that could not be parsed.
+type SyntaxError struct {
+	Line int
+	Raw  string
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ErrorList contains all syntax errors that were encountered while parsing.
+type ErrorList []*SyntaxError
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, 0, len(l))
+	for _, err := range l {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Parse reads all properties from the passed Reader in the order in which they appear.
+// Comments, blank lines, line continuations, all separators (=, : and whitespace) and escape sequences
+// (including \uXXXX) are handled. Duplicate keys are not removed.
+// Lines that cannot be parsed are skipped and returned as ErrorList alongside all other properties.
+// I/O errors are returned as they are.
+func Parse(reader io.Reader) ([]Property, error) {
+	if reader == nil {
+		return nil, errors.New("reader cannot be nil")
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Split(scanNaturalLines)
+
+	result := []Property{}
+	var syntaxErrors ErrorList
+
+	lineNumber := 0
+	for {
+		raw, first, ok := nextLogicalLine(scanner, &lineNumber)
+		if !ok {
+			break
+		}
+
+		key, value, err := parseLogicalLine(raw)
+		if err != nil {
+			syntaxErrors = append(syntaxErrors, &SyntaxError{Line: first, Raw: raw, Msg: err.Error()})
+			continue
+		}
+
+		result = append(result, Property{Key: key, Value: value, Line: first, Raw: raw})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(syntaxErrors) > 0 {
+		return result, syntaxErrors
+	}
+	return result, nil
+}
+
+// scanNaturalLines is a bufio.SplitFunc that splits on \n, \r and \r\n, which are all valid line terminators.
+func scanNaturalLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	for i, b := range data {
+		switch b {
+		case '\n':
+			return i + 1, data[:i], nil
+		case '\r':
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				return i + 1, data[:i], nil
+			}
+			if atEOF {
+				return i + 1, data[:i], nil
+			}
+			// need more data to decide if this is \r\n
+			return 0, nil, nil
+		}
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\f'
+}
+
+func trimLeadingWhitespace(s string) string {
+	return strings.TrimLeft(s, " \t\f")
+}
+
+// hasContinuation checks if the line ends with an odd number of backslashes.
+func hasContinuation(s string) bool {
+	count := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+// nextLogicalLine returns the next logical line, skipping comments and blank lines. The returned line
+// has its leading whitespace removed and continuation lines joined. first is the number of the first natural line.
+func nextLogicalLine(scanner *bufio.Scanner, lineNumber *int) (line string, first int, ok bool) {
+	for scanner.Scan() {
+		*lineNumber++
+		natural := trimLeadingWhitespace(scanner.Text())
+		if natural == "" || natural[0] == '#' || natural[0] == '!' {
+			continue
+		}
+
+		first = *lineNumber
+		var sb strings.Builder
+		for hasContinuation(natural) {
+			sb.WriteString(natural[:len(natural)-1])
+			if !scanner.Scan() {
+				// a continuation on the last line is ignored
+				return sb.String(), first, true
+			}
+			*lineNumber++
+			// continuation lines are never treated as comments
+			natural = trimLeadingWhitespace(scanner.Text())
+		}
+		sb.WriteString(natural)
+
+		return sb.String(), first, true
+	}
+
+	return "", 0, false
+}
+
+// parseLogicalLine splits a logical line into key and value and resolves all escape sequences.
+func parseLogicalLine(line string) (string, string, error) {
+	keyEnd := len(line)
+	valueStart := len(line)
+	hasSeparator := false
+	precedingBackslash := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if precedingBackslash {
+			precedingBackslash = false
+			continue
+		}
+		if c == '\\' {
+			precedingBackslash = true
+			continue
+		}
+		if c == '=' || c == ':' {
+			keyEnd = i
+			valueStart = i + 1
+			hasSeparator = true
+			break
+		}
+		if isWhitespace(c) {
+			keyEnd = i
+			valueStart = i + 1
+			break
+		}
+	}
+
+	for valueStart < len(line) {
+		c := line[valueStart]
+		if isWhitespace(c) {
+			valueStart++
+			continue
+		}
+		if !hasSeparator && (c == '=' || c == ':') {
+			hasSeparator = true
+			valueStart++
+			continue
+		}
+		break
+	}
+
+	key, err := unescape(line[:keyEnd])
+	if err != nil {
+		return "", "", err
+	}
+
+	value, err := unescape(line[valueStart:])
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, value, nil
+}
+
+// unescape resolves \t, \n, \r, \f and \uXXXX escape sequences. A backslash
+// followed by any other character is replaced by that character.
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i >= len(s) {
+			// a single trailing backslash is dropped
+			break
+		}
+
+		switch c = s[i]; c {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			r, n, err := decodeUnicodeEscape(s[i+1:])
+			if err != nil {
+				return "", fmt.Errorf("malformed \\uXXXX encoding in '%s'", s)
+			}
+			sb.WriteRune(r)
+			i += n
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// decodeUnicodeEscape decodes the four hex digits at the start of s. If they represent the high half of a
+// surrogate pair and are followed by the escaped low half, both are combined into one rune.
+// Returns the rune and the number of bytes consumed from s.
+func decodeUnicodeEscape(s string) (rune, int, error) {
+	if len(s) < 4 {
+		return 0, 0, errors.New("not enough hex digits")
+	}
+	code, err := strconv.ParseUint(s[:4], 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	r := rune(code)
+	if utf16.IsSurrogate(r) && len(s) >= 10 && s[4:6] == "\\u" {
+		if low, err := strconv.ParseUint(s[6:10], 16, 16); err == nil {
+			if combined := utf16.DecodeRune(r, rune(low)); combined != '\uFFFD' {
+				return combined, 10, nil
+			}
+		}
+	}
+
+	return r, 4, nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package properties
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type kv struct {
+	key, value string
+}
+
+func keyValues(props []Property) []kv {
+	result := []kv{}
+	for _, p := range props {
+		result = append(result, kv{p.Key, p.Value})
+	}
+	return result
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		want        []kv
+		wantSyntax  int
+		wantIOError bool
+	}{
+		{
+			name:  "simple",
+			input: "key1=value1\nkey2=value2",
+			want:  []kv{{"key1", "value1"}, {"key2", "value2"}},
+		},
+		{
+			name:  "empty input",
+			input: "",
+			want:  []kv{},
+		},
+		{
+			name:  "comments and blank lines",
+			input: "# comment\n! other comment\n\n   \t\n  # indented comment\nkey=value",
+			want:  []kv{{"key", "value"}},
+		},
+		{
+			name:  "colon separator",
+			input: "key1:value1\nkey2 : value2",
+			want:  []kv{{"key1", "value1"}, {"key2", "value2"}},
+		},
+		{
+			name:  "whitespace separator",
+			input: "key1 value1\nkey2\t\tvalue2",
+			want:  []kv{{"key1", "value1"}, {"key2", "value2"}},
+		},
+		{
+			name:  "whitespace around separator",
+			input: "  key1   =   value1\nkey2 =:value2",
+			want:  []kv{{"key1", "value1"}, {"key2", ":value2"}},
+		},
+		{
+			name:  "trailing whitespace is kept in values",
+			input: "key=value  ",
+			want:  []kv{{"key", "value  "}},
+		},
+		{
+			name:  "additional separators are part of the value",
+			input: "key1=value1==\nkey2=a:b",
+			want:  []kv{{"key1", "value1=="}, {"key2", "a:b"}},
+		},
+		{
+			name:  "key only",
+			input: "key1\nkey2=\nkey3:",
+			want:  []kv{{"key1", ""}, {"key2", ""}, {"key3", ""}},
+		},
+		{
+			name:  "empty key",
+			input: "=value\n:value2",
+			want:  []kv{{"", "value"}, {"", "value2"}},
+		},
+		{
+			name:  "line continuation",
+			input: "key=first, \\\n    second, \\\n\tthird",
+			want:  []kv{{"key", "first, second, third"}},
+		},
+		{
+			name:  "continuation lines are not comments",
+			input: "key=value\\\n#notacomment",
+			want:  []kv{{"key", "value#notacomment"}},
+		},
+		{
+			name:  "comments are not continued",
+			input: "# comment \\\nkey=value",
+			want:  []kv{{"key", "value"}},
+		},
+		{
+			name:  "even number of trailing backslashes",
+			input: "key1=value\\\\\nkey2=value2",
+			want:  []kv{{"key1", "value\\"}, {"key2", "value2"}},
+		},
+		{
+			name:  "continuation on last line",
+			input: "key=value\\",
+			want:  []kv{{"key", "value"}},
+		},
+		{
+			name:  "escaped separators in key",
+			input: "a\\=b\\:c\\ d=value",
+			want:  []kv{{"a=b:c d", "value"}},
+		},
+		{
+			name:  "escape sequences",
+			input: "key=\\t\\n\\r\\f\\x\\\\",
+			want:  []kv{{"key", "\t\n\r\fx\\"}},
+		},
+		{
+			name:  "unicode escapes",
+			input: "k\\u00e9y=caf\\u00E9\nemoji=\\uD83D\\uDE00",
+			want:  []kv{{"kéy", "café"}, {"emoji", "😀"}},
+		},
+		{
+			name:       "malformed unicode escape",
+			input:      "key1=\\u12\nkey2=\\uXYZW\nkey3=value3",
+			want:       []kv{{"key3", "value3"}},
+			wantSyntax: 2,
+		},
+		{
+			name:  "windows line endings",
+			input: "key1=value1\r\nkey2=value2\rkey3=value3\r\n",
+			want:  []kv{{"key1", "value1"}, {"key2", "value2"}, {"key3", "value3"}},
+		},
+		{
+			name:  "utf-8 content",
+			input: "schlüssel=wört",
+			want:  []kv{{"schlüssel", "wört"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+
+			var syntaxErrors ErrorList
+			if errors.As(err, &syntaxErrors) {
+				if len(syntaxErrors) != tt.wantSyntax {
+					t.Errorf("Parse() syntax errors = %v, want %d", syntaxErrors, tt.wantSyntax)
+				}
+			} else if err != nil || tt.wantSyntax > 0 {
+				t.Fatalf("Parse() error = %v, want %d syntax errors", err, tt.wantSyntax)
+			}
+
+			if !reflect.DeepEqual(keyValues(got), tt.want) {
+				t.Errorf("Parse() = %v, want %v", keyValues(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_lineNumbers(t *testing.T) {
+	input := "# comment\nkey1=a\\\n  b\n\nkey2=\\u00\nkey3=c"
+	got, err := Parse(strings.NewReader(input))
+
+	want := []Property{
+		{Key: "key1", Value: "ab", Line: 2, Raw: "key1=ab"},
+		{Key: "key3", Value: "c", Line: 6, Raw: "key3=c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %v, want %v", got, want)
+	}
+
+	wantErr := ErrorList{{Line: 5, Raw: "key2=\\u00", Msg: "malformed \\uXXXX encoding in '\\u00'"}}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("Parse() error = %#v, want %#v", err, wantErr)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestParse_readerErrors(t *testing.T) {
+	if _, err := Parse(nil); err == nil {
+		t.Error("Parse(nil) expected error")
+	}
+
+	if _, err := Parse(failingReader{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Parse() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
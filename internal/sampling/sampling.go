@@ -0,0 +1,55 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sampling converts integer samples, like the values of /proc files or sql.DBStats, to metric values.
+package sampling
+
+import (
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+)
+
+// Sample is an integer value read from a source. Cumulative samples are converted to deltas. If Divisor is set,
+// the value is divided by it and reported as floating point number.
+type Sample struct {
+	Key        string
+	Value      int64
+	Divisor    float64
+	Cumulative bool
+}
+
+// MetricValue returns the value of the sample as MetricOption. Cumulative samples are converted to deltas using
+// tracker, with seriesKey identifying the series. ok is false for the first value of a cumulative series, which does
+// not produce a delta.
+func (s Sample) MetricValue(tracker *aggregation.CumulativeTracker, seriesKey string) (value metric.MetricOption, ok bool) {
+	v := s.Value
+	if s.Cumulative {
+		delta, ok := tracker.IntDelta(seriesKey, s.Value)
+		if !ok {
+			return nil, false
+		}
+		v = delta
+	}
+
+	switch {
+	case s.Divisor > 0 && s.Cumulative:
+		return metric.WithFloatCounterValueDelta(float64(v) / s.Divisor), true
+	case s.Divisor > 0:
+		return metric.WithFloatGaugeValue(float64(v) / s.Divisor), true
+	case s.Cumulative:
+		return metric.WithIntCounterValueDelta(v), true
+	default:
+		return metric.WithIntGaugeValue(v), true
+	}
+}
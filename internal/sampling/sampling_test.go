@@ -0,0 +1,61 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+)
+
+func TestSample_MetricValue(t *testing.T) {
+	tracker := aggregation.NewCumulativeTracker()
+
+	steps := []struct {
+		name   string
+		sample Sample
+		want   string
+		wantOk bool
+	}{
+		{name: "gauge", sample: Sample{Key: "gauge", Value: 3}, want: "gauge gauge,3", wantOk: true},
+		{name: "divided gauge", sample: Sample{Key: "divided", Value: 3, Divisor: 2}, want: "divided gauge,1.5", wantOk: true},
+		{name: "first counter value", sample: Sample{Key: "counter", Value: 10, Cumulative: true}, wantOk: false},
+		{name: "counter delta", sample: Sample{Key: "counter", Value: 15, Cumulative: true}, want: "counter count,delta=5", wantOk: true},
+		{name: "first divided counter value", sample: Sample{Key: "seconds", Value: 100, Divisor: 100, Cumulative: true}, wantOk: false},
+		{name: "divided counter delta", sample: Sample{Key: "seconds", Value: 350, Divisor: 100, Cumulative: true}, want: "seconds count,delta=2.5", wantOk: true},
+	}
+	for _, step := range steps {
+		value, ok := step.sample.MetricValue(tracker, step.sample.Key)
+		if ok != step.wantOk {
+			t.Fatalf("%s: MetricValue() ok = %v, want %v", step.name, ok, step.wantOk)
+		}
+		if !ok {
+			continue
+		}
+
+		m, err := metric.NewMetric(step.sample.Key, value)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		got, err := m.Serialize()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got != step.want {
+			t.Errorf("%s: MetricValue() serialized as %q, want %q", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8senrichment
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// Dimension keys set by this package.
+const (
+	NamespaceNameDimension = "k8s.namespace.name"
+	PodNameDimension       = "k8s.pod.name"
+	PodUIDDimension        = "k8s.pod.uid"
+	NodeNameDimension      = "k8s.node.name"
+	WorkloadNameDimension  = "k8s.workload.name"
+)
+
+const (
+	defaultPodInfoDir        = "etc/podinfo"
+	defaultServiceAccountDir = "var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// Environment variables that are checked for each dimension, in order of precedence.
+// These have to be set using the downward API in the pod spec.
+var (
+	namespaceEnvVars = []string{"K8S_NAMESPACE_NAME", "POD_NAMESPACE", "KUBERNETES_NAMESPACE"}
+	podNameEnvVars   = []string{"K8S_POD_NAME", "POD_NAME"}
+	podUIDEnvVars    = []string{"K8S_POD_UID", "POD_UID"}
+	nodeNameEnvVars  = []string{"K8S_NODE_NAME", "NODE_NAME"}
+	workloadEnvVars  = []string{"K8S_WORKLOAD_NAME"}
+)
+
+var (
+	// ErrNotKubernetes is returned if neither the environment nor the downward API files contain any Kubernetes metadata.
+	ErrNotKubernetes = errors.New("no Kubernetes metadata found")
+
+	reStatefulSetOrdinal = regexp.MustCompile(`-[0-9]+$`)
+	reDaemonSetSuffix    = regexp.MustCompile(`-[a-z0-9]{5}$`)
+)
+
+// ParseError is returned if one or more lines of the downward API labels or annotations files could not be parsed.
+// All other metadata is still returned alongside this error.
+type ParseError struct {
+	// File is the path of the file within the file system.
+	File string
+	// Lines contains the lines that could not be parsed.
+	Lines []string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("could not parse line(s) '%s' in '%s'", strings.Join(e.Lines, "', '"), e.File)
+}
+
+// Option represents the function interface used to configure how Kubernetes metadata is read.
+type Option func(c *config)
+
+type config struct {
+	podInfoDir        string
+	serviceAccountDir string
+	lookupEnv         func(string) (string, bool)
+	labelMapping      map[string]string
+	annotationMapping map[string]string
+}
+
+// WithPodInfoDir sets the directory in which the downward API volume is mounted, relative to the root of the file system.
+// The files "namespace", "name", "uid", "nodename", "labels" and "annotations" are read from this directory, if they exist.
+// Defaults to "etc/podinfo".
+func WithPodInfoDir(dir string) Option {
+	return func(c *config) {
+		c.podInfoDir = dir
+	}
+}
+
+// WithServiceAccountDir sets the directory of the mounted service account, relative to the root of the file system.
+// The "namespace" file in this directory is used if the namespace is not available otherwise.
+// Defaults to "var/run/secrets/kubernetes.io/serviceaccount".
+func WithServiceAccountDir(dir string) Option {
+	return func(c *config) {
+		c.serviceAccountDir = dir
+	}
+}
+
+// WithLookupEnv sets the function used to read environment variables. Defaults to os.LookupEnv.
+func WithLookupEnv(lookupEnv func(string) (string, bool)) Option {
+	return func(c *config) {
+		c.lookupEnv = lookupEnv
+	}
+}
+
+// WithLabelMapping sets pod labels that are added as dimensions. The keys of the map are label keys, the values are
+// the dimension keys they are mapped to. Labels not contained in the mapping are ignored.
+func WithLabelMapping(mapping map[string]string) Option {
+	return func(c *config) {
+		c.labelMapping = mapping
+	}
+}
+
+// WithAnnotationMapping sets pod annotations that are added as dimensions, in the same way as WithLabelMapping.
+func WithAnnotationMapping(mapping map[string]string) Option {
+	return func(c *config) {
+		c.annotationMapping = mapping
+	}
+}
+
+// GetKubernetesMetadataFrom reads the Kubernetes metadata from the environment and the downward API files in fsys
+// and returns them as NormalizedDimensionList. Environment variables take precedence over files.
+// If no metadata is found at all, an empty list and ErrNotKubernetes are returned.
+// If the labels or annotations files cannot be parsed completely, all other dimensions are returned together with a
+// *ParseError.
+func GetKubernetesMetadataFrom(fsys fs.FS, opts ...Option) (dimensions.NormalizedDimensionList, error) {
+	c := config{
+		podInfoDir:        defaultPodInfoDir,
+		serviceAccountDir: defaultServiceAccountDir,
+		lookupEnv:         os.LookupEnv,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	labels, labelsErr := readKeyValueFile(fsys, path.Join(c.podInfoDir, "labels"))
+	if labelsErr != nil && !isParseError(labelsErr) {
+		return dimensions.NewNormalizedDimensionList(), labelsErr
+	}
+	annotations, annotationsErr := readKeyValueFile(fsys, path.Join(c.podInfoDir, "annotations"))
+	if annotationsErr != nil && !isParseError(annotationsErr) {
+		return dimensions.NewNormalizedDimensionList(), annotationsErr
+	}
+
+	namespace := firstNonEmpty(
+		lookupFirst(c.lookupEnv, namespaceEnvVars),
+		readSingleValueFile(fsys, path.Join(c.podInfoDir, "namespace")),
+		readSingleValueFile(fsys, path.Join(c.serviceAccountDir, "namespace")),
+	)
+	podName := firstNonEmpty(
+		lookupFirst(c.lookupEnv, podNameEnvVars),
+		readSingleValueFile(fsys, path.Join(c.podInfoDir, "name")),
+	)
+	podUID := firstNonEmpty(
+		lookupFirst(c.lookupEnv, podUIDEnvVars),
+		readSingleValueFile(fsys, path.Join(c.podInfoDir, "uid")),
+	)
+	nodeName := firstNonEmpty(
+		lookupFirst(c.lookupEnv, nodeNameEnvVars),
+		readSingleValueFile(fsys, path.Join(c.podInfoDir, "nodename")),
+	)
+	workloadName := firstNonEmpty(
+		lookupFirst(c.lookupEnv, workloadEnvVars),
+		deriveWorkloadName(podName, labels),
+	)
+
+	dims := []dimensions.Dimension{}
+	dims = appendIfSet(dims, NamespaceNameDimension, namespace)
+	dims = appendIfSet(dims, PodNameDimension, podName)
+	dims = appendIfSet(dims, PodUIDDimension, podUID)
+	dims = appendIfSet(dims, NodeNameDimension, nodeName)
+	dims = appendIfSet(dims, WorkloadNameDimension, workloadName)
+	dims = appendMapped(dims, labels, c.labelMapping)
+	dims = appendMapped(dims, annotations, c.annotationMapping)
+
+	if len(dims) == 0 && len(labels) == 0 && len(annotations) == 0 && labelsErr == nil && annotationsErr == nil {
+		return dimensions.NewNormalizedDimensionList(), ErrNotKubernetes
+	}
+
+	list := dimensions.NewNormalizedDimensionList(dims...)
+	if labelsErr != nil {
+		return list, labelsErr
+	}
+	return list, annotationsErr
+}
+
+// GetKubernetesMetadata reads the Kubernetes metadata from the environment and the downward API files
+// and returns them as NormalizedDimensionList.
+func GetKubernetesMetadata(opts ...Option) dimensions.NormalizedDimensionList {
+	dims, err := GetKubernetesMetadataFrom(os.DirFS("/"), opts...)
+	if err != nil {
+		if errors.Is(err, ErrNotKubernetes) {
+			logging.GetLogger().Infof("Could not read Kubernetes metadata. This is normal if the process is not running in a Kubernetes pod.")
+		} else {
+			logging.GetLogger().Warnf("Could not read Kubernetes metadata: %v", err)
+		}
+	}
+
+	return dims
+}
+
+func isParseError(err error) bool {
+	var parseErr *ParseError
+	return errors.As(err, &parseErr)
+}
+
+func lookupFirst(lookupEnv func(string) (string, bool), names []string) string {
+	for _, name := range names {
+		if value, ok := lookupEnv(name); ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func appendIfSet(dims []dimensions.Dimension, key, value string) []dimensions.Dimension {
+	if value == "" {
+		return dims
+	}
+	return append(dims, dimensions.NewDimension(key, value))
+}
+
+// appendMapped adds all values with a key in the mapping. Dimensions are added in the order of the source keys
+// to keep the output stable.
+func appendMapped(dims []dimensions.Dimension, values map[string]string, mapping map[string]string) []dimensions.Dimension {
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		if _, ok := values[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		dims = appendIfSet(dims, mapping[key], values[key])
+	}
+	return dims
+}
+
+// readSingleValueFile returns the trimmed content of a file, or an empty string if it cannot be read.
+func readSingleValueFile(fsys fs.FS, name string) string {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// readKeyValueFile reads a downward API labels or annotations file, in which each line has the format key="value".
+// The value is quoted and escaped like a Go string literal. A missing file results in an empty map.
+func readKeyValueFile(fsys fs.FS, name string) (map[string]string, error) {
+	result := map[string]string{}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return result, nil
+		}
+		return result, err
+	}
+	defer file.Close()
+
+	invalid := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		split := strings.SplitN(line, "=", 2)
+		if len(split) != 2 || split[0] == "" {
+			invalid = append(invalid, line)
+			continue
+		}
+
+		value, err := strconv.Unquote(split[1])
+		if err != nil {
+			invalid = append(invalid, line)
+			continue
+		}
+
+		result[split[0]] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	if len(invalid) > 0 {
+		return result, &ParseError{File: name, Lines: invalid}
+	}
+	return result, nil
+}
+
+// deriveWorkloadName uses the labels that are set by the Kubernetes controllers to find the name of the workload
+// that owns the pod. Returns an empty string if the workload cannot be determined.
+func deriveWorkloadName(podName string, labels map[string]string) string {
+	// Jobs (and thereby CronJobs) label their pods with the job name.
+	if jobName := firstNonEmpty(labels["batch.kubernetes.io/job-name"], labels["job-name"]); jobName != "" {
+		return jobName
+	}
+
+	if podName == "" {
+		return ""
+	}
+
+	// Deployments: <deployment>-<pod-template-hash>-<random suffix>
+	if hash, ok := labels["pod-template-hash"]; ok && hash != "" {
+		if index := strings.LastIndex(podName, "-"+hash+"-"); index > 0 {
+			return podName[:index]
+		}
+	}
+
+	// StatefulSets: <statefulset>-<ordinal>
+	if labels["statefulset.kubernetes.io/pod-name"] == podName {
+		if loc := reStatefulSetOrdinal.FindStringIndex(podName); loc != nil && loc[0] > 0 {
+			return podName[:loc[0]]
+		}
+	}
+
+	// DaemonSets: <daemonset>-<random suffix>
+	if _, ok := labels["controller-revision-hash"]; ok {
+		if loc := reDaemonSetSuffix.FindStringIndex(podName); loc != nil && loc[0] > 0 {
+			return podName[:loc[0]]
+		}
+	}
+
+	return ""
+}
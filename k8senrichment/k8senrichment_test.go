@@ -0,0 +1,219 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8senrichment
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func TestGetKubernetesMetadataFrom(t *testing.T) {
+	fsys := os.DirFS("testdata")
+	noEnv := WithLookupEnv(envFrom(nil))
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		want      dimensions.NormalizedDimensionList
+		wantErrIs error
+		wantParse bool
+	}{
+		{
+			name: "downward API files",
+			opts: []Option{noEnv, WithPodInfoDir("podinfo")},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(NamespaceNameDimension, "shop"),
+				dimensions.NewDimension(PodNameDimension, "checkout-5d8c7f9b6-x2x7q"),
+				dimensions.NewDimension(PodUIDDimension, "3f6a8e2c-1d0b-4b8e-9c1a-2f4d6e8a0b1c"),
+				dimensions.NewDimension(NodeNameDimension, "worker-node-3"),
+				dimensions.NewDimension(WorkloadNameDimension, "checkout"),
+			),
+		},
+		{
+			name: "label and annotation mapping",
+			opts: []Option{
+				noEnv,
+				WithPodInfoDir("podinfo"),
+				WithLabelMapping(map[string]string{
+					"app.kubernetes.io/version": "service.version",
+					"team":                      "team",
+					"not-set":                   "not_set",
+				}),
+				WithAnnotationMapping(map[string]string{"owner": "owner"}),
+			},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(NamespaceNameDimension, "shop"),
+				dimensions.NewDimension(PodNameDimension, "checkout-5d8c7f9b6-x2x7q"),
+				dimensions.NewDimension(PodUIDDimension, "3f6a8e2c-1d0b-4b8e-9c1a-2f4d6e8a0b1c"),
+				dimensions.NewDimension(NodeNameDimension, "worker-node-3"),
+				dimensions.NewDimension(WorkloadNameDimension, "checkout"),
+				dimensions.NewDimension("service.version", "1.4.2"),
+				dimensions.NewDimension("team", `payments "core"`),
+				dimensions.NewDimension("owner", "payments@example.com"),
+			),
+		},
+		{
+			name: "environment takes precedence over files",
+			opts: []Option{
+				WithPodInfoDir("podinfo"),
+				WithLookupEnv(envFrom(map[string]string{
+					"POD_NAMESPACE":     "env-namespace",
+					"K8S_POD_NAME":      "env-pod",
+					"POD_NAME":          "ignored",
+					"K8S_NODE_NAME":     "  env-node  ",
+					"K8S_WORKLOAD_NAME": "env-workload",
+				})),
+			},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(NamespaceNameDimension, "env-namespace"),
+				dimensions.NewDimension(PodNameDimension, "env-pod"),
+				dimensions.NewDimension(PodUIDDimension, "3f6a8e2c-1d0b-4b8e-9c1a-2f4d6e8a0b1c"),
+				dimensions.NewDimension(NodeNameDimension, "env-node"),
+				dimensions.NewDimension(WorkloadNameDimension, "env-workload"),
+			),
+		},
+		{
+			name: "environment only",
+			opts: []Option{
+				WithPodInfoDir("does-not-exist"),
+				WithServiceAccountDir("does-not-exist"),
+				WithLookupEnv(envFrom(map[string]string{
+					"KUBERNETES_NAMESPACE": "namespace",
+					"POD_NAME":             "pod",
+					"POD_UID":              "uid",
+					"NODE_NAME":            "node",
+				})),
+			},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(NamespaceNameDimension, "namespace"),
+				dimensions.NewDimension(PodNameDimension, "pod"),
+				dimensions.NewDimension(PodUIDDimension, "uid"),
+				dimensions.NewDimension(NodeNameDimension, "node"),
+			),
+		},
+		{
+			name: "namespace from service account",
+			opts: []Option{noEnv, WithPodInfoDir("podinfo_statefulset"), WithServiceAccountDir("serviceaccount")},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(NamespaceNameDimension, "shop-from-serviceaccount"),
+				dimensions.NewDimension(PodNameDimension, "postgres-2"),
+				dimensions.NewDimension(WorkloadNameDimension, "postgres"),
+			),
+		},
+		{
+			name: "invalid labels",
+			opts: []Option{
+				noEnv,
+				WithPodInfoDir("podinfo_invalid"),
+				WithLabelMapping(map[string]string{"app.kubernetes.io/name": "app"}),
+			},
+			want:      dimensions.NewNormalizedDimensionList(dimensions.NewDimension("app", "checkout")),
+			wantParse: true,
+		},
+		{
+			name: "not running in Kubernetes",
+			opts: []Option{
+				noEnv,
+				WithPodInfoDir("does-not-exist"),
+				WithServiceAccountDir("does-not-exist"),
+			},
+			want:      dimensions.NewNormalizedDimensionList(),
+			wantErrIs: ErrNotKubernetes,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetKubernetesMetadataFrom(fsys, tt.opts...)
+			wantErr := tt.wantErrIs != nil || tt.wantParse
+			if (err != nil) != wantErr {
+				t.Fatalf("GetKubernetesMetadataFrom() error = %v, wantErr %v", err, wantErr)
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("GetKubernetesMetadataFrom() error = %v, want %v", err, tt.wantErrIs)
+			}
+			var parseErr *ParseError
+			if tt.wantParse && !errors.As(err, &parseErr) {
+				t.Errorf("GetKubernetesMetadataFrom() error = %v, want *ParseError", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetKubernetesMetadataFrom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_deriveWorkloadName(t *testing.T) {
+	tests := []struct {
+		name    string
+		podName string
+		labels  map[string]string
+		want    string
+	}{
+		{
+			name:    "deployment",
+			podName: "my-app-5d8c7f9b6-x2x7q",
+			labels:  map[string]string{"pod-template-hash": "5d8c7f9b6"},
+			want:    "my-app",
+		},
+		{
+			name:    "statefulset",
+			podName: "db-12",
+			labels:  map[string]string{"statefulset.kubernetes.io/pod-name": "db-12", "controller-revision-hash": "db-6c8d"},
+			want:    "db",
+		},
+		{
+			name:    "daemonset",
+			podName: "node-exporter-4kz9p",
+			labels:  map[string]string{"controller-revision-hash": "7f8d9c"},
+			want:    "node-exporter",
+		},
+		{
+			name:    "job",
+			podName: "backup-28345-abcde",
+			labels:  map[string]string{"job-name": "backup-28345"},
+			want:    "backup-28345",
+		},
+		{
+			name:    "bare pod",
+			podName: "debug",
+			labels:  map[string]string{},
+			want:    "",
+		},
+		{
+			name:    "hash not part of the pod name",
+			podName: "my-app-x2x7q",
+			labels:  map[string]string{"pod-template-hash": "5d8c7f9b6"},
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deriveWorkloadName(tt.podName, tt.labels); got != tt.want {
+				t.Errorf("deriveWorkloadName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides the Logger the library writes its messages to. By default, messages are written to the
+// standard logger of the log package. Use SetLogger to route them to another logging library, or to silence them
+// with NewNopLogger.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Logger receives the messages of the library.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+var (
+	mu     sync.RWMutex
+	logger Logger = NewStdLogger(log.Default())
+)
+
+// SetLogger sets the Logger used by all packages of the library. Passing nil silences the library.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = NewNopLogger()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	logger = l
+}
+
+// GetLogger returns the Logger used by all packages of the library.
+func GetLogger() Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+	return logger
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger creates a Logger that writes to l, prefixing every message with its level. Debug messages are dropped.
+func NewStdLogger(l *log.Logger) Logger {
+	return stdLogger{l: l}
+}
+
+func (s stdLogger) Debugf(format string, args ...interface{}) {}
+
+func (s stdLogger) Infof(format string, args ...interface{}) {
+	s.l.Print(fmt.Sprintf(format, args...))
+}
+
+func (s stdLogger) Warnf(format string, args ...interface{}) {
+	s.l.Print("WARN: " + fmt.Sprintf(format, args...))
+}
+
+func (s stdLogger) Errorf(format string, args ...interface{}) {
+	s.l.Print("ERROR: " + fmt.Sprintf(format, args...))
+}
+
+type nopLogger struct{}
+
+// NewNopLogger creates a Logger that drops all messages.
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Infof(format string, args ...interface{})  {}
+func (nopLogger) Warnf(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+// Throttle lets the first of every n events pass, e.g. to log a message that can occur very often only once in a
+// while. It is safe for concurrent use.
+type Throttle struct {
+	n       uint32
+	counter uint32
+}
+
+// NewThrottle creates a Throttle that lets one of every n events pass. An n below 2 lets all events pass.
+func NewThrottle(n uint32) *Throttle {
+	return &Throttle{n: n}
+}
+
+// Allow records an event and returns true if it is the first of n events.
+func (t *Throttle) Allow() bool {
+	if t.n < 2 {
+		return true
+	}
+
+	for {
+		current := atomic.LoadUint32(&t.counter)
+		next := current + 1
+		if next == t.n {
+			next = 0
+		}
+		if atomic.CompareAndSwapUint32(&t.counter, current, next) {
+			return current == 0
+		}
+	}
+}
+
+type rateLimitedLogger struct {
+	logger   func() Logger
+	throttle *Throttle
+}
+
+// NewRateLimitedLogger creates a Logger that passes only the first of every n messages, across all levels, to the
+// Logger of the library that is set at the time of the message. Use one rate-limited logger per kind of message.
+func NewRateLimitedLogger(n uint32) Logger {
+	return rateLimitedLogger{logger: GetLogger, throttle: NewThrottle(n)}
+}
+
+func (r rateLimitedLogger) Debugf(format string, args ...interface{}) {
+	if r.throttle.Allow() {
+		r.logger().Debugf(format, args...)
+	}
+}
+
+func (r rateLimitedLogger) Infof(format string, args ...interface{}) {
+	if r.throttle.Allow() {
+		r.logger().Infof(format, args...)
+	}
+}
+
+func (r rateLimitedLogger) Warnf(format string, args ...interface{}) {
+	if r.throttle.Allow() {
+		r.logger().Warnf(format, args...)
+	}
+}
+
+func (r rateLimitedLogger) Errorf(format string, args ...interface{}) {
+	if r.throttle.Allow() {
+		r.logger().Errorf(format, args...)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordingLogger records all messages prefixed with their level.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *recordingLogger) record(level, format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (r *recordingLogger) Debugf(format string, args ...interface{}) {
+	r.record("debug", format, args...)
+}
+func (r *recordingLogger) Infof(format string, args ...interface{}) {
+	r.record("info", format, args...)
+}
+func (r *recordingLogger) Warnf(format string, args ...interface{}) {
+	r.record("warn", format, args...)
+}
+func (r *recordingLogger) Errorf(format string, args ...interface{}) {
+	r.record("error", format, args...)
+}
+
+func useLogger(t *testing.T, l Logger) {
+	previous := GetLogger()
+	SetLogger(l)
+	t.Cleanup(func() { SetLogger(previous) })
+}
+
+func TestSetLogger(t *testing.T) {
+	recorder := &recordingLogger{}
+	useLogger(t, recorder)
+
+	GetLogger().Debugf("a %d", 1)
+	GetLogger().Infof("b %d", 2)
+	GetLogger().Warnf("c %d", 3)
+	GetLogger().Errorf("d %d", 4)
+
+	want := []string{"debug a 1", "info b 2", "warn c 3", "error d 4"}
+	if !reflect.DeepEqual(recorder.messages, want) {
+		t.Errorf("messages = %v, want %v", recorder.messages, want)
+	}
+
+	SetLogger(nil)
+	if _, ok := GetLogger().(nopLogger); !ok {
+		t.Errorf("GetLogger() after SetLogger(nil) = %T, want no-op logger", GetLogger())
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0))
+
+	l.Debugf("debug %s", "message")
+	l.Infof("info %s", "message")
+	l.Warnf("warn %s", "message")
+	l.Errorf("error %s", "message")
+
+	want := "info message\nWARN: warn message\nERROR: error message\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		name string
+		n    uint32
+		want []bool
+	}{
+		{name: "every third", n: 3, want: []bool{true, false, false, true, false, false, true}},
+		{name: "one", n: 1, want: []bool{true, true, true}},
+		{name: "zero", n: 0, want: []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := NewThrottle(tt.n)
+			got := make([]bool, 0, len(tt.want))
+			for range tt.want {
+				got = append(got, throttle.Allow())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottle_Concurrent(t *testing.T) {
+	throttle := NewThrottle(10)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if throttle.Allow() {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 100 {
+		t.Errorf("allowed = %d, want 100", allowed)
+	}
+}
+
+func TestRateLimitedLogger(t *testing.T) {
+	l := NewRateLimitedLogger(2)
+
+	first := &recordingLogger{}
+	useLogger(t, first)
+	l.Warnf("message %d", 1)
+	l.Warnf("message %d", 2)
+	l.Errorf("message %d", 3)
+
+	// the rate-limited logger writes to the logger that is set at the time of the message.
+	second := &recordingLogger{}
+	SetLogger(second)
+	l.Infof("message %d", 4)
+	l.Debugf("message %d", 5)
+
+	if want := []string{"warn message 1", "error message 3"}; !reflect.DeepEqual(first.messages, want) {
+		t.Errorf("messages = %v, want %v", first.messages, want)
+	}
+	if want := []string{"debug message 5"}; !reflect.DeepEqual(second.messages, want) {
+		t.Errorf("messages = %v, want %v", second.messages, want)
+	}
+}
@@ -3,6 +3,7 @@ package apiconstants
 const (
 	defaultOneAgentEndpoint = "http://localhost:14499/metrics/ingest"
 	payloadLinesLimit       = 1000
+	defaultOneAgentStatsD   = "localhost:18125"
 )
 
 // GetDefaultOneAgentEndpoint returns the default OneAgent metrics ingest endpoint.
@@ -15,3 +16,9 @@ func GetDefaultOneAgentEndpoint() string {
 func GetPayloadLinesLimit() int {
 	return payloadLinesLimit
 }
+
+// GetDefaultOneAgentStatsDAddress returns the default address of the OneAgent StatsD listener.
+// See the Dynatrace documentation (https://www.dynatrace.com/support/help/how-to-use-dynatrace/metrics/metric-ingestion/ingestion-methods/statsd/) for more information.
+func GetDefaultOneAgentStatsDAddress() string {
+	return defaultOneAgentStatsD
+}
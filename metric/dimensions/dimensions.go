@@ -15,11 +15,25 @@
 package dimensions
 
 import (
-	"log"
+	"sync/atomic"
 
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
 	"github.com/dynatrace-oss/dynatrace-metric-utils-go/normalize"
 )
 
+var dimensionsDropped uint64
+
+// Stats holds the number of dimensions normalized since the start of the process.
+type Stats struct {
+	// DimensionsDropped is the number of dimensions that were dropped, because their key was invalid after normalization.
+	DimensionsDropped uint64
+}
+
+// GetStats returns the normalization statistics of all dimension lists.
+func GetStats() Stats {
+	return Stats{DimensionsDropped: atomic.LoadUint64(&dimensionsDropped)}
+}
+
 // Dimension is a key-value pair mapping string to string.
 type Dimension struct {
 	Key   string
@@ -59,7 +73,8 @@ func normalizeDimensions(dims ...Dimension) []Dimension {
 	for _, dim := range dims {
 		k, err := normalize.DimensionKey(dim.Key)
 		if err != nil {
-			log.Printf("normalization for '%s' returned invalid key. Skipping...", dim.Key)
+			atomic.AddUint64(&dimensionsDropped, 1)
+			logging.GetLogger().Warnf("normalization for '%s' returned invalid key. Skipping...", dim.Key)
 			continue
 		}
 
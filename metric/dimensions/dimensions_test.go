@@ -222,6 +222,16 @@ func TestMergeSets(t *testing.T) {
 	}
 }
 
+func TestGetStats(t *testing.T) {
+	before := GetStats().DimensionsDropped
+
+	NewNormalizedDimensionList(NewDimension("valid", "a"), NewDimension("", "b"), NewDimension("", "c"))
+
+	if got := GetStats().DimensionsDropped - before; got != 2 {
+		t.Errorf("DimensionsDropped increased by %d, want 2", got)
+	}
+}
+
 func sortedDeepEqual(got, want NormalizedDimensionList) bool {
 	if len(got.dimensions) != len(want.dimensions) {
 		return false
@@ -17,12 +17,11 @@ package metric
 import (
 	"errors"
 	"fmt"
-	"log"
 	"math"
 	"strings"
-	"sync/atomic"
 	"time"
 
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
 	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
 	"github.com/dynatrace-oss/dynatrace-metric-utils-go/serialize"
 )
@@ -34,7 +33,8 @@ const (
 	metricLineMaxLength = 50_000
 )
 
-var timestampWarningCounter uint32 = 0
+// timestampWarningLogger logs only one of every timestampWarningThrottleFactor timestamp warnings.
+var timestampWarningLogger = logging.NewRateLimitedLogger(timestampWarningThrottleFactor)
 
 // Metric contains all information needed to create a string representation of the accumulated metric data.
 type Metric struct {
@@ -43,6 +43,8 @@ type Metric struct {
 	value      metricValue
 	dimensions dimensions.NormalizedDimensionList
 	timestamp  time.Time
+	// withoutStats excludes the metric from GetStats.
+	withoutStats bool
 }
 
 // MetricOption represents the function interface used to set options on the metric object.
@@ -100,9 +102,11 @@ func ensureFloatsAreValid(values ...float64) error {
 func (m Metric) Serialize() (string, error) {
 	keyString, err := serialize.MetricKey(m.metricKey, m.prefix)
 	if err != nil {
+		m.count(&rejectedInvalidKey)
 		return "", err
 	}
 	if m.value == nil {
+		m.count(&rejectedNoValue)
 		return "", errors.New("cannot serialize nil value")
 	}
 
@@ -112,13 +116,16 @@ func (m Metric) Serialize() (string, error) {
 
 	metricLine, err := joinStrings(keyString, dimString, valueString, timeString)
 	if err != nil {
+		m.count(&rejectedSerializationFailed)
 		return "", err
 	}
 
 	if len(metricLine) > metricLineMaxLength {
+		m.count(&rejectedTooLong)
 		return "", fmt.Errorf("serialized line exceeds limit of %d characters accepted by the ingest API. Metric name: '%s'", metricLineMaxLength, keyString)
 	}
 
+	m.count(&linesSerialized)
 	return metricLine, nil
 }
 
@@ -261,16 +268,10 @@ func WithFloatGaugeValue(val float64) MetricOption {
 func WithTimestamp(t time.Time) MetricOption {
 	return func(m *Metric) error {
 		if t.Year() < 2000 || t.Year() > 3000 {
-			currentTimestampWarningCounter := atomic.AddUint32(&timestampWarningCounter, 1)
-			if currentTimestampWarningCounter == 1 {
-				log.Printf("Order of magnitude of the timestamp seems off (%s). "+
-					"The timestamp represents a time before the year 2000 or after the year 3000. "+
-					"Skipping setting timestamp, the current server time will be added upon ingestion. "+
-					"Only one out of every %d of these messages will be printed.", t.String(), timestampWarningThrottleFactor)
-			}
-			if currentTimestampWarningCounter == timestampWarningThrottleFactor {
-				atomic.StoreUint32(&timestampWarningCounter, 0)
-			}
+			timestampWarningLogger.Warnf("Order of magnitude of the timestamp seems off (%s). "+
+				"The timestamp represents a time before the year 2000 or after the year 3000. "+
+				"Skipping setting timestamp, the current server time will be added upon ingestion. "+
+				"Only one out of every %d of these messages will be printed.", t, timestampWarningThrottleFactor)
 
 			m.timestamp = time.Time{}
 			return nil
@@ -0,0 +1,76 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import "sync/atomic"
+
+// RejectReason describes why Serialize did not return a line.
+type RejectReason string
+
+const (
+	// RejectInvalidKey is reported if the metric key is invalid after normalization.
+	RejectInvalidKey RejectReason = "invalid_key"
+	// RejectMissingValue is reported if the metric has no value.
+	RejectMissingValue RejectReason = "missing_value"
+	// RejectLineTooLong is reported if the line exceeds the length accepted by the ingest API.
+	RejectLineTooLong RejectReason = "line_too_long"
+	// RejectSerializationFailed is reported if the serialized parts of the metric could not be joined to a line.
+	RejectSerializationFailed RejectReason = "serialization_failed"
+)
+
+var (
+	linesSerialized             uint64
+	rejectedInvalidKey          uint64
+	rejectedNoValue             uint64
+	rejectedTooLong             uint64
+	rejectedSerializationFailed uint64
+)
+
+// Stats holds the number of lines serialized by all metrics since the start of the process.
+type Stats struct {
+	// LinesSerialized is the number of lines returned by Serialize. Metrics created WithoutStats are not counted.
+	LinesSerialized uint64
+	// LinesRejected is the number of errors returned by Serialize, by reason.
+	LinesRejected map[RejectReason]uint64
+}
+
+// GetStats returns the serialization statistics of all metrics.
+func GetStats() Stats {
+	return Stats{
+		LinesSerialized: atomic.LoadUint64(&linesSerialized),
+		LinesRejected: map[RejectReason]uint64{
+			RejectInvalidKey:          atomic.LoadUint64(&rejectedInvalidKey),
+			RejectMissingValue:        atomic.LoadUint64(&rejectedNoValue),
+			RejectLineTooLong:         atomic.LoadUint64(&rejectedTooLong),
+			RejectSerializationFailed: atomic.LoadUint64(&rejectedSerializationFailed),
+		},
+	}
+}
+
+// WithoutStats excludes the metric from the statistics returned by GetStats. Use it for metrics that report these
+// statistics, which would otherwise count themselves.
+func WithoutStats() MetricOption {
+	return func(m *Metric) error {
+		m.withoutStats = true
+		return nil
+	}
+}
+
+// count increments the counter, unless the metric is excluded from the statistics.
+func (m Metric) count(counter *uint64) {
+	if !m.withoutStats {
+		atomic.AddUint64(counter, 1)
+	}
+}
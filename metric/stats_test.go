@@ -0,0 +1,64 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestGetStats(t *testing.T) {
+	before := GetStats()
+
+	valid, err := NewMetric("valid", WithIntGaugeValue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NewMetric rejects empty keys, so the metric is created directly.
+	invalidKey := &Metric{value: intGaugeValue{value: 1}}
+	dims := []dimensions.Dimension{}
+	for i := 0; i < 300; i++ {
+		dims = append(dims, dimensions.NewDimension("dim"+strconv.Itoa(i), strings.Repeat("v", 250)))
+	}
+	tooLong, err := NewMetric("long", WithIntGaugeValue(1), WithDimensions(dimensions.NewNormalizedDimensionList(dims...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	excluded, err := NewMetric("excluded", WithIntGaugeValue(1), WithoutStats())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []Metric{*valid, *valid, *excluded, *invalidKey, *tooLong, {metricKey: "novalue"}} {
+		_, _ = m.Serialize()
+	}
+
+	after := GetStats()
+	if got := after.LinesSerialized - before.LinesSerialized; got != 2 {
+		t.Errorf("LinesSerialized increased by %d, want 2", got)
+	}
+	for _, reason := range []RejectReason{RejectInvalidKey, RejectLineTooLong, RejectMissingValue} {
+		if got := after.LinesRejected[reason] - before.LinesRejected[reason]; got != 1 {
+			t.Errorf("LinesRejected[%s] increased by %d, want 1", reason, got)
+		}
+	}
+	if _, ok := after.LinesRejected[RejectSerializationFailed]; !ok {
+		t.Errorf("LinesRejected is missing reason %s", RejectSerializationFailed)
+	}
+}
@@ -18,15 +18,60 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	"os"
 	"strings"
 
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/properties"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
 	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
 )
 
 const indirectionFilename = "dt_metadata_e617c525669e072eebe3d0f08212e8f2.properties"
 
+var (
+	// ErrNoOneAgent is returned if the indirection file cannot be found. This is the case if no OneAgent is installed,
+	// or if the indirection is not supported on the current platform (e.g. on Linux).
+	ErrNoOneAgent = errors.New("OneAgent metadata indirection file not found")
+	// ErrIndirectionFileEmpty is returned if the indirection file exists but does not contain the name of the metadata file.
+	ErrIndirectionFileEmpty = errors.New("OneAgent metadata indirection file is empty")
+	// ErrTargetMissing is returned if the metadata file referenced by the indirection file does not exist.
+	ErrTargetMissing = errors.New("OneAgent metadata file referenced by the indirection file not found")
+)
+
+// ParseError is returned if one or more lines of the metadata file could not be parsed.
+// All lines that could be parsed are still returned alongside this error.
+type ParseError struct {
+	// Lines contains the lines that could not be parsed.
+	Lines []string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("could not parse OneAgent metadata line(s) '%s'", strings.Join(e.Lines, "', '"))
+}
+
+// Option represents the function interface used to configure how OneAgent metadata is read.
+type Option func(c *config)
+
+type config struct {
+	indirectionFilename string
+}
+
+// WithIndirectionFilename overrides the name of the indirection file that is opened on the passed file system.
+func WithIndirectionFilename(name string) Option {
+	return func(c *config) {
+		c.indirectionFilename = name
+	}
+}
+
+// osFS opens files directly using os.Open. In contrast to os.DirFS, it does not restrict the file names
+// to relative paths, which is required since the indirection file contains an absolute path.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
 // readIndirectionFile reads the first line from the Reader and returns it
 // or an error if there was a problem while reading.
 func readIndirectionFile(reader io.Reader) (string, error) {
@@ -46,110 +91,121 @@ func readIndirectionFile(reader io.Reader) (string, error) {
 	return indirectionFilename, nil
 }
 
-// readMetadataFile reads the actual OneAgent metadata file from the passed Reader, discarding empty lines.
-func readMetadataFile(reader io.Reader) ([]string, error) {
-	if reader == nil {
-		return nil, errors.New("reader cannot be nil")
-	}
-
-	scanner := bufio.NewScanner(reader)
-	lines := []string{}
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			lines = append(lines, line)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-	return lines, nil
-}
-
 // readOneAgentMetadata takes the name of the properties file. It then reads the indirection file
-// to get the name of the actual metadata file. That file is then read and parsed into an array of strings,
-// which represent the lines of that file. Errors from function calls inside this function are passed on to the caller.
-func readOneAgentMetadata(indirectionFileName string) ([]string, error) {
+// from the passed file system to get the name of the actual metadata file. That file is then parsed into a
+// NormalizedDimensionList. Missing or empty files are reported using ErrNoOneAgent, ErrIndirectionFileEmpty
+// and ErrTargetMissing together with an empty list, other errors are passed on to the caller.
+func readOneAgentMetadata(fsys fs.FS, indirectionFileName string) (dimensions.NormalizedDimensionList, error) {
 	// Currently, this only works on Windows hosts, since the indirection on Linux
 	// is based on libc. As Go does not use libc to open files, this doesnt currently
 	// work on Linux hosts.
-	indirection, err := os.Open(indirectionFileName)
+	indirection, err := fsys.Open(indirectionFileName)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return dimensions.NewNormalizedDimensionList(), fmt.Errorf("%w: %v", ErrNoOneAgent, err)
+		}
 		// an error occurred during opening of the file
-		return nil, err
+		return dimensions.NewNormalizedDimensionList(), err
 	}
 	defer indirection.Close()
 
 	filename, err := readIndirectionFile(indirection)
 	if err != nil {
 		// an error occurred during reading of the file
-		return nil, err
+		return dimensions.NewNormalizedDimensionList(), err
 	}
 
 	if filename == "" {
-		return nil, errors.New("metadata file name is empty")
+		return dimensions.NewNormalizedDimensionList(), ErrIndirectionFileEmpty
 	}
 
-	metadataFile, err := os.Open(filename)
+	metadataFile, err := fsys.Open(filename)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return dimensions.NewNormalizedDimensionList(), fmt.Errorf("%w: %v", ErrTargetMissing, err)
+		}
 		// an error occurred during opening of the file
-		return nil, err
+		return dimensions.NewNormalizedDimensionList(), err
 	}
+	defer metadataFile.Close()
 
-	content, err := readMetadataFile(metadataFile)
-
-	if err != nil {
-		// an error occurred during reading of the file
-		return nil, err
-	}
-
-	return content, nil
+	return asNormalizedDimensionList(metadataFile)
 }
 
-// parseOneAgentMetadata transforms lines into key-value pairs and discards
-// pairs that do not conform to the 'key=value' (trailing additional equal signs are added to
-// the value)
-func parseOneAgentMetadata(lines []string) []dimensions.Dimension {
+// parseOneAgentMetadata reads the passed Reader as Java properties and transforms them into key-value pairs.
+// Comments and blank lines are skipped, and properties with an empty key or value are discarded.
+// Discarded lines are reported in a *ParseError.
+func parseOneAgentMetadata(reader io.Reader) ([]dimensions.Dimension, error) {
 	result := []dimensions.Dimension{}
-	for _, line := range lines {
-		split := strings.SplitN(line, "=", 2)
-		if len(split) != 2 {
-			log.Println(fmt.Sprintf("Could not parse OneAgent metadata line '%s'", line))
-			continue
+	invalid := []string{}
+
+	props, err := properties.Parse(reader)
+	var syntaxErrors properties.ErrorList
+	if errors.As(err, &syntaxErrors) {
+		for _, syntaxError := range syntaxErrors {
+			invalid = append(invalid, syntaxError.Raw)
 		}
-		key, value := split[0], split[1]
+	} else if err != nil {
+		return nil, err
+	}
 
-		if key == "" || value == "" {
-			log.Println(fmt.Sprintf("Could not parse OneAgent metadata line '%s'", line))
+	for _, prop := range props {
+		if prop.Key == "" || prop.Value == "" {
+			invalid = append(invalid, prop.Raw)
 			continue
 		}
 
-		result = append(result, dimensions.NewDimension(key, value))
+		result = append(result, dimensions.NewDimension(prop.Key, prop.Value))
+	}
+
+	if len(invalid) > 0 {
+		return result, &ParseError{Lines: invalid}
+	}
+	return result, nil
+}
+
+func asNormalizedDimensionList(reader io.Reader) (dimensions.NormalizedDimensionList, error) {
+	dims, err := parseOneAgentMetadata(reader)
+	var parseErr *ParseError
+	if err != nil && !errors.As(err, &parseErr) {
+		return dimensions.NewNormalizedDimensionList(), err
 	}
-	return result
+	return dimensions.NewNormalizedDimensionList(dims...), err
 }
 
-func asNormalizedDimensionList(lines []string) dimensions.NormalizedDimensionList {
-	if len(lines) == 0 {
-		return dimensions.NewNormalizedDimensionList()
+// GetOneAgentMetadataFrom reads the metadata from the passed file system and returns them as NormalizedDimensionList.
+// The names of the indirection file and the metadata file it points to are passed to fsys.Open as they are.
+// If fsys is nil, the files are opened using os.Open.
+// If the metadata cannot be read, an empty list is returned together with one of ErrNoOneAgent, ErrIndirectionFileEmpty,
+// ErrTargetMissing (use errors.Is to check), or the underlying I/O error.
+// If some lines could not be parsed, the dimensions from all other lines are returned together with a *ParseError.
+func GetOneAgentMetadataFrom(fsys fs.FS, opts ...Option) (dimensions.NormalizedDimensionList, error) {
+	c := config{indirectionFilename: indirectionFilename}
+	for _, opt := range opts {
+		opt(&c)
 	}
 
-	dims := []dimensions.Dimension{}
-	for _, dim := range parseOneAgentMetadata(lines) {
-		dims = append(dims, dim)
+	if fsys == nil {
+		fsys = osFS{}
 	}
-	return dimensions.NewNormalizedDimensionList(dims...)
+
+	return readOneAgentMetadata(fsys, c.indirectionFilename)
 }
 
 // GetOneAgentMetadata reads the metadata and returns them as NormalizedDimensionList
 func GetOneAgentMetadata() dimensions.NormalizedDimensionList {
-	lines, err := readOneAgentMetadata(indirectionFilename)
+	dims, err := GetOneAgentMetadataFrom(nil)
 	if err != nil {
-		log.Println("Could not read OneAgent metadata. This is normal if no OneAgent is installed, or if you are running this on Linux.")
-		return dimensions.NewNormalizedDimensionList()
+		var parseErr *ParseError
+		switch {
+		case errors.Is(err, ErrNoOneAgent):
+			logging.GetLogger().Infof("Could not read OneAgent metadata. This is normal if no OneAgent is installed, or if you are running this on Linux.")
+		case errors.As(err, &parseErr):
+			logging.GetLogger().Warnf("Could not parse OneAgent metadata: %v", err)
+		default:
+			logging.GetLogger().Warnf("Could not read OneAgent metadata: %v", err)
+		}
 	}
 
-	return asNormalizedDimensionList(lines)
+	return dims
 }
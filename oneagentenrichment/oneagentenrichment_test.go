@@ -14,7 +14,9 @@
 package oneagentenrichment
 
 import (
+	"errors"
 	"io"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -68,104 +70,64 @@ func Test_readIndirectionFile(t *testing.T) {
 	}
 }
 
-func Test_readMetadataFile(t *testing.T) {
-	type args struct {
-		reader io.Reader
-	}
-	tests := []struct {
-		name    string
-		args    args
-		want    []string
-		wantErr bool
-	}{
-		{
-			name: "valid case",
-			args: args{reader: strings.NewReader("key1=value1\nkey2=value2")},
-			want: []string{"key1=value1", "key2=value2"},
-		},
-		{
-			name: "metadata file empty",
-			args: args{reader: strings.NewReader("")},
-			want: []string{},
-		},
-		{
-			name: "ignore whitespace",
-			args: args{reader: strings.NewReader("\t \tkey1=value1\t \t\n\t \tkey2=value2\t \t")},
-			want: []string{"key1=value1", "key2=value2"},
-		},
-		{
-			name: "empty lines ignored",
-			args: args{reader: strings.NewReader("\n\t \t\n")},
-			want: []string{},
-		},
-		{
-			name:    "pass nil reader",
-			args:    args{reader: nil},
-			want:    nil,
-			wantErr: true,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := readMetadataFile(tt.args.reader)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("readMetadataFile() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("readMetadataFile() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func Test_readOneAgentMetadata(t *testing.T) {
 	type args struct {
 		indirectionBasename string
 	}
 	tests := []struct {
-		name    string
-		args    args
-		want    []string
-		wantErr bool
+		name      string
+		args      args
+		want      dimensions.NormalizedDimensionList
+		wantErr   bool
+		wantErrIs error
 	}{
 		{
 			name: "valid case",
 			args: args{indirectionBasename: "testdata/indirection.properties"},
-			want: []string{"key1=value1", "key2=value2", "key3=value3"},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension("key1", "value1"),
+				dimensions.NewDimension("key2", "value2"),
+				dimensions.NewDimension("key3", "value3"),
+			),
 		},
 		{
 			name: "metadata file empty",
 			args: args{indirectionBasename: "testdata/indirection_target_empty.properties"},
-			want: []string{},
+			want: dimensions.NewNormalizedDimensionList(),
 		},
 		{
-			name:    "indirection file empty",
-			args:    args{indirectionBasename: "testdata/indirection_empty.properties"},
-			want:    nil,
-			wantErr: true,
+			name:      "indirection file empty",
+			args:      args{indirectionBasename: "testdata/indirection_empty.properties"},
+			want:      dimensions.NewNormalizedDimensionList(),
+			wantErr:   true,
+			wantErrIs: ErrIndirectionFileEmpty,
 		},
 		{
-			name:    "indirection file does not exist",
-			args:    args{indirectionBasename: "testdata/indirection_file_that_does_not_exist.properties"},
-			want:    nil,
-			wantErr: true,
+			name:      "indirection file does not exist",
+			args:      args{indirectionBasename: "testdata/indirection_file_that_does_not_exist.properties"},
+			want:      dimensions.NewNormalizedDimensionList(),
+			wantErr:   true,
+			wantErrIs: ErrNoOneAgent,
 		},
 		{
-			name:    "indirection target does not exist",
-			args:    args{indirectionBasename: "testdata/indirection_target_nonexistent.properties"},
-			want:    nil,
-			wantErr: true,
+			name:      "indirection target does not exist",
+			args:      args{indirectionBasename: "testdata/indirection_target_nonexistent.properties"},
+			want:      dimensions.NewNormalizedDimensionList(),
+			wantErr:   true,
+			wantErrIs: ErrTargetMissing,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := readOneAgentMetadata(tt.args.indirectionBasename)
+			got, err := readOneAgentMetadata(os.DirFS("."), tt.args.indirectionBasename)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("readOneAgentMetadata() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("readOneAgentMetadata() error = %v, want %v", err, tt.wantErrIs)
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("readOneAgentMetadata() = %v, want %v", got, tt.want)
 			}
@@ -178,9 +140,10 @@ func TestOneAgentMetadataEnricher_parseOneAgentMetadata(t *testing.T) {
 		lines []string
 	}
 	tests := []struct {
-		name string
-		args args
-		want []dimensions.Dimension
+		name    string
+		args    args
+		want    []dimensions.Dimension
+		wantErr bool
 	}{
 		{
 			name: "valid case",
@@ -205,7 +168,8 @@ func TestOneAgentMetadataEnricher_parseOneAgentMetadata(t *testing.T) {
 				"=",
 				"===",
 			}},
-			want: []dimensions.Dimension{},
+			want:    []dimensions.Dimension{},
+			wantErr: true,
 		},
 		{
 			name: "pass mixed strings",
@@ -220,17 +184,66 @@ func TestOneAgentMetadataEnricher_parseOneAgentMetadata(t *testing.T) {
 				dimensions.NewDimension("key1", "value1"),
 				dimensions.NewDimension("key2", "value2"),
 			},
+			wantErr: true,
 		},
 		{
 			name: "valid tailing equal signs",
 			args: args{[]string{"key1=value1=="}},
 			want: []dimensions.Dimension{dimensions.NewDimension("key1", "value1==")},
 		},
+		{
+			name: "comments are skipped",
+			args: args{[]string{"# comment", "! other comment", "key1=value1"}},
+			want: []dimensions.Dimension{dimensions.NewDimension("key1", "value1")},
+		},
+		{
+			name: "properties syntax",
+			args: args{[]string{"key1:value1", "key2 value2", "key3=multi\\", "line", "key4=caf\\u00e9"}},
+			want: []dimensions.Dimension{
+				dimensions.NewDimension("key1", "value1"),
+				dimensions.NewDimension("key2", "value2"),
+				dimensions.NewDimension("key3", "multiline"),
+				dimensions.NewDimension("key4", "café"),
+			},
+		},
+		{
+			name: "escaped trailing space",
+			args: args{[]string{"key1=value1\\ ", "key2=value2"}},
+			want: []dimensions.Dimension{
+				dimensions.NewDimension("key1", "value1 "),
+				dimensions.NewDimension("key2", "value2"),
+			},
+		},
+		{
+			name: "continuation ended by blank line",
+			args: args{[]string{"key1=value1\\", "", "key2=value2"}},
+			want: []dimensions.Dimension{
+				dimensions.NewDimension("key1", "value1"),
+				dimensions.NewDimension("key2", "value2"),
+			},
+		},
+		{
+			name: "leading whitespace and blank lines",
+			args: args{[]string{"\t \tkey1=value1", "\t \t", "", "key2=value2"}},
+			want: []dimensions.Dimension{
+				dimensions.NewDimension("key1", "value1"),
+				dimensions.NewDimension("key2", "value2"),
+			},
+		},
+		{
+			name:    "malformed escape",
+			args:    args{[]string{"key1=\\u00", "key2=value2"}},
+			want:    []dimensions.Dimension{dimensions.NewDimension("key2", "value2")},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-
-			if got := parseOneAgentMetadata(tt.args.lines); !reflect.DeepEqual(got, tt.want) {
+			got, err := parseOneAgentMetadata(strings.NewReader(strings.Join(tt.args.lines, "\n")))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OneAgentMetadataEnricher.parseOneAgentMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("OneAgentMetadataEnricher.parseOneAgentMetadata() = %v, want %v", got, tt.want)
 			}
 		})
@@ -242,9 +255,10 @@ func Test_asNormalizedDimensionList(t *testing.T) {
 		lines []string
 	}
 	tests := []struct {
-		name string
-		args args
-		want dimensions.NormalizedDimensionList
+		name    string
+		args    args
+		want    dimensions.NormalizedDimensionList
+		wantErr bool
 	}{
 		{
 			name: "empty set",
@@ -282,13 +296,94 @@ func Test_asNormalizedDimensionList(t *testing.T) {
 				dimensions.NewDimension("~~#", "value2"),
 				// =value3 is discarded since it cannot be split
 			),
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := asNormalizedDimensionList(tt.args.lines); !reflect.DeepEqual(got, tt.want) {
+			got, err := asNormalizedDimensionList(strings.NewReader(strings.Join(tt.args.lines, "\n")))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("asNormalizedDimensionList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("asNormalizedDimensionList() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestGetOneAgentMetadataFrom(t *testing.T) {
+	// the indirection files in testdata reference their targets relative to the package directory.
+	fsys := os.DirFS(".")
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		want      dimensions.NormalizedDimensionList
+		wantErrIs error
+		wantParse bool
+	}{
+		{
+			name: "valid case",
+			opts: []Option{WithIndirectionFilename("testdata/indirection.properties")},
+			want: dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension("key1", "value1"),
+				dimensions.NewDimension("key2", "value2"),
+				dimensions.NewDimension("key3", "value3"),
+			),
+		},
+		{
+			name:      "default indirection file name",
+			want:      dimensions.NewNormalizedDimensionList(),
+			wantErrIs: ErrNoOneAgent,
+		},
+		{
+			name: "metadata file empty",
+			opts: []Option{WithIndirectionFilename("testdata/indirection_target_empty.properties")},
+			want: dimensions.NewNormalizedDimensionList(),
+		},
+		{
+			name:      "no OneAgent installed",
+			opts:      []Option{WithIndirectionFilename("testdata/indirection_file_that_does_not_exist.properties")},
+			want:      dimensions.NewNormalizedDimensionList(),
+			wantErrIs: ErrNoOneAgent,
+		},
+		{
+			name:      "indirection file empty",
+			opts:      []Option{WithIndirectionFilename("testdata/indirection_empty.properties")},
+			want:      dimensions.NewNormalizedDimensionList(),
+			wantErrIs: ErrIndirectionFileEmpty,
+		},
+		{
+			name:      "indirection target does not exist",
+			opts:      []Option{WithIndirectionFilename("testdata/indirection_target_nonexistent.properties")},
+			want:      dimensions.NewNormalizedDimensionList(),
+			wantErrIs: ErrTargetMissing,
+		},
+		{
+			name:      "invalid lines are reported",
+			opts:      []Option{WithIndirectionFilename("testdata/indirection_invalid.properties")},
+			want:      dimensions.NewNormalizedDimensionList(dimensions.NewDimension("key1", "value1")),
+			wantParse: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetOneAgentMetadataFrom(fsys, tt.opts...)
+			wantErr := tt.wantErrIs != nil || tt.wantParse
+			if (err != nil) != wantErr {
+				t.Fatalf("GetOneAgentMetadataFrom() error = %v, wantErr %v", err, wantErr)
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("GetOneAgentMetadataFrom() error = %v, want %v", err, tt.wantErrIs)
+			}
+			var parseErr *ParseError
+			if tt.wantParse && !errors.As(err, &parseErr) {
+				t.Errorf("GetOneAgentMetadataFrom() error = %v, want *ParseError", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetOneAgentMetadataFrom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
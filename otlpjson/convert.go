@@ -0,0 +1,381 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otlpjson converts OpenTelemetry metrics in the OTLP JSON encoding, as written by the file exporter of the
+// OpenTelemetry Collector, to Dynatrace metrics.
+package otlpjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/estimate"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// Option represents the function interface used to configure the Converter.
+type Option func(c *Converter)
+
+// WithPrefix sets a prefix that is prepended to all metric keys.
+func WithPrefix(prefix string) Option {
+	return func(c *Converter) {
+		c.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics. Attributes with the same (normalized) key
+// overwrite the default dimensions.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(c *Converter) {
+		c.defaultDimensions = dims
+	}
+}
+
+// Converter converts OTLP JSON metrics to Dynatrace metrics:
+//
+//   - Gauges are converted to "gauge,<value>".
+//   - Monotonic Sums are converted to "count,delta=<value>". Cumulative Sums are converted to deltas, so a series
+//     only produces data from its second data point on.
+//   - Non-monotonic cumulative Sums are converted to gauges. Non-monotonic delta Sums are skipped.
+//   - Histograms and ExponentialHistograms are converted to "gauge,min=<min>,max=<max>,sum=<sum>,count=<count>".
+//     If min and max are not set, or the histogram is cumulative, they are estimated from the bucket boundaries.
+//
+// Resource, scope and data point attributes become dimensions, in this order of precedence. Summaries are skipped.
+// The previous values of cumulative series are kept by the Converter, so a source of cumulative data needs its own
+// Converter. Calls may run in parallel, as long as they do not contain data points of the same series.
+type Converter struct {
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	tracker           *aggregation.CumulativeTracker
+}
+
+// NewConverter creates a new Converter without any cumulative state.
+func NewConverter(opts ...Option) *Converter {
+	c := &Converter{
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		tracker:           aggregation.NewCumulativeTracker(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Stream decodes all JSON documents from reader, e.g. one per line as written by the file exporter, and passes the
+// converted metrics to fn. Data points that cannot be converted are skipped and reported in the returned error.
+// Stream stops at the first document that cannot be decoded, or if fn returns an error.
+func (c *Converter) Stream(reader io.Reader, fn func(*metric.Metric) error) error {
+	decoder := json.NewDecoder(reader)
+	errs := []string{}
+
+	for document := 1; ; document++ {
+		var data metricsData
+		if err := decoder.Decode(&data); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("could not decode document %d: %w", document, err)
+		}
+
+		metrics, err := c.convert(&data)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("document %d: %v", document, err))
+		}
+		for _, m := range metrics {
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.tracker.Sweep()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("could not convert all data points: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Convert decodes all JSON documents from reader and returns the converted metrics. If some data points cannot be
+// converted, all other metrics are returned together with an error.
+func (c *Converter) Convert(reader io.Reader) ([]*metric.Metric, error) {
+	result := []*metric.Metric{}
+	err := c.Stream(reader, func(m *metric.Metric) error {
+		result = append(result, m)
+		return nil
+	})
+	return result, err
+}
+
+func attributes(kvs []keyValue) dimensions.NormalizedDimensionList {
+	dims := make([]dimensions.Dimension, 0, len(kvs))
+	for _, kv := range kvs {
+		dims = append(dims, dimensions.NewDimension(kv.Key, kv.Value.String()))
+	}
+	return dimensions.NewNormalizedDimensionList(dims...)
+}
+
+func timestamp(nanos uint64Str) metric.MetricOption {
+	if nanos == 0 {
+		return func(m *metric.Metric) error { return nil }
+	}
+	return metric.WithTimestamp(time.Unix(0, int64(nanos)))
+}
+
+func isFinite(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Converter) convert(data *metricsData) ([]*metric.Metric, error) {
+	result := []*metric.Metric{}
+	errs := []string{}
+
+	for _, rm := range data.ResourceMetrics {
+		resourceDims := attributes(rm.Resource.Attributes)
+		for _, sm := range rm.ScopeMetrics {
+			scopeDims := dimensions.MergeLists(resourceDims, attributes(sm.Scope.Attributes))
+			for _, record := range sm.Metrics {
+				metrics, err := c.convertRecord(record, scopeDims)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("'%s': %v", record.Name, err))
+				}
+				result = append(result, metrics...)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return result, errors.New(strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+func (c *Converter) convertRecord(record metricRecord, scopeDims dimensions.NormalizedDimensionList) ([]*metric.Metric, error) {
+	result := []*metric.Metric{}
+	errs := []string{}
+
+	add := func(attrs []keyValue, build func(dims dimensions.NormalizedDimensionList) (metric.MetricOption, bool), ts uint64Str) {
+		dims := dimensions.MergeLists(c.defaultDimensions, scopeDims, attributes(attrs))
+		value, ok := build(dims)
+		if !ok {
+			return
+		}
+
+		m, err := metric.NewMetric(record.Name, metric.WithPrefix(c.prefix), metric.WithDimensions(dims), value, timestamp(ts))
+		if err != nil {
+			errs = append(errs, err.Error())
+			return
+		}
+		result = append(result, m)
+	}
+
+	switch {
+	case record.Gauge != nil:
+		for _, dp := range record.Gauge.DataPoints {
+			dp := dp
+			add(dp.Attributes, func(dimensions.NormalizedDimensionList) (metric.MetricOption, bool) {
+				return gaugeValue(dp)
+			}, dp.TimeUnixNano)
+		}
+	case record.Sum != nil:
+		for _, dp := range record.Sum.DataPoints {
+			dp := dp
+			add(dp.Attributes, func(dims dimensions.NormalizedDimensionList) (metric.MetricOption, bool) {
+				return c.sumValue(record.Name, record.Sum, dp, dims)
+			}, dp.TimeUnixNano)
+		}
+	case record.Histogram != nil:
+		for _, dp := range record.Histogram.DataPoints {
+			dp := dp
+			add(dp.Attributes, func(dims dimensions.NormalizedDimensionList) (metric.MetricOption, bool) {
+				return c.histogramValue(record.Name, record.Histogram.AggregationTemporality, explicitBuckets(dp), dp.Count, dp.Sum, dp.Min, dp.Max, dims)
+			}, dp.TimeUnixNano)
+		}
+	case record.ExponentialHistogram != nil:
+		for _, dp := range record.ExponentialHistogram.DataPoints {
+			dp := dp
+			add(dp.Attributes, func(dims dimensions.NormalizedDimensionList) (metric.MetricOption, bool) {
+				return c.histogramValue(record.Name, record.ExponentialHistogram.AggregationTemporality, exponentialBuckets(dp), dp.Count, dp.Sum, dp.Min, dp.Max, dims)
+			}, dp.TimeUnixNano)
+		}
+	}
+
+	if len(errs) > 0 {
+		return result, errors.New(strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+func gaugeValue(dp numberDataPoint) (metric.MetricOption, bool) {
+	switch {
+	case dp.AsInt != nil:
+		return metric.WithIntGaugeValue(int64(*dp.AsInt)), true
+	case dp.AsDouble != nil && isFinite(float64(*dp.AsDouble)):
+		return metric.WithFloatGaugeValue(float64(*dp.AsDouble)), true
+	}
+	return nil, false
+}
+
+func (c *Converter) sumValue(name string, s *sum, dp numberDataPoint, dims dimensions.NormalizedDimensionList) (metric.MetricOption, bool) {
+	switch {
+	case !s.IsMonotonic && s.AggregationTemporality == temporalityCumulative:
+		return gaugeValue(dp)
+	case !s.IsMonotonic, s.AggregationTemporality == temporalityUnspecified:
+		return nil, false
+	case s.AggregationTemporality == temporalityDelta && dp.AsInt != nil:
+		return metric.WithIntCounterValueDelta(int64(*dp.AsInt)), true
+	case s.AggregationTemporality == temporalityDelta && dp.AsDouble != nil && isFinite(float64(*dp.AsDouble)):
+		return metric.WithFloatCounterValueDelta(float64(*dp.AsDouble)), true
+	}
+
+	key := aggregation.SeriesKey(name, dims)
+	switch {
+	case dp.AsInt != nil:
+		if delta, ok := c.tracker.IntDelta(key, int64(*dp.AsInt)); ok {
+			return metric.WithIntCounterValueDelta(delta), true
+		}
+	case dp.AsDouble != nil && isFinite(float64(*dp.AsDouble)):
+		if delta, ok := c.tracker.FloatDelta(key, float64(*dp.AsDouble)); ok {
+			return metric.WithFloatCounterValueDelta(delta), true
+		}
+	}
+	return nil, false
+}
+
+// bucket is a histogram bucket with the range (lower, upper] and the number of values in it.
+type bucket struct {
+	lower, upper float64
+	count        uint64
+	// id identifies the bucket for cumulative tracking.
+	id string
+}
+
+func explicitBuckets(dp histogramDataPoint) []bucket {
+	result := make([]bucket, 0, len(dp.BucketCounts))
+	for i, count := range dp.BucketCounts {
+		lower, upper := math.Inf(-1), math.Inf(1)
+		if i > 0 && i-1 < len(dp.ExplicitBounds) {
+			lower = float64(dp.ExplicitBounds[i-1])
+		}
+		if i < len(dp.ExplicitBounds) {
+			upper = float64(dp.ExplicitBounds[i])
+		}
+		result = append(result, bucket{lower: lower, upper: upper, count: uint64(count), id: strconv.FormatFloat(upper, 'g', -1, 64)})
+	}
+	return result
+}
+
+// exponentialBuckets returns the buckets sorted by their boundaries. The bucket with index i covers
+// (base^i, base^(i+1)] with base = 2^(2^-scale), negative buckets are mirrored.
+func exponentialBuckets(dp exponentialHistogramDataPoint) []bucket {
+	base := math.Pow(2, math.Pow(2, -float64(dp.Scale)))
+	scale := strconv.Itoa(int(dp.Scale))
+
+	result := make([]bucket, 0, len(dp.Negative.BucketCounts)+len(dp.Positive.BucketCounts)+1)
+	for i := len(dp.Negative.BucketCounts) - 1; i >= 0; i-- {
+		index := int(dp.Negative.Offset) + i
+		result = append(result, bucket{
+			lower: -math.Pow(base, float64(index+1)),
+			upper: -math.Pow(base, float64(index)),
+			count: uint64(dp.Negative.BucketCounts[i]),
+			id:    scale + ":-" + strconv.Itoa(index),
+		})
+	}
+	result = append(result, bucket{lower: 0, upper: 0, count: uint64(dp.ZeroCount), id: scale + ":zero"})
+	for i, count := range dp.Positive.BucketCounts {
+		index := int(dp.Positive.Offset) + i
+		result = append(result, bucket{
+			lower: math.Pow(base, float64(index)),
+			upper: math.Pow(base, float64(index+1)),
+			count: uint64(count),
+			id:    scale + ":" + strconv.Itoa(index),
+		})
+	}
+	return result
+}
+
+// ranges returns the buckets for the estimation of min and max.
+func ranges(buckets []bucket) []estimate.Bucket {
+	result := make([]estimate.Bucket, 0, len(buckets))
+	for _, b := range buckets {
+		result = append(result, estimate.Bucket{Lower: b.lower, Upper: b.upper, Count: float64(b.count)})
+	}
+	return result
+}
+
+func (c *Converter) histogramValue(
+	name string,
+	temp temporality,
+	buckets []bucket,
+	count uint64Str,
+	sumValue, minValue, maxValue *float64Str,
+	dims dimensions.NormalizedDimensionList,
+) (metric.MetricOption, bool) {
+	if sumValue == nil || !isFinite(float64(*sumValue)) {
+		return nil, false
+	}
+	total, n := float64(*sumValue), int64(count)
+
+	switch temp {
+	case temporalityDelta:
+		if n <= 0 {
+			return nil, false
+		}
+		mean := total / float64(n)
+		min, max := estimate.MinMax(ranges(buckets), mean)
+		if minValue != nil && maxValue != nil && isFinite(float64(*minValue), float64(*maxValue)) {
+			min, max = float64(*minValue), float64(*maxValue)
+		}
+		return metric.WithFloatSummaryValue(min, max, total, n), true
+
+	case temporalityCumulative:
+		key := aggregation.SeriesKey(name, dims)
+
+		// the bucket deltas have to be tracked for every data point, even if no metric is produced.
+		bucketsOk := true
+		for i, b := range buckets {
+			delta, ok := c.tracker.IntDelta(key+"#bucket:"+b.id, int64(b.count))
+			bucketsOk = bucketsOk && ok
+			buckets[i].count = uint64(delta)
+		}
+
+		sumDelta, sumOk := c.tracker.FloatDelta(key+"#sum", total)
+		countDelta, countOk := c.tracker.IntDelta(key+"#count", n)
+		if !sumOk || !countOk || countDelta <= 0 {
+			return nil, false
+		}
+
+		mean := sumDelta / float64(countDelta)
+		min, max := mean, mean
+		if bucketsOk {
+			min, max = estimate.MinMax(ranges(buckets), mean)
+		}
+		return metric.WithFloatSummaryValue(min, max, sumDelta, countDelta), true
+	}
+	return nil, false
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpjson
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestConverter_Convert(t *testing.T) {
+	f, err := os.Open("testdata/metrics.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	c := NewConverter(
+		WithPrefix("otel"),
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(
+			dimensions.NewDimension("env", "test"),
+			dimensions.NewDimension("host.name", "overwritten"),
+		)),
+	)
+	metrics, err := c.Convert(f)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	const dims = "env=test,host.name=h1,lib=otel,service.name=checkout"
+	want := linetest.CanonicalLines([]string{
+		"otel.temperature," + dims + ",room=a,floor=3 gauge,21.5 1700000000000",
+		"otel.requests," + dims + ",route=/ count,delta=5",
+		"otel.queue," + dims + " gauge,3",
+		"otel.latency," + dims + " gauge,min=1,max=5,sum=10,count=4",
+		"otel.latency.minmax," + dims + " gauge,min=0.5,max=7,sum=10,count=4",
+		"otel.size," + dims + " gauge,min=2,max=8,sum=7,count=3",
+		// second document
+		"otel.bytes," + dims + " count,delta=150",
+		"otel.size.cumulative," + dims + " gauge,min=2,max=5,sum=15,count=3",
+		"otel.rt," + dims + " gauge,min=1,max=5,sum=12,count=3",
+	})
+	if got := linetest.Serialize(t, metrics); !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert() =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestConverter_CumulativeStateAcrossCalls(t *testing.T) {
+	doc := func(value string) string {
+		return `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"c","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[{"asDouble":` + value + `}]}}]}]}]}`
+	}
+	c := NewConverter()
+
+	for i, step := range []struct {
+		value string
+		want  []string
+	}{
+		{value: "10", want: []string{}},
+		{value: "12.5", want: []string{"c count,delta=2.5"}},
+		// reset
+		{value: "1", want: []string{"c count,delta=1"}},
+	} {
+		metrics, err := c.Convert(strings.NewReader(doc(step.value)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := linetest.Serialize(t, metrics); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: Convert() = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestConverter_Attributes(t *testing.T) {
+	input := `{"resourceMetrics":[{"resource":{"attributes":[
+		{"key":"flag","value":{"boolValue":true}},
+		{"key":"ratio","value":{"doubleValue":0.25}},
+		{"key":"list","value":{"arrayValue":{"values":[{"stringValue":"a"},{"intValue":"1"}]}}}
+	]},"scopeMetrics":[{"metrics":[{"name":"g","gauge":{"dataPoints":[{"asInt":"1"}]}}]}]}]}`
+
+	metrics, err := NewConverter().Convert(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{linetest.Canonical(`g,flag=true,ratio=0.25,list=[\"a\"\,1] gauge,1`)}
+	if got := linetest.Serialize(t, metrics); !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert() = %v, want %v", got, want)
+	}
+}
+
+func TestConverter_InvalidJSON(t *testing.T) {
+	input := `{"resourceMetrics":[]}
+{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"g","gauge":{"dataPoints":[{"asInt":"x"}]}}]}]}]}`
+
+	if _, err := NewConverter().Convert(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "document 2") {
+		t.Errorf("Convert() error = %v, want decode error for document 2", err)
+	}
+}
+
+func TestConverter_StreamStops(t *testing.T) {
+	input := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"g","gauge":{"dataPoints":[{"asInt":"1"},{"asInt":"2"}]}}]}]}]}`
+
+	stop := errors.New("stop")
+	count := 0
+	err := NewConverter().Stream(strings.NewReader(input), func(*metric.Metric) error {
+		count++
+		return stop
+	})
+	if !errors.Is(err, stop) || count != 1 {
+		t.Errorf("Stream() = (%d metrics, %v), want to stop after the first metric", count, err)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The types in this file mirror the JSON encoding of the OTLP metrics protobuf messages
+// (opentelemetry/proto/metrics/v1/metrics.proto). Only the fields used by the Converter are decoded.
+
+type metricsData struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeMetrics struct {
+	Scope   scope          `json:"scope"`
+	Metrics []metricRecord `json:"metrics"`
+}
+
+type scope struct {
+	Name       string     `json:"name"`
+	Version    string     `json:"version"`
+	Attributes []keyValue `json:"attributes"`
+}
+
+type metricRecord struct {
+	Name                 string                `json:"name"`
+	Gauge                *gauge                `json:"gauge"`
+	Sum                  *sum                  `json:"sum"`
+	Histogram            *histogram            `json:"histogram"`
+	ExponentialHistogram *exponentialHistogram `json:"exponentialHistogram"`
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality temporality       `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality temporality          `json:"aggregationTemporality"`
+}
+
+type exponentialHistogram struct {
+	DataPoints             []exponentialHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality temporality                     `json:"aggregationTemporality"`
+}
+
+type numberDataPoint struct {
+	Attributes   []keyValue  `json:"attributes"`
+	TimeUnixNano uint64Str   `json:"timeUnixNano"`
+	AsDouble     *float64Str `json:"asDouble"`
+	AsInt        *int64Str   `json:"asInt"`
+}
+
+type histogramDataPoint struct {
+	Attributes     []keyValue   `json:"attributes"`
+	TimeUnixNano   uint64Str    `json:"timeUnixNano"`
+	Count          uint64Str    `json:"count"`
+	Sum            *float64Str  `json:"sum"`
+	BucketCounts   []uint64Str  `json:"bucketCounts"`
+	ExplicitBounds []float64Str `json:"explicitBounds"`
+	Min            *float64Str  `json:"min"`
+	Max            *float64Str  `json:"max"`
+}
+
+type exponentialHistogramDataPoint struct {
+	Attributes   []keyValue  `json:"attributes"`
+	TimeUnixNano uint64Str   `json:"timeUnixNano"`
+	Count        uint64Str   `json:"count"`
+	Sum          *float64Str `json:"sum"`
+	Scale        int32       `json:"scale"`
+	ZeroCount    uint64Str   `json:"zeroCount"`
+	Positive     buckets     `json:"positive"`
+	Negative     buckets     `json:"negative"`
+	Min          *float64Str `json:"min"`
+	Max          *float64Str `json:"max"`
+}
+
+type buckets struct {
+	Offset       int32       `json:"offset"`
+	BucketCounts []uint64Str `json:"bucketCounts"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string      `json:"stringValue"`
+	BoolValue   *bool        `json:"boolValue"`
+	IntValue    *int64Str    `json:"intValue"`
+	DoubleValue *float64Str  `json:"doubleValue"`
+	ArrayValue  *arrayValue  `json:"arrayValue"`
+	KvlistValue *kvlistValue `json:"kvlistValue"`
+	BytesValue  *string      `json:"bytesValue"`
+}
+
+type arrayValue struct {
+	Values []anyValue `json:"values"`
+}
+
+type kvlistValue struct {
+	Values []keyValue `json:"values"`
+}
+
+// String renders the value as a dimension value. Arrays and key-value lists are rendered as JSON.
+func (v anyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(float64(*v.DoubleValue), 'g', -1, 64)
+	case v.BytesValue != nil:
+		return *v.BytesValue
+	case v.ArrayValue != nil, v.KvlistValue != nil:
+		encoded, err := json.Marshal(v.plain())
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	}
+	return ""
+}
+
+// plain converts the value to a Go value that encodes as plain JSON.
+func (v anyValue) plain() interface{} {
+	switch {
+	case v.ArrayValue != nil:
+		values := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			values = append(values, item.plain())
+		}
+		return values
+	case v.KvlistValue != nil:
+		values := make(map[string]interface{}, len(v.KvlistValue.Values))
+		for _, kv := range v.KvlistValue.Values {
+			values[kv.Key] = kv.Value.plain()
+		}
+		return values
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil && !math.IsNaN(float64(*v.DoubleValue)) && !math.IsInf(float64(*v.DoubleValue), 0):
+		return float64(*v.DoubleValue)
+	}
+	return v.String()
+}
+
+// temporality is the aggregation temporality, encoded either as number or as enum name.
+type temporality int
+
+const (
+	temporalityUnspecified temporality = 0
+	temporalityDelta       temporality = 1
+	temporalityCumulative  temporality = 2
+)
+
+func (t *temporality) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		switch name {
+		case "AGGREGATION_TEMPORALITY_DELTA":
+			*t = temporalityDelta
+		case "AGGREGATION_TEMPORALITY_CUMULATIVE":
+			*t = temporalityCumulative
+		default:
+			*t = temporalityUnspecified
+		}
+		return nil
+	}
+
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid aggregation temporality %s", data)
+	}
+	*t = temporality(n)
+	return nil
+}
+
+// float64Str decodes floating point numbers, which are encoded as numbers in OTLP JSON, except for the special values
+// "NaN", "Infinity" and "-Infinity", which are encoded as strings.
+type float64Str float64
+
+func (f *float64Str) UnmarshalJSON(data []byte) error {
+	var v float64
+	switch s := unquote(data); s {
+	case "NaN":
+		v = math.NaN()
+	case "Infinity":
+		v = math.Inf(1)
+	case "-Infinity":
+		v = math.Inf(-1)
+	default:
+		parsed, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %s", data)
+		}
+		v = parsed
+	}
+	*f = float64Str(v)
+	return nil
+}
+
+// int64Str and uint64Str decode 64 bit integers, which are encoded as strings in OTLP JSON, but also accept numbers.
+type int64Str int64
+
+type uint64Str uint64
+
+func unquote(data []byte) string {
+	return strings.Trim(string(data), `"`)
+}
+
+func (i *int64Str) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(unquote(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", data)
+	}
+	*i = int64Str(v)
+	return nil
+}
+
+func (u *uint64Str) UnmarshalJSON(data []byte) error {
+	s := unquote(data)
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		// large numbers may be encoded in exponent notation by some encoders.
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil || f < 0 || f > math.MaxUint64 || f != math.Trunc(f) {
+			return fmt.Errorf("invalid unsigned integer %s", data)
+		}
+		v = uint64(f)
+	}
+	*u = uint64Str(v)
+	return nil
+}
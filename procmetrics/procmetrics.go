@@ -0,0 +1,295 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package procmetrics collects metrics of the current process from the Linux /proc file system.
+package procmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/enrichment"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/sampling"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/oneagentenrichment"
+)
+
+const (
+	defaultPrefix  = "process"
+	defaultProcDir = "proc/self"
+	// defaultClockTicks is USER_HZ, the unit of the CPU times in /proc/<pid>/stat, which is 100 on virtually all Linux systems.
+	defaultClockTicks = 100
+)
+
+// Option represents the function interface used to configure the Collector.
+type Option func(c *Collector)
+
+// WithFS sets the file system that contains the proc directory. Defaults to the root of the local file system.
+func WithFS(fsys fs.FS) Option {
+	return func(c *Collector) {
+		c.fsys = fsys
+	}
+}
+
+// WithProcDir sets the directory of the process, relative to the root of the file system. Defaults to "proc/self".
+func WithProcDir(dir string) Option {
+	return func(c *Collector) {
+		c.procDir = dir
+	}
+}
+
+// WithClockTicks sets the number of clock ticks per second, in which the CPU times are reported. Defaults to 100.
+func WithClockTicks(ticks int) Option {
+	return func(c *Collector) {
+		c.clockTicks = ticks
+	}
+}
+
+// WithPrefix sets the prefix of all metric keys. Defaults to "process".
+func WithPrefix(prefix string) Option {
+	return func(c *Collector) {
+		c.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(c *Collector) {
+		c.defaultDimensions = dims
+	}
+}
+
+// WithEnrichmentProvider sets the provider of the enrichment dimensions, which are read on every collection.
+// By default, the OneAgent metadata is read once when the Collector is created.
+func WithEnrichmentProvider(provider *enrichment.EnrichmentProvider) Option {
+	return func(c *Collector) {
+		c.enrichment = provider.Get
+	}
+}
+
+// Collector reads the CPU times, memory, thread count, open file descriptors and I/O of a process from
+// the stat, status, io and fd entries of its /proc directory. CPU times and I/O bytes are cumulative and reported as
+// deltas, so they are only reported from the second collection on. It is safe for concurrent use.
+type Collector struct {
+	fsys              fs.FS
+	procDir           string
+	clockTicks        int
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	enrichment        func() dimensions.NormalizedDimensionList
+
+	mu      sync.Mutex
+	tracker *aggregation.CumulativeTracker
+}
+
+// NewCollector creates a Collector.
+func NewCollector(opts ...Option) *Collector {
+	c := &Collector{
+		fsys:              os.DirFS("/"),
+		procDir:           defaultProcDir,
+		clockTicks:        defaultClockTicks,
+		prefix:            defaultPrefix,
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		tracker:           aggregation.NewCumulativeTracker(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.enrichment == nil {
+		oneAgentDimensions := oneagentenrichment.GetOneAgentMetadata()
+		c.enrichment = func() dimensions.NormalizedDimensionList { return oneAgentDimensions }
+	}
+	if c.clockTicks <= 0 {
+		c.clockTicks = defaultClockTicks
+	}
+
+	return c
+}
+
+// Collect reads the process metrics. If some files cannot be read, the metrics from all other files are returned
+// together with an error.
+func (c *Collector) Collect() ([]*metric.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	samples := []sampling.Sample{}
+	errs := []string{}
+
+	for _, read := range []func() ([]sampling.Sample, error){c.readStat, c.readStatus, c.readIO, c.readFDs} {
+		s, err := read()
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		samples = append(samples, s...)
+	}
+
+	dims := dimensions.MergeLists(c.defaultDimensions, c.enrichment())
+	result := make([]*metric.Metric, 0, len(samples))
+	for _, s := range samples {
+		value, ok := s.MetricValue(c.tracker, s.Key)
+		if !ok {
+			continue
+		}
+
+		m, err := metric.NewMetric(s.Key, metric.WithPrefix(c.prefix), metric.WithDimensions(dims), value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("'%s': %v", s.Key, err))
+			continue
+		}
+		result = append(result, m)
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("could not collect all process metrics: %s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// readStat reads the user and system CPU times from the stat file.
+func (c *Collector) readStat() ([]sampling.Sample, error) {
+	name := path.Join(c.procDir, "stat")
+	content, err := fs.ReadFile(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the command name in parentheses may contain spaces and parentheses, so fields are counted after the last ")".
+	stat := string(content)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return nil, fmt.Errorf("%s: missing command name", name)
+	}
+	// fields[0] is the state, which is field 3 of the file.
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 13 {
+		return nil, fmt.Errorf("%s: expected at least 15 fields, got %d", name, len(fields)+2)
+	}
+
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid utime '%s'", name, fields[11])
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid stime '%s'", name, fields[12])
+	}
+
+	ticks := float64(c.clockTicks)
+	return []sampling.Sample{
+		{Key: "cpu.user.seconds", Value: utime, Divisor: ticks, Cumulative: true},
+		{Key: "cpu.system.seconds", Value: stime, Divisor: ticks, Cumulative: true},
+	}, nil
+}
+
+// readKeyValues reads a file of "key: value" lines and returns the values of the requested keys.
+func (c *Collector) readKeyValues(file string, keys map[string]bool) (map[string]string, error) {
+	f, err := c.fsys.Open(path.Join(c.procDir, file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) == 2 && keys[kv[0]] {
+			values[kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+	return values, scanner.Err()
+}
+
+// readStatus reads the resident set size, the virtual memory size and the thread count from the status file.
+func (c *Collector) readStatus() ([]sampling.Sample, error) {
+	values, err := c.readKeyValues("status", map[string]bool{"VmRSS": true, "VmSize": true, "Threads": true})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []sampling.Sample{}
+	errs := []string{}
+	for _, field := range []struct{ name, key string }{
+		{"VmRSS", "memory.rss.bytes"},
+		{"VmSize", "memory.virtual.bytes"},
+		{"Threads", "threads"},
+	} {
+		raw, ok := values[field.name]
+		if !ok {
+			// kernel threads and zombies have no memory fields.
+			continue
+		}
+
+		var multiplier int64 = 1
+		if strings.HasSuffix(raw, " kB") {
+			raw = strings.TrimSuffix(raw, " kB")
+			multiplier = 1024
+		}
+		v, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid %s '%s'", field.name, values[field.name]))
+			continue
+		}
+		result = append(result, sampling.Sample{Key: field.key, Value: v * multiplier})
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%s: %s", path.Join(c.procDir, "status"), strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// readIO reads the bytes read from and written to storage from the io file, which is only readable by the owner
+// of the process.
+func (c *Collector) readIO() ([]sampling.Sample, error) {
+	values, err := c.readKeyValues("io", map[string]bool{"read_bytes": true, "write_bytes": true})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []sampling.Sample{}
+	for _, field := range []struct{ name, key string }{
+		{"read_bytes", "io.read.bytes"},
+		{"write_bytes", "io.write.bytes"},
+	} {
+		raw, ok := values[field.name]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return result, fmt.Errorf("%s: invalid %s '%s'", path.Join(c.procDir, "io"), field.name, raw)
+		}
+		result = append(result, sampling.Sample{Key: field.key, Value: v, Cumulative: true})
+	}
+	return result, nil
+}
+
+// readFDs counts the entries of the fd directory.
+func (c *Collector) readFDs() ([]sampling.Sample, error) {
+	entries, err := fs.ReadDir(c.fsys, path.Join(c.procDir, "fd"))
+	if err != nil {
+		return nil, err
+	}
+	return []sampling.Sample{{Key: "fds.open", Value: int64(len(entries))}}, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procmetrics
+
+import (
+	"io/fs"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/enrichment"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// switchFS allows replacing the fixture tree between two collections.
+type switchFS struct {
+	fs.FS
+}
+
+func noEnrichment() Option {
+	return WithEnrichmentProvider(enrichment.NewEnrichmentProvider(nil, enrichment.WithRefreshInterval(0)))
+}
+
+func TestCollector_Collect(t *testing.T) {
+	fsys := &switchFS{os.DirFS("testdata/first")}
+	c := NewCollector(
+		WithFS(fsys),
+		WithPrefix("myapp.process"),
+		noEnrichment(),
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("env", "test"))),
+	)
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	// cumulative values are only reported from the second collection on
+	want := linetest.CanonicalLines([]string{
+		"myapp.process.fds.open,env=test gauge,3",
+		"myapp.process.memory.rss.bytes,env=test gauge,16777216",
+		"myapp.process.memory.virtual.bytes,env=test gauge,734003200",
+		"myapp.process.threads,env=test gauge,8",
+	})
+	if got := linetest.CanonicalLines(linetest.Serialize(t, metrics)); !reflect.DeepEqual(got, want) {
+		t.Errorf("first Collect() = %v, want %v", got, want)
+	}
+
+	fsys.FS = os.DirFS("testdata/second")
+	metrics, err = c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	want = linetest.CanonicalLines([]string{
+		"myapp.process.cpu.system.seconds,env=test count,delta=0.1",
+		"myapp.process.cpu.user.seconds,env=test count,delta=0.25",
+		"myapp.process.fds.open,env=test gauge,5",
+		"myapp.process.io.read.bytes,env=test count,delta=8192",
+		"myapp.process.io.write.bytes,env=test count,delta=0",
+		"myapp.process.memory.rss.bytes,env=test gauge,20971520",
+		"myapp.process.memory.virtual.bytes,env=test gauge,734003200",
+		"myapp.process.threads,env=test gauge,9",
+	})
+	if got := linetest.CanonicalLines(linetest.Serialize(t, metrics)); !reflect.DeepEqual(got, want) {
+		t.Errorf("second Collect() = %v, want %v", got, want)
+	}
+}
+
+func TestCollector_ClockTicks(t *testing.T) {
+	fsys := &switchFS{os.DirFS("testdata/first")}
+	c := NewCollector(WithFS(fsys), WithClockTicks(1000), noEnrichment())
+
+	if _, err := c.Collect(); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	fsys.FS = os.DirFS("testdata/second")
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	lines := linetest.Serialize(t, metrics)
+	for _, want := range []string{"process.cpu.user.seconds count,delta=0.025", "process.cpu.system.seconds count,delta=0.01"} {
+		found := false
+		for _, line := range lines {
+			found = found || line == want
+		}
+		if !found {
+			t.Errorf("Collect() = %v, missing %q", lines, want)
+		}
+	}
+}
+
+func TestCollector_MissingFiles(t *testing.T) {
+	c := NewCollector(WithFS(os.DirFS("testdata/minimal")), noEnrichment())
+
+	metrics, err := c.Collect()
+	if err == nil {
+		t.Fatal("Collect() expected error for missing files")
+	}
+	for _, file := range []string{"status", "io", "fd"} {
+		if !strings.Contains(err.Error(), "proc/self/"+file) {
+			t.Errorf("Collect() error = %v, want it to mention %s", err, file)
+		}
+	}
+	// the stat file is only cumulative, so nothing is reported on the first collection
+	if len(metrics) != 0 {
+		t.Errorf("Collect() = %v, want no metrics", linetest.Serialize(t, metrics))
+	}
+}
+
+func TestCollector_ProcDir(t *testing.T) {
+	c := NewCollector(WithFS(os.DirFS("testdata/first/proc")), WithProcDir("self"), noEnrichment())
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(metrics) != 4 {
+		t.Errorf("Collect() = %v, want 4 metrics", linetest.Serialize(t, metrics))
+	}
+}
+
+func TestReadStat_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		stat string
+		want string
+	}{
+		{"no command", "4242 S 1", "missing command name"},
+		{"too short", "4242 (app) S 1 2 3", "expected at least 15 fields"},
+		{"invalid utime", "4242 (app) S 1 4242 4242 0 -1 0 0 0 0 0 x 50", "invalid utime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.MkdirAll(dir+"/proc/self", 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dir+"/proc/self/stat", []byte(tt.stat), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			c := NewCollector(WithFS(os.DirFS(dir)), noEnrichment())
+			if _, err := c.readStat(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("readStat() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
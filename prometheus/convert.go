@@ -0,0 +1,316 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/estimate"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// Option represents the function interface used to configure the Converter.
+type Option func(c *Converter)
+
+// WithPrefix sets a prefix that is prepended to all metric keys.
+func WithPrefix(prefix string) Option {
+	return func(c *Converter) {
+		c.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics. Labels with the same (normalized) key
+// overwrite the default dimensions.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(c *Converter) {
+		c.defaultDimensions = dims
+	}
+}
+
+// Converter converts Prometheus metric families to Dynatrace metrics.
+// Counters, histograms and summaries are cumulative in Prometheus, while Dynatrace expects deltas. The Converter
+// therefore remembers the last value of every series, and a series only produces data from its second observation on.
+// Use one Converter per scrape target. It is safe for concurrent use, but concurrent calls with the same
+// series will produce unexpected deltas.
+type Converter struct {
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	tracker           *aggregation.CumulativeTracker
+}
+
+// NewConverter creates a new Converter without any cumulative state.
+func NewConverter(opts ...Option) *Converter {
+	c := &Converter{
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		tracker:           aggregation.NewCumulativeTracker(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Convert parses the text exposition format from reader and converts it using ConvertFamilies.
+func (c *Converter) Convert(reader io.Reader) ([]*metric.Metric, error) {
+	families, err := Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ConvertFamilies(families)
+}
+
+// ConvertFamilies converts the passed metric families, which are expected to be a complete exposition of a target:
+// the state of series that are not contained in the families is dropped.
+// Counters are converted to "count,delta=" values, gauges and untyped metrics to "gauge," values, and histograms and
+// summaries to "gauge,min=,max=,sum=,count=" values using the deltas of their sum and count. The min and max of
+// histograms are estimated from the bucket boundaries. Non-finite values, the _created series, and the OpenMetrics
+// types gaugehistogram, stateset and info are skipped.
+// If some samples cannot be converted, all other metrics are returned together with an error.
+func (c *Converter) ConvertFamilies(families []*MetricFamily) ([]*metric.Metric, error) {
+	result := []*metric.Metric{}
+	errs := []string{}
+
+	add := func(m *metric.Metric, err error) {
+		if err != nil {
+			errs = append(errs, err.Error())
+			return
+		}
+		if m != nil {
+			result = append(result, m)
+		}
+	}
+
+	for _, f := range families {
+		switch f.Type {
+		case TypeCounter:
+			for _, s := range f.Samples {
+				if s.Name == f.Name+"_created" {
+					continue
+				}
+				add(c.convertCounter(s))
+			}
+		case TypeGauge, TypeUntyped, TypeUnknown:
+			for _, s := range f.Samples {
+				add(c.convertGauge(s))
+			}
+		case TypeHistogram:
+			for _, group := range groupSamples(f) {
+				add(c.convertHistogram(f.Name, group))
+			}
+		case TypeSummary:
+			for _, group := range groupSamples(f) {
+				add(c.convertSummary(f.Name, group))
+			}
+		}
+	}
+
+	c.tracker.Sweep()
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("could not convert %d sample(s): %s", len(errs), strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+func (c *Converter) newMetric(name string, labels []Label, sample Sample, value metric.MetricOption) (*metric.Metric, error) {
+	dims := make([]dimensions.Dimension, 0, len(labels))
+	for _, l := range labels {
+		// empty labels are equivalent to missing labels in Prometheus.
+		if l.Value != "" {
+			dims = append(dims, dimensions.NewDimension(l.Name, l.Value))
+		}
+	}
+
+	opts := []metric.MetricOption{
+		metric.WithPrefix(c.prefix),
+		metric.WithDimensions(dimensions.MergeLists(c.defaultDimensions, dimensions.NewNormalizedDimensionList(dims...))),
+		value,
+	}
+	if !sample.Timestamp.IsZero() {
+		opts = append(opts, metric.WithTimestamp(sample.Timestamp))
+	}
+
+	return metric.NewMetric(name, opts...)
+}
+
+func isFinite(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Converter) convertCounter(s Sample) (*metric.Metric, error) {
+	if !isFinite(s.Value) {
+		return nil, nil
+	}
+
+	delta, ok := c.tracker.FloatDelta(seriesKey(s.Name, s.Labels), s.Value)
+	if !ok {
+		return nil, nil
+	}
+
+	return c.newMetric(s.Name, s.Labels, s, metric.WithFloatCounterValueDelta(delta))
+}
+
+func (c *Converter) convertGauge(s Sample) (*metric.Metric, error) {
+	if !isFinite(s.Value) {
+		return nil, nil
+	}
+
+	return c.newMetric(s.Name, s.Labels, s, metric.WithFloatGaugeValue(s.Value))
+}
+
+type bucket struct {
+	upperBound float64
+	count      float64
+}
+
+// sampleGroup contains the samples of one histogram or summary series, i.e. all samples of a family
+// with the same labels, ignoring "le" and "quantile".
+type sampleGroup struct {
+	labels    []Label
+	sum       *Sample
+	count     *Sample
+	buckets   []bucket
+	quantiles map[float64]float64
+}
+
+func groupSamples(f *MetricFamily) []*sampleGroup {
+	groups := []*sampleGroup{}
+	byKey := map[string]*sampleGroup{}
+
+	for i := range f.Samples {
+		s := &f.Samples[i]
+
+		labels := make([]Label, 0, len(s.Labels))
+		for _, l := range s.Labels {
+			if l.Name != "le" && l.Name != "quantile" {
+				labels = append(labels, l)
+			}
+		}
+
+		key := seriesKey("", labels)
+		g, ok := byKey[key]
+		if !ok {
+			g = &sampleGroup{labels: labels, quantiles: map[float64]float64{}}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+
+		switch s.Name {
+		case f.Name + "_sum":
+			g.sum = s
+		case f.Name + "_count":
+			g.count = s
+		case f.Name + "_bucket":
+			if le, err := parseFloat(s.Label("le")); err == nil {
+				g.buckets = append(g.buckets, bucket{upperBound: le, count: s.Value})
+			}
+		case f.Name:
+			if q, err := parseFloat(s.Label("quantile")); err == nil {
+				g.quantiles[q] = s.Value
+			}
+		}
+	}
+
+	return groups
+}
+
+// deltas returns the deltas of sum and count. ok is false if any of the two cannot produce a delta yet.
+func (c *Converter) deltas(name string, g *sampleGroup) (sum float64, count int64, ok bool) {
+	if g.sum == nil || g.count == nil || !isFinite(g.sum.Value, g.count.Value) {
+		return 0, 0, false
+	}
+
+	sum, sumOk := c.tracker.FloatDelta(seriesKey(name+"_sum", g.labels), g.sum.Value)
+	countDelta, countOk := c.tracker.FloatDelta(seriesKey(name+"_count", g.labels), g.count.Value)
+	return sum, int64(math.Round(countDelta)), sumOk && countOk
+}
+
+func (c *Converter) convertHistogram(name string, g *sampleGroup) (*metric.Metric, error) {
+	sort.Slice(g.buckets, func(i, j int) bool { return g.buckets[i].upperBound < g.buckets[j].upperBound })
+
+	// the bucket deltas have to be tracked in every round, even if no metric is produced.
+	// The buckets are cumulative, so the values in the range of a bucket are the difference to the previous one.
+	ranges := make([]estimate.Bucket, 0, len(g.buckets))
+	bucketsOk := true
+	bucketLabels := make([]Label, len(g.labels), len(g.labels)+1)
+	copy(bucketLabels, g.labels)
+	previousBound, previousDelta := math.Inf(-1), 0.0
+	for _, b := range g.buckets {
+		le := Label{Name: "le", Value: strconv.FormatFloat(b.upperBound, 'g', -1, 64)}
+		key := seriesKey(name+"_bucket", append(bucketLabels, le))
+		delta, ok := c.tracker.FloatDelta(key, b.count)
+		bucketsOk = bucketsOk && ok
+		ranges = append(ranges, estimate.Bucket{Lower: previousBound, Upper: b.upperBound, Count: delta - previousDelta})
+		previousBound, previousDelta = b.upperBound, delta
+	}
+
+	sum, count, ok := c.deltas(name, g)
+	if !ok || count <= 0 {
+		return nil, nil
+	}
+
+	mean := sum / float64(count)
+	min, max := mean, mean
+	if bucketsOk {
+		min, max = estimate.MinMax(ranges, mean)
+	}
+
+	return c.newMetric(name, g.labels, *g.count, metric.WithFloatSummaryValue(min, max, sum, count))
+}
+
+func (c *Converter) convertSummary(name string, g *sampleGroup) (*metric.Metric, error) {
+	sum, count, ok := c.deltas(name, g)
+	if !ok || count <= 0 {
+		return nil, nil
+	}
+
+	mean := sum / float64(count)
+	min, max := mean, mean
+	// the quantiles are calculated over a sliding window, so they are only an approximation for the delta.
+	if q, ok := g.quantiles[0]; ok && isFinite(q) {
+		min = math.Min(q, mean)
+	}
+	if q, ok := g.quantiles[1]; ok && isFinite(q) {
+		max = math.Max(q, mean)
+	}
+
+	return c.newMetric(name, g.labels, *g.count, metric.WithFloatSummaryValue(min, max, sum, count))
+}
+
+// seriesKey identifies a series by its name and labels, independent of the order of the labels.
+func seriesKey(name string, labels []Label) string {
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		pairs = append(pairs, strconv.Quote(l.Name)+"="+strconv.Quote(l.Value))
+	}
+	sort.Strings(pairs)
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
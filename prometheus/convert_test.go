@@ -0,0 +1,189 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func convert(t *testing.T, c *Converter, input string) []string {
+	t.Helper()
+
+	metrics, err := c.Convert(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	return linetest.Serialize(t, metrics)
+}
+
+func TestConverter_Counter(t *testing.T) {
+	c := NewConverter()
+	scrape := func(a, b string) string {
+		return "# TYPE requests_total counter\n" +
+			`requests_total{code="200",method="get"} ` + a + "\n" +
+			`requests_total{code="500",method="get"} ` + b + "\n"
+	}
+
+	if got := convert(t, c, scrape("10", "1")); len(got) != 0 {
+		t.Errorf("first scrape produced %v, want no lines", got)
+	}
+
+	got := convert(t, c, scrape("15", "1"))
+	want := []string{
+		"requests_total,code=200,method=get count,delta=5",
+		"requests_total,code=500,method=get count,delta=0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second scrape = %v, want %v", got, want)
+	}
+
+	// counter reset
+	got = convert(t, c, scrape("3", "2"))
+	want = []string{
+		"requests_total,code=200,method=get count,delta=3",
+		"requests_total,code=500,method=get count,delta=1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("third scrape = %v, want %v", got, want)
+	}
+}
+
+func TestConverter_OpenMetricsCounter(t *testing.T) {
+	c := NewConverter()
+	input := func(v string) string {
+		return "# TYPE jobs counter\njobs_total " + v + "\njobs_created 1.6e9\n# EOF\n"
+	}
+
+	convert(t, c, input("1"))
+	got := convert(t, c, input("4"))
+	want := []string{"jobs_total count,delta=3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert() = %v, want %v", got, want)
+	}
+}
+
+func TestConverter_Gauge(t *testing.T) {
+	c := NewConverter(
+		WithPrefix("prom"),
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(
+			dimensions.NewDimension("job", "default"),
+			dimensions.NewDimension("instance", "localhost:9090"),
+		)),
+	)
+
+	input := `# TYPE temperature gauge
+temperature{room="kitchen",job="sensors"} 21.5 1636000000000
+temperature{room="cellar",empty=""} -3
+temperature{room="attic"} NaN
+untyped_metric 42
+`
+
+	got := convert(t, c, input)
+	want := []string{
+		"prom.temperature,instance=localhost:9090,job=default,room=cellar gauge,-3",
+		"prom.temperature,instance=localhost:9090,job=sensors,room=kitchen gauge,21.5 1636000000000",
+		"prom.untyped_metric,instance=localhost:9090,job=default gauge,42",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert() = %v, want %v", got, want)
+	}
+}
+
+func TestConverter_Histogram(t *testing.T) {
+	c := NewConverter()
+	scrape := func(b1, b2, b3, bInf, sum, count string) string {
+		return "# TYPE latency_seconds histogram\n" +
+			`latency_seconds_bucket{path="/",le="0.1"} ` + b1 + "\n" +
+			`latency_seconds_bucket{path="/",le="0.5"} ` + b2 + "\n" +
+			`latency_seconds_bucket{path="/",le="1"} ` + b3 + "\n" +
+			`latency_seconds_bucket{path="/",le="+Inf"} ` + bInf + "\n" +
+			`latency_seconds_sum{path="/"} ` + sum + "\n" +
+			`latency_seconds_count{path="/"} ` + count + "\n"
+	}
+
+	if got := convert(t, c, scrape("1", "2", "3", "3", "1.0", "3")); len(got) != 0 {
+		t.Errorf("first scrape produced %v, want no lines", got)
+	}
+
+	// 2 new observations in (0.1, 0.5] and 1 in (0.5, 1]
+	got := convert(t, c, scrape("1", "4", "6", "6", "2.5", "6"))
+	want := []string{"latency_seconds,path=/ gauge,min=0.1,max=1,sum=1.5,count=3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second scrape = %v, want %v", got, want)
+	}
+
+	// no new observations
+	if got := convert(t, c, scrape("1", "4", "6", "6", "2.5", "6")); len(got) != 0 {
+		t.Errorf("third scrape produced %v, want no lines", got)
+	}
+
+	// 1 new observation in the +Inf bucket
+	got = convert(t, c, scrape("1", "4", "6", "7", "7.5", "7"))
+	want = []string{"latency_seconds,path=/ gauge,min=1,max=5,sum=5,count=1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fourth scrape = %v, want %v", got, want)
+	}
+}
+
+func TestConverter_Summary(t *testing.T) {
+	c := NewConverter()
+	scrape := func(q0, q1, sum, count string) string {
+		return "# TYPE rpc_seconds summary\n" +
+			`rpc_seconds{quantile="0"} ` + q0 + "\n" +
+			`rpc_seconds{quantile="0.5"} 0.2` + "\n" +
+			`rpc_seconds{quantile="1"} ` + q1 + "\n" +
+			`rpc_seconds_sum ` + sum + "\n" +
+			`rpc_seconds_count ` + count + "\n"
+	}
+
+	convert(t, c, scrape("0.1", "0.4", "1", "4"))
+	got := convert(t, c, scrape("0.05", "0.9", "2", "8"))
+	want := []string{"rpc_seconds gauge,min=0.05,max=0.9,sum=1,count=4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert() = %v, want %v", got, want)
+	}
+
+	// without quantiles, the mean is used as min and max
+	c = NewConverter()
+	convert(t, c, "# TYPE s summary\ns_sum 1\ns_count 1\n")
+	got = convert(t, c, "# TYPE s summary\ns_sum 3\ns_count 3\n")
+	want = []string{"s gauge,min=1,max=1,sum=2,count=2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert() = %v, want %v", got, want)
+	}
+}
+
+func TestConverter_DisappearedSeries(t *testing.T) {
+	c := NewConverter()
+	convert(t, c, "# TYPE c counter\nc 5\n")
+	convert(t, c, "# TYPE other counter\nother 1\n")
+
+	// the state of c was dropped, so this is a first observation again
+	if got := convert(t, c, "# TYPE c counter\nc 7\n"); len(got) != 0 {
+		t.Errorf("Convert() = %v, want no lines", got)
+	}
+}
+
+func TestConverter_ParseError(t *testing.T) {
+	c := NewConverter()
+	if _, err := c.Convert(strings.NewReader("metric{ 1")); err == nil {
+		t.Error("Convert() expected error")
+	}
+}
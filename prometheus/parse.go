@@ -0,0 +1,360 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricType is the type of a metric family, as declared in the TYPE line.
+type MetricType string
+
+// Metric types of the Prometheus text format and OpenMetrics.
+const (
+	TypeCounter        MetricType = "counter"
+	TypeGauge          MetricType = "gauge"
+	TypeHistogram      MetricType = "histogram"
+	TypeSummary        MetricType = "summary"
+	TypeUntyped        MetricType = "untyped"
+	TypeUnknown        MetricType = "unknown"
+	TypeGaugeHistogram MetricType = "gaugehistogram"
+	TypeStateSet       MetricType = "stateset"
+	TypeInfo           MetricType = "info"
+)
+
+// timestamps smaller than this are interpreted as seconds (OpenMetrics) instead of milliseconds (Prometheus).
+// 1e11 milliseconds is in 1973, while 1e11 seconds is in the year 5138.
+const secondsTimestampThreshold = 1e11
+
+// Label is a single name-value pair of a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single line of the exposition format.
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+	// Timestamp is the zero time if the sample has no timestamp.
+	Timestamp time.Time
+}
+
+// Label returns the value of the label with the passed name, or an empty string if the sample has no such label.
+func (s Sample) Label(name string) string {
+	for _, l := range s.Labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// MetricFamily contains all samples that belong to one metric, e.g. the buckets, sum and count of a histogram.
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	Samples []Sample
+}
+
+// ParseError describes a line that could not be parsed.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// suffixes of sample names that belong to the family without the suffix, depending on the family type.
+var familySuffixes = map[MetricType][]string{
+	TypeCounter:        {"_total", "_created"},
+	TypeHistogram:      {"_bucket", "_sum", "_count", "_created"},
+	TypeSummary:        {"_sum", "_count", "_created"},
+	TypeGaugeHistogram: {"_bucket", "_gsum", "_gcount"},
+	TypeInfo:           {"_info"},
+}
+
+var allSuffixes = []string{"_total", "_created", "_bucket", "_sum", "_count", "_gsum", "_gcount", "_info"}
+
+type parser struct {
+	families []*MetricFamily
+	byName   map[string]*MetricFamily
+}
+
+func (p *parser) family(name string) *MetricFamily {
+	if f, ok := p.byName[name]; ok {
+		return f
+	}
+	f := &MetricFamily{Name: name, Type: TypeUntyped}
+	p.families = append(p.families, f)
+	p.byName[name] = f
+	return f
+}
+
+// familyForSample finds the family a sample belongs to, taking the type specific suffixes into account.
+func (p *parser) familyForSample(name string) *MetricFamily {
+	if f, ok := p.byName[name]; ok {
+		return f
+	}
+	for _, suffix := range allSuffixes {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		f, ok := p.byName[strings.TrimSuffix(name, suffix)]
+		if !ok {
+			continue
+		}
+		for _, allowed := range familySuffixes[f.Type] {
+			if allowed == suffix {
+				return f
+			}
+		}
+	}
+	return p.family(name)
+}
+
+// Parse reads metric families in the Prometheus text exposition format or the OpenMetrics text format.
+// Families are returned in the order in which they first appear. Samples without a preceding TYPE line
+// are returned in families of type untyped. Exemplars are ignored.
+// Parsing stops at the first malformed line, in which case a *ParseError is returned.
+func Parse(reader io.Reader) ([]*MetricFamily, error) {
+	if reader == nil {
+		return nil, errors.New("reader cannot be nil")
+	}
+
+	p := &parser{byName: map[string]*MetricFamily{}}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			if line == "# EOF" {
+				break
+			}
+			if err := p.parseComment(line); err != nil {
+				return nil, &ParseError{Line: lineNumber, Msg: err.Error()}
+			}
+			continue
+		}
+
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, &ParseError{Line: lineNumber, Msg: err.Error()}
+		}
+		f := p.familyForSample(sample.Name)
+		f.Samples = append(f.Samples, sample)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return p.families, nil
+}
+
+// parseComment handles HELP and TYPE lines. All other comments are ignored.
+func (p *parser) parseComment(line string) error {
+	fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+	if len(fields) < 2 {
+		return nil
+	}
+
+	switch fields[0] {
+	case "HELP":
+		help := ""
+		if len(fields) == 3 {
+			help = unescapeHelp(fields[2])
+		}
+		p.family(fields[1]).Help = help
+	case "TYPE":
+		if len(fields) != 3 {
+			return fmt.Errorf("missing type for metric '%s'", fields[1])
+		}
+		metricType := MetricType(strings.ToLower(strings.TrimSpace(fields[2])))
+		switch metricType {
+		case TypeCounter, TypeGauge, TypeHistogram, TypeSummary, TypeUntyped, TypeUnknown,
+			TypeGaugeHistogram, TypeStateSet, TypeInfo:
+		default:
+			return fmt.Errorf("unknown type '%s' for metric '%s'", fields[2], fields[1])
+		}
+		f := p.family(fields[1])
+		if len(f.Samples) > 0 {
+			return fmt.Errorf("TYPE line for metric '%s' after its samples", fields[1])
+		}
+		f.Type = metricType
+	}
+	return nil
+}
+
+func unescapeHelp(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(s)
+}
+
+func isNameChar(c byte, first bool) bool {
+	if c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	return !first && c >= '0' && c <= '9'
+}
+
+// parseSample parses a line of the format: name[{label="value",...}] value [timestamp] [# exemplar]
+func parseSample(line string) (Sample, error) {
+	s := Sample{}
+
+	i := 0
+	for i < len(line) && isNameChar(line[i], i == 0) {
+		i++
+	}
+	if i == 0 {
+		return s, fmt.Errorf("invalid metric name in '%s'", line)
+	}
+	s.Name = line[:i]
+
+	if i < len(line) && line[i] == '{' {
+		labels, end, err := parseLabels(line, i+1)
+		if err != nil {
+			return s, err
+		}
+		s.Labels = labels
+		i = end
+	}
+
+	rest := line[i:]
+	if index := strings.Index(rest, " # "); index >= 0 {
+		// OpenMetrics exemplar
+		rest = rest[:index]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return s, fmt.Errorf("expected value and optional timestamp in '%s'", line)
+	}
+
+	value, err := parseFloat(fields[0])
+	if err != nil {
+		return s, fmt.Errorf("invalid value '%s': %v", fields[0], err)
+	}
+	s.Value = value
+
+	if len(fields) == 2 {
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return s, fmt.Errorf("invalid timestamp '%s': %v", fields[1], err)
+		}
+		if math.Abs(ts) < secondsTimestampThreshold {
+			s.Timestamp = time.Unix(0, int64(ts*float64(time.Second)))
+		} else {
+			s.Timestamp = time.Unix(0, int64(ts)*int64(time.Millisecond))
+		}
+	}
+
+	return s, nil
+}
+
+func parseFloat(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "+inf", "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseLabels parses the labels starting after the opening brace at index start and returns the index after
+// the closing brace.
+func parseLabels(line string, start int) ([]Label, int, error) {
+	labels := []Label{}
+	i := start
+
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == ',') {
+			i++
+		}
+		if i >= len(line) {
+			return nil, 0, fmt.Errorf("unterminated label set in '%s'", line)
+		}
+		if line[i] == '}' {
+			return labels, i + 1, nil
+		}
+
+		nameStart := i
+		for i < len(line) && isNameChar(line[i], i == nameStart) {
+			i++
+		}
+		name := line[nameStart:i]
+		if name == "" {
+			return nil, 0, fmt.Errorf("invalid label name in '%s'", line)
+		}
+
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i+1 >= len(line) || line[i] != '=' || line[i+1] != '"' {
+			return nil, 0, fmt.Errorf("expected =\" after label '%s' in '%s'", name, line)
+		}
+		i += 2
+
+		var sb strings.Builder
+		closed := false
+		for i < len(line) {
+			c := line[i]
+			i++
+			if c == '"' {
+				closed = true
+				break
+			}
+			if c == '\\' && i < len(line) {
+				switch line[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case '"', '\\':
+					sb.WriteByte(line[i])
+				default:
+					sb.WriteByte('\\')
+					sb.WriteByte(line[i])
+				}
+				i++
+				continue
+			}
+			sb.WriteByte(c)
+		}
+		if !closed {
+			return nil, 0, fmt.Errorf("unterminated value for label '%s' in '%s'", name, line)
+		}
+
+		labels = append(labels, Label{Name: name, Value: sb.String()})
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	input := `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# a comment that is ignored
+msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\""} 1.458255915e9
+
+# HELP http_request_duration_seconds A histogram of the request duration.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.05"} 24054
+http_request_duration_seconds_bucket{le="+Inf"} 144320
+http_request_duration_seconds_sum 53423
+http_request_duration_seconds_count 144320
+
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 4773
+rpc_duration_seconds_sum 1.7560473e+07
+rpc_duration_seconds_count 2693
+# TYPE temperature gauge
+temperature NaN
+temperature{room="kitchen"} -Inf
+`
+
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	ts := time.Unix(0, 1395066363000*int64(time.Millisecond))
+	wantNames := []string{"http_requests_total", "msdos_file_access_time_seconds", "http_request_duration_seconds", "rpc_duration_seconds", "temperature"}
+	wantTypes := []MetricType{TypeCounter, TypeUntyped, TypeHistogram, TypeSummary, TypeGauge}
+	wantSamples := []int{2, 1, 4, 3, 2}
+
+	if len(got) != len(wantNames) {
+		t.Fatalf("Parse() returned %d families, want %d", len(got), len(wantNames))
+	}
+	for i, f := range got {
+		if f.Name != wantNames[i] || f.Type != wantTypes[i] || len(f.Samples) != wantSamples[i] {
+			t.Errorf("family %d = (%s, %s, %d samples), want (%s, %s, %d samples)",
+				i, f.Name, f.Type, len(f.Samples), wantNames[i], wantTypes[i], wantSamples[i])
+		}
+	}
+
+	if got[0].Help != "The total number of HTTP requests." {
+		t.Errorf("Help = %q", got[0].Help)
+	}
+
+	wantFirst := Sample{
+		Name:      "http_requests_total",
+		Labels:    []Label{{"method", "post"}, {"code", "200"}},
+		Value:     1027,
+		Timestamp: ts,
+	}
+	if !reflect.DeepEqual(got[0].Samples[0], wantFirst) {
+		t.Errorf("first sample = %+v, want %+v", got[0].Samples[0], wantFirst)
+	}
+
+	wantEscaped := []Label{{"path", `C:\DIR\FILE.TXT`}, {"error", "Cannot find file:\n\"FILE.TXT\""}}
+	if !reflect.DeepEqual(got[1].Samples[0].Labels, wantEscaped) {
+		t.Errorf("escaped labels = %q, want %q", got[1].Samples[0].Labels, wantEscaped)
+	}
+
+	if le := got[2].Samples[1].Label("le"); le != "+Inf" {
+		t.Errorf("le label = %q, want +Inf", le)
+	}
+	if v := got[4].Samples[0].Value; !math.IsNaN(v) {
+		t.Errorf("NaN gauge = %v", v)
+	}
+	if v := got[4].Samples[1].Value; !math.IsInf(v, -1) {
+		t.Errorf("-Inf gauge = %v", v)
+	}
+}
+
+func TestParse_OpenMetrics(t *testing.T) {
+	input := `# TYPE acme_http_router_request counter
+# UNIT acme_http_router_request seconds
+acme_http_router_request_total{path="/api/v1",method="GET"} 1.4e3 # {trace_id="KOO5S4vxi0o"} 0.67
+acme_http_router_request_created{path="/api/v1",method="GET"} 1.6053408e9
+# TYPE build info
+build_info{version="1.0"} 1
+# EOF
+ignored_after_eof 1
+`
+
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Parse() returned %d families, want 2", len(got))
+	}
+	if len(got[0].Samples) != 2 || got[0].Samples[0].Value != 1400 {
+		t.Errorf("counter family = %+v", got[0])
+	}
+	wantCreated := time.Unix(1605340800, 0)
+	if s := got[0].Samples[1]; s.Value != 1.6053408e9 || !s.Timestamp.IsZero() {
+		t.Errorf("created sample = %+v", s)
+	}
+	if got[1].Type != TypeInfo || got[1].Samples[0].Name != "build_info" {
+		t.Errorf("info family = %+v", got[1])
+	}
+
+	// OpenMetrics timestamps are in seconds
+	withSeconds, err := Parse(strings.NewReader("m 1 1605340800\nm 2 1605340800.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := withSeconds[0].Samples[0].Timestamp; !ts.Equal(wantCreated) {
+		t.Errorf("timestamp = %v, want %v", ts, wantCreated)
+	}
+	if ts := withSeconds[0].Samples[1].Timestamp; !ts.Equal(wantCreated.Add(500 * time.Millisecond)) {
+		t.Errorf("timestamp = %v, want %v", ts, wantCreated.Add(500*time.Millisecond))
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "missing value", input: "metric"},
+		{name: "invalid value", input: "metric abc"},
+		{name: "invalid timestamp", input: "metric 1 abc"},
+		{name: "too many fields", input: "metric 1 2 3"},
+		{name: "unterminated labels", input: `metric{a="b" 1`},
+		{name: "unterminated label value", input: `metric{a="b} 1`},
+		{name: "unquoted label value", input: `metric{a=b} 1`},
+		{name: "invalid name", input: `0metric 1`},
+		{name: "unknown type", input: "# TYPE metric foo"},
+		{name: "type after samples", input: "metric 1\n# TYPE metric gauge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("Parse() error = %v, want *ParseError", err)
+			}
+		})
+	}
+}
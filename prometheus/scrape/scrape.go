@@ -0,0 +1,328 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scrape periodically scrapes Prometheus endpoints and forwards the converted metrics to an exporter.
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/exporter"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/prometheus"
+)
+
+const (
+	// JobDimension is the dimension that holds the job name of a target.
+	JobDimension = "job"
+	// InstanceDimension is the dimension that holds the host and port of a target.
+	InstanceDimension = "instance"
+
+	// UpMetric is 1 if the last scrape of a target succeeded, and 0 otherwise.
+	UpMetric = "up"
+	// ScrapeDurationMetric is the duration of the last scrape of a target in seconds.
+	ScrapeDurationMetric = "scrape_duration_seconds"
+	// ScrapeSamplesMetric is the number of samples that were parsed in the last scrape of a target. Histograms and
+	// summaries consist of several samples, and counters are converted to metrics only from the second scrape on, so
+	// this can differ from the number of exported metrics.
+	ScrapeSamplesMetric = "scrape_samples_scraped"
+
+	defaultInterval = time.Minute
+	defaultTimeout  = 10 * time.Second
+
+	acceptHeader = "application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.4,*/*;q=0.1"
+)
+
+// Target is a Prometheus endpoint to scrape.
+type Target struct {
+	// Job is added to all metrics of the target as the "job" dimension.
+	Job string
+	// URL is the full URL of the metrics endpoint, e.g. "http://localhost:9100/metrics".
+	// Its host and port are added to all metrics of the target as the "instance" dimension.
+	URL string
+}
+
+// Option represents the function interface used to configure the Scraper.
+type Option func(s *Scraper)
+
+// WithInterval sets the interval in which all targets are scraped. Defaults to one minute.
+func WithInterval(interval time.Duration) Option {
+	return func(s *Scraper) {
+		s.interval = interval
+	}
+}
+
+// WithTimeout sets the timeout of a single scrape. Defaults to ten seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Scraper) {
+		s.timeout = timeout
+	}
+}
+
+// WithHTTPClient sets the client used to scrape the targets. Defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Scraper) {
+		s.client = client
+	}
+}
+
+// WithPrefix sets a prefix that is prepended to all metric keys, including the scrape health metrics.
+func WithPrefix(prefix string) Option {
+	return func(s *Scraper) {
+		s.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to the metrics of all targets.
+// The job and instance dimensions overwrite default dimensions with the same key.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(s *Scraper) {
+		s.defaultDimensions = dims
+	}
+}
+
+// WithErrorHandler sets a function that is called with errors that occur while scraping in Run.
+// By default, errors are logged.
+func WithErrorHandler(handler func(error)) Option {
+	return func(s *Scraper) {
+		s.errorHandler = handler
+	}
+}
+
+// TargetError is returned when a target could not be scraped or converted.
+type TargetError struct {
+	Target Target
+	Err    error
+}
+
+func (e *TargetError) Error() string {
+	return fmt.Sprintf("scraping %s (job %q): %v", e.Target.URL, e.Target.Job, e.Err)
+}
+
+func (e *TargetError) Unwrap() error {
+	return e.Err
+}
+
+type target struct {
+	Target
+	dims      dimensions.NormalizedDimensionList
+	converter *prometheus.Converter
+	// the Converter's deltas depend on the order of the scrapes, so a target is never scraped concurrently.
+	mu sync.Mutex
+}
+
+// Scraper scrapes a list of Prometheus targets and forwards the converted metrics to an exporter.LineExporter.
+// Every target has its own prometheus.Converter, so cumulative values are turned into deltas per target.
+// In addition to the scraped metrics, the health metrics "up", "scrape_duration_seconds" and
+// "scrape_samples_scraped" are reported for every target.
+type Scraper struct {
+	exporter          exporter.LineExporter
+	interval          time.Duration
+	timeout           time.Duration
+	client            *http.Client
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	errorHandler      func(error)
+
+	targets []*target
+}
+
+// NewScraper creates a Scraper for the given targets that forwards to exporter.
+func NewScraper(targets []Target, exp exporter.LineExporter, opts ...Option) *Scraper {
+	s := &Scraper{
+		exporter:          exp,
+		interval:          defaultInterval,
+		timeout:           defaultTimeout,
+		client:            http.DefaultClient,
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		errorHandler: func(err error) {
+			logging.GetLogger().Errorf("Scrape failed: %v", err)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.interval <= 0 {
+		s.interval = defaultInterval
+	}
+
+	for _, t := range targets {
+		dims := dimensions.MergeLists(
+			s.defaultDimensions,
+			dimensions.NewNormalizedDimensionList(
+				dimensions.NewDimension(JobDimension, t.Job),
+				dimensions.NewDimension(InstanceDimension, instance(t.URL)),
+			),
+		)
+
+		s.targets = append(s.targets, &target{
+			Target:    t,
+			dims:      dims,
+			converter: prometheus.NewConverter(prometheus.WithPrefix(s.prefix), prometheus.WithDefaultDimensions(dims)),
+		})
+	}
+
+	return s
+}
+
+// instance returns the host and port of a target URL, or the URL itself if it cannot be parsed.
+func instance(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
+
+// Run scrapes all targets right away and then once per interval, until ctx is done.
+// Errors are passed to the error handler. Run returns the context error.
+func (s *Scraper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ScrapeOnce(ctx); err != nil && ctx.Err() == nil && s.errorHandler != nil {
+			s.errorHandler(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ScrapeOnce scrapes all targets concurrently and forwards the results to the exporter.
+// Targets that fail are reported in the returned error; the metrics of all other targets are exported.
+// Since counters are converted to deltas, the first scrape of a target only exports gauges.
+func (s *Scraper) ScrapeOnce(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []string
+	)
+
+	for _, t := range s.targets {
+		wg.Add(1)
+		go func(t *target) {
+			defer wg.Done()
+			if err := s.scrapeTarget(ctx, t); err != nil {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d target(s) failed: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *Scraper) scrapeTarget(ctx context.Context, t *target) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	start := time.Now()
+	metrics, samples, scrapeErr := s.fetch(ctx, t)
+	duration := time.Since(start)
+
+	// conversion errors of single samples return the other metrics, so a nil result means the scrape itself failed.
+	up := int64(1)
+	if metrics == nil {
+		up = 0
+	}
+
+	errs := []string{}
+	if scrapeErr != nil {
+		errs = append(errs, scrapeErr.Error())
+	}
+
+	health := []struct {
+		name  string
+		value metric.MetricOption
+	}{
+		{UpMetric, metric.WithIntGaugeValue(up)},
+		{ScrapeDurationMetric, metric.WithFloatGaugeValue(duration.Seconds())},
+		{ScrapeSamplesMetric, metric.WithIntGaugeValue(int64(samples))},
+	}
+	for _, h := range health {
+		m, err := metric.NewMetric(h.name, metric.WithPrefix(s.prefix), metric.WithDimensions(t.dims), h.value)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+
+	if err := exporter.ExportMetrics(ctx, s.exporter, metrics...); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return &TargetError{Target: t.Target, Err: errors.New(strings.Join(errs, "; "))}
+	}
+	return nil
+}
+
+// fetch requests the metrics of a target and converts them. It returns the converted metrics and the number of
+// parsed samples. If some samples cannot be converted, the remaining metrics are returned together with an error.
+func (s *Scraper) fetch(ctx context.Context, t *target) ([]*metric.Metric, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", acceptHeader)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, resp.Body)
+		return nil, 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	families, err := prometheus.Parse(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	samples := 0
+	for _, f := range families {
+		samples += len(f.Samples)
+	}
+
+	metrics, err := t.converter.ConvertFamilies(families)
+	return metrics, samples, err
+}
@@ -0,0 +1,235 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+type fakeExporter struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (e *fakeExporter) Export(ctx context.Context, lines ...string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lines = append(e.lines, lines...)
+	return nil
+}
+
+// take returns the canonical exported lines, without the scrape duration, and resets the exporter.
+func (e *fakeExporter) take() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := []string{}
+	for _, l := range linetest.CanonicalLines(e.lines) {
+		if !strings.Contains(l, ScrapeDurationMetric) {
+			result = append(result, l)
+		}
+	}
+	sort.Strings(result)
+	e.lines = nil
+	return result
+}
+
+// counterTarget serves a counter that increases by 5 with every scrape.
+func counterTarget(t *testing.T) *httptest.Server {
+	var (
+		mu    sync.Mutex
+		count int
+	)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), "text/plain") {
+			t.Errorf("unexpected Accept header %q", r.Header.Get("Accept"))
+		}
+		mu.Lock()
+		count += 5
+		c := count
+		mu.Unlock()
+		fmt.Fprintf(w, "# TYPE requests_total counter\nrequests_total{code=\"200\"} %d\n# TYPE temperature gauge\ntemperature 21.5\n", c)
+	}))
+}
+
+func host(t *testing.T, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
+
+func TestScraper_ScrapeOnce(t *testing.T) {
+	server := counterTarget(t)
+	defer server.Close()
+
+	exp := &fakeExporter{}
+	s := NewScraper(
+		[]Target{{Job: "app", URL: server.URL + "/metrics"}},
+		exp,
+		WithPrefix("prom"),
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("env", "test"))),
+	)
+	inst := host(t, server.URL)
+
+	if err := s.ScrapeOnce(context.Background()); err != nil {
+		t.Fatalf("ScrapeOnce() error = %v", err)
+	}
+	want := linetest.CanonicalLines([]string{
+		// the counter is parsed, but not converted on the first scrape.
+		fmt.Sprintf("prom.scrape_samples_scraped,env=test,instance=%s,job=app gauge,2", inst),
+		fmt.Sprintf("prom.temperature,env=test,instance=%s,job=app gauge,21.5", inst),
+		fmt.Sprintf("prom.up,env=test,instance=%s,job=app gauge,1", inst),
+	})
+	sort.Strings(want)
+	if got := exp.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("first scrape = %v, want %v", got, want)
+	}
+
+	if err := s.ScrapeOnce(context.Background()); err != nil {
+		t.Fatalf("ScrapeOnce() error = %v", err)
+	}
+	want = linetest.CanonicalLines([]string{
+		fmt.Sprintf("prom.requests_total,code=200,env=test,instance=%s,job=app count,delta=5", inst),
+		fmt.Sprintf("prom.scrape_samples_scraped,env=test,instance=%s,job=app gauge,2", inst),
+		fmt.Sprintf("prom.temperature,env=test,instance=%s,job=app gauge,21.5", inst),
+		fmt.Sprintf("prom.up,env=test,instance=%s,job=app gauge,1", inst),
+	})
+	sort.Strings(want)
+	if got := exp.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("second scrape = %v, want %v", got, want)
+	}
+}
+
+func TestScraper_FailingTarget(t *testing.T) {
+	healthy := counterTarget(t)
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	exp := &fakeExporter{}
+	s := NewScraper([]Target{
+		{Job: "healthy", URL: healthy.URL},
+		{Job: "failing", URL: failing.URL},
+	}, exp)
+
+	err := s.ScrapeOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("ScrapeOnce() error = %v, want error for failing target", err)
+	}
+
+	got := exp.take()
+	for _, want := range []string{
+		fmt.Sprintf("up,instance=%s,job=failing gauge,0", host(t, failing.URL)),
+		fmt.Sprintf("up,instance=%s,job=healthy gauge,1", host(t, healthy.URL)),
+		fmt.Sprintf("scrape_samples_scraped,instance=%s,job=failing gauge,0", host(t, failing.URL)),
+	} {
+		if !contains(got, linetest.Canonical(want)) {
+			t.Errorf("exported lines %v do not contain %q", got, want)
+		}
+	}
+}
+
+func TestScraper_InvalidExposition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "not a { valid line\n")
+	}))
+	defer server.Close()
+
+	exp := &fakeExporter{}
+	s := NewScraper([]Target{{Job: "broken", URL: server.URL}}, exp)
+
+	if err := s.ScrapeOnce(context.Background()); err == nil || !strings.Contains(err.Error(), `job "broken"`) {
+		t.Fatalf("ScrapeOnce() error = %v, want error for target", err)
+	}
+
+	want := linetest.Canonical(fmt.Sprintf("up,instance=%s,job=broken gauge,0", host(t, server.URL)))
+	if got := exp.take(); !contains(got, want) {
+		t.Errorf("exported lines %v do not contain %q", got, want)
+	}
+}
+
+func TestScraper_Run(t *testing.T) {
+	server := counterTarget(t)
+	defer server.Close()
+
+	exp := &fakeExporter{}
+	s := NewScraper([]Target{{Job: "app", URL: server.URL}}, exp, WithInterval(5*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	want := linetest.Canonical(fmt.Sprintf("requests_total,code=200,instance=%s,job=app count,delta=5", host(t, server.URL)))
+	deadline := time.Now().Add(5 * time.Second)
+	var got []string
+	for time.Now().Before(deadline) {
+		got = append(got, exp.take()...)
+		if contains(got, want) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	if !contains(got, want) {
+		t.Errorf("exported lines %v do not contain %q", got, want)
+	}
+}
+
+func TestInstance(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://localhost:9100/metrics", "localhost:9100"},
+		{"https://example.com/metrics", "example.com"},
+		{"not a url", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := instance(tt.url); got != tt.want {
+			t.Errorf("instance(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func contains(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
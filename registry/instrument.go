@@ -0,0 +1,104 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+type instrument struct {
+	aggregator *aggregation.Aggregator
+	key        string
+	dims       dimensions.NormalizedDimensionList
+}
+
+// Counter records increments, which are exported as "count,delta=<sum>".
+type Counter struct {
+	instrument
+}
+
+// Add adds delta to the counter.
+func (c *Counter) Add(delta float64) {
+	c.aggregator.AddCount(c.key, c.dims, delta)
+}
+
+// Inc adds 1 to the counter.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Gauge records a value, which is exported as "gauge,<value>" until the gauge is removed.
+type Gauge struct {
+	instrument
+}
+
+// Set sets the value of the gauge.
+func (g *Gauge) Set(value float64) {
+	g.aggregator.SetGauge(g.key, g.dims, value)
+}
+
+// Add adds delta to the value of the gauge.
+func (g *Gauge) Add(delta float64) {
+	g.aggregator.AdjustGauge(g.key, g.dims, delta)
+}
+
+// Remove stops exporting the gauge, until it is set again.
+func (g *Gauge) Remove() {
+	g.aggregator.RemoveGauge(g.key, g.dims)
+}
+
+// Summary records values, which are exported as "gauge,min=<min>,max=<max>,sum=<sum>,count=<count>".
+type Summary struct {
+	instrument
+}
+
+// Record adds a value to the summary.
+func (s *Summary) Record(value float64) {
+	s.aggregator.RecordSummary(s.key, s.dims, value)
+}
+
+// ObservableGauge is a gauge whose value is read from a callback on every export.
+type ObservableGauge struct {
+	instrument
+	registry *Registry
+	callback func() float64
+}
+
+// observe calls the callback and sets the gauge, unless it was unregistered in the meantime.
+func (g *ObservableGauge) observe() {
+	value := g.callback()
+
+	r := g.registry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.observables[aggregation.SeriesKey(g.key, g.dims)] == g {
+		g.aggregator.SetGauge(g.key, g.dims, value)
+	}
+}
+
+// Unregister stops calling the callback and exporting the gauge.
+func (g *ObservableGauge) Unregister() {
+	r := g.registry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := aggregation.SeriesKey(g.key, g.dims)
+	if r.observables[key] == g {
+		delete(r.observables, key)
+		g.aggregator.RemoveGauge(g.key, g.dims)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package registry provides instruments to record metrics in an application and exports them periodically.
+package registry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/enrichment"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/exporter"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/oneagentenrichment"
+)
+
+const defaultInterval = time.Minute
+
+// ErrShutdown is returned by ForceFlush and Shutdown after the Registry was shut down.
+var ErrShutdown = errors.New("registry is shut down")
+
+// Collector provides metrics that are exported together with the instruments of the Registry,
+// like the collectors of the runtimemetrics, procmetrics and sqlstats packages.
+type Collector interface {
+	Collect() ([]*metric.Metric, error)
+}
+
+// Option represents the function interface used to configure the Registry.
+type Option func(r *Registry)
+
+// WithPrefix sets a prefix that is prepended to the keys of all instruments.
+func WithPrefix(prefix string) Option {
+	return func(r *Registry) {
+		r.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all instruments. Dimensions of an instrument overwrite
+// default dimensions with the same key.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(r *Registry) {
+		r.defaultDimensions = dims
+	}
+}
+
+// WithEnrichmentProvider sets the provider of the enrichment dimensions, which are read on every flush.
+// By default, the OneAgent metadata is read once when the Registry is created.
+func WithEnrichmentProvider(provider *enrichment.EnrichmentProvider) Option {
+	return func(r *Registry) {
+		r.enrichment = provider.Get
+	}
+}
+
+// WithInterval sets the interval in which the metrics are collected and exported. Defaults to one minute.
+// An interval of 0 disables the periodic export, so that metrics are only exported by ForceFlush and Shutdown.
+func WithInterval(interval time.Duration) Option {
+	return func(r *Registry) {
+		r.interval = interval
+	}
+}
+
+// WithErrorHandler sets a function that is called with errors of the periodic export. By default, errors are logged.
+func WithErrorHandler(handler func(error)) Option {
+	return func(r *Registry) {
+		r.errorHandler = handler
+	}
+}
+
+// Registry hands out instruments and exports their values, together with the metrics of registered collectors,
+// once per interval. The dimensions of every metric are the default dimensions, the dimensions of the instrument and
+// the enrichment dimensions, merged with dimensions.MergeLists in that order.
+//
+// Instruments are identified by their key and dimensions, independent of the order of the dimensions: instruments
+// that are created with the same key and dimensions record into the same series. Using the same key and dimensions
+// for instruments of different kinds is reported as error by the next flush. It is safe for concurrent use.
+type Registry struct {
+	exporter          exporter.LineExporter
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	enrichment        func() dimensions.NormalizedDimensionList
+	interval          time.Duration
+	errorHandler      func(error)
+
+	aggregator *aggregation.Aggregator
+
+	mu          sync.Mutex
+	observables map[string]*ObservableGauge
+	collectors  []Collector
+	shutdown    bool
+
+	// flushMu serializes flushes, so that the exporter receives the lines of one flush at a time.
+	flushMu sync.Mutex
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRegistry creates a Registry that exports to exporter and starts the periodic export.
+func NewRegistry(exp exporter.LineExporter, opts ...Option) *Registry {
+	r := &Registry{
+		exporter:          exp,
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		interval:          defaultInterval,
+		errorHandler: func(err error) {
+			logging.GetLogger().Errorf("Could not export metrics: %v", err)
+		},
+		observables: map[string]*ObservableGauge{},
+		done:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.enrichment == nil {
+		oneAgentDimensions := oneagentenrichment.GetOneAgentMetadata()
+		r.enrichment = func() dimensions.NormalizedDimensionList { return oneAgentDimensions }
+	}
+
+	r.aggregator = aggregation.NewAggregator(
+		aggregation.WithAggregatorPrefix(r.prefix),
+		aggregation.WithAggregatorDefaultDimensions(r.defaultDimensions),
+		aggregation.WithAggregatorDimensionsFunc(r.enrichment),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.run(ctx)
+
+	return r
+}
+
+func (r *Registry) run(ctx context.Context) {
+	defer close(r.done)
+	if r.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.flush(ctx); err != nil && ctx.Err() == nil && r.errorHandler != nil {
+				r.errorHandler(err)
+			}
+		}
+	}
+}
+
+// Counter returns a counter that is exported as the sum of its increments since the previous export.
+func (r *Registry) Counter(key string, dims dimensions.NormalizedDimensionList) *Counter {
+	return &Counter{instrument{aggregator: r.aggregator, key: key, dims: dims}}
+}
+
+// Gauge returns a gauge that is exported with its last value on every export.
+func (r *Registry) Gauge(key string, dims dimensions.NormalizedDimensionList) *Gauge {
+	return &Gauge{instrument{aggregator: r.aggregator, key: key, dims: dims}}
+}
+
+// Summary returns a summary that is exported as minimum, maximum, sum and count of the values recorded since the
+// previous export.
+func (r *Registry) Summary(key string, dims dimensions.NormalizedDimensionList) *Summary {
+	return &Summary{instrument{aggregator: r.aggregator, key: key, dims: dims}}
+}
+
+// ObservableGauge registers a gauge whose value is read from callback on every export. Registering another
+// observable gauge with the same key and dimensions replaces the previous one.
+func (r *Registry) ObservableGauge(key string, dims dimensions.NormalizedDimensionList, callback func() float64) *ObservableGauge {
+	g := &ObservableGauge{
+		instrument: instrument{aggregator: r.aggregator, key: key, dims: dims},
+		registry:   r,
+		callback:   callback,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observables[aggregation.SeriesKey(key, dims)] = g
+
+	return g
+}
+
+// Register adds a collector, whose metrics are exported with every export. The metrics of collectors do not get the
+// prefix, default and enrichment dimensions of the Registry; configure them on the collector instead.
+func (r *Registry) Register(collector Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, collector)
+}
+
+// ForceFlush collects and exports all metrics right away.
+func (r *Registry) ForceFlush(ctx context.Context) error {
+	r.mu.Lock()
+	shutdown := r.shutdown
+	r.mu.Unlock()
+	if shutdown {
+		return ErrShutdown
+	}
+
+	return r.flush(ctx)
+}
+
+// Shutdown stops the periodic export and exports the remaining metrics. Values recorded afterwards are not exported.
+// If ctx is done before a running export finished, ctx.Err() is returned.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if r.shutdown {
+		r.mu.Unlock()
+		return ErrShutdown
+	}
+	r.shutdown = true
+	r.mu.Unlock()
+
+	r.cancel()
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return r.flush(ctx)
+}
+
+// flush collects all metrics, serializes them and passes the lines to the exporter.
+func (r *Registry) flush(ctx context.Context) error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	observables := make([]*ObservableGauge, 0, len(r.observables))
+	for _, g := range r.observables {
+		observables = append(observables, g)
+	}
+	collectors := append([]Collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, g := range observables {
+		g.observe()
+	}
+
+	errs := []string{}
+	collected, err := r.aggregator.Collect()
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, c := range collectors {
+		metrics, err := c.Collect()
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		collected = append(collected, metrics...)
+	}
+
+	if err := exporter.ExportMetrics(ctx, r.exporter, collected...); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
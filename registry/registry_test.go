@@ -0,0 +1,219 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/enrichment"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+type fakeExporter struct {
+	mu      sync.Mutex
+	exports [][]string
+}
+
+func (e *fakeExporter) Export(ctx context.Context, lines ...string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.exports = append(e.exports, lines)
+	return nil
+}
+
+// last returns the lines of the last export in canonical form.
+func (e *fakeExporter) last() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.exports) == 0 {
+		return nil
+	}
+	return linetest.CanonicalLines(e.exports[len(e.exports)-1])
+}
+
+func (e *fakeExporter) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.exports)
+}
+
+type collectorFunc func() ([]*metric.Metric, error)
+
+func (f collectorFunc) Collect() ([]*metric.Metric, error) { return f() }
+
+func noEnrichment() Option {
+	return WithEnrichmentProvider(enrichment.NewEnrichmentProvider(nil, enrichment.WithRefreshInterval(0)))
+}
+
+func dims(kv ...string) dimensions.NormalizedDimensionList {
+	ds := []dimensions.Dimension{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		ds = append(ds, dimensions.NewDimension(kv[i], kv[i+1]))
+	}
+	return dimensions.NewNormalizedDimensionList(ds...)
+}
+
+func TestRegistry_ForceFlush(t *testing.T) {
+	provider := enrichment.NewEnrichmentProvider([]enrichment.Source{
+		enrichment.SourceFunc(func() (dimensions.NormalizedDimensionList, error) {
+			return dims("dt.entity.host", "HOST-1", "env", "enriched"), nil
+		}),
+	}, enrichment.WithRefreshInterval(0))
+
+	exp := &fakeExporter{}
+	r := NewRegistry(exp,
+		WithInterval(0),
+		WithPrefix("app"),
+		WithDefaultDimensions(dims("env", "default", "service", "users")),
+		WithEnrichmentProvider(provider),
+	)
+	ctx := context.Background()
+
+	r.Counter("requests", dims("method", "GET", "status", "2xx")).Inc()
+	// the same key and dimensions in a different order record into the same series
+	r.Counter("requests", dims("status", "2xx", "method", "GET")).Add(2)
+	r.Gauge("queue", dims("service", "queue")).Set(5)
+	r.Gauge("queue", dims("service", "queue")).Add(-1)
+	latency := r.Summary("latency", dims())
+	latency.Record(1)
+	latency.Record(3)
+	connections := 7.0
+	r.ObservableGauge("connections", dims(), func() float64 { return connections })
+	r.Register(collectorFunc(func() ([]*metric.Metric, error) {
+		m, err := metric.NewMetric("external", metric.WithIntGaugeValue(1))
+		return []*metric.Metric{m}, err
+	}))
+
+	if err := r.ForceFlush(ctx); err != nil {
+		t.Fatalf("ForceFlush() error = %v", err)
+	}
+	want := linetest.CanonicalLines([]string{
+		"app.requests,env=enriched,service=users,method=GET,status=2xx,dt.entity.host=HOST-1 count,delta=3",
+		"app.queue,env=enriched,service=queue,dt.entity.host=HOST-1 gauge,4",
+		"app.latency,env=enriched,service=users,dt.entity.host=HOST-1 gauge,min=1,max=3,sum=4,count=2",
+		"app.connections,env=enriched,service=users,dt.entity.host=HOST-1 gauge,7",
+		"external gauge,1",
+	})
+	if got := exp.last(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ForceFlush() exported %v, want %v", got, want)
+	}
+
+	// counters and summaries are reset, gauges are retained and observed again
+	connections = 8
+	if err := r.ForceFlush(ctx); err != nil {
+		t.Fatalf("ForceFlush() error = %v", err)
+	}
+	want = linetest.CanonicalLines([]string{
+		"app.queue,env=enriched,service=queue,dt.entity.host=HOST-1 gauge,4",
+		"app.connections,env=enriched,service=users,dt.entity.host=HOST-1 gauge,8",
+		"external gauge,1",
+	})
+	if got := exp.last(); !reflect.DeepEqual(got, want) {
+		t.Errorf("second ForceFlush() exported %v, want %v", got, want)
+	}
+}
+
+func TestRegistry_RemoveAndUnregister(t *testing.T) {
+	exp := &fakeExporter{}
+	r := NewRegistry(exp, WithInterval(0), noEnrichment())
+
+	gauge := r.Gauge("g", dims())
+	gauge.Set(1)
+	observed := r.ObservableGauge("o", dims(), func() float64 { return 2 })
+	// replaces the first observable gauge
+	current := r.ObservableGauge("o", dims(), func() float64 { return 3 })
+	// unregistering the replaced gauge has no effect
+	observed.Unregister()
+
+	if err := r.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush() error = %v", err)
+	}
+	if got, want := exp.last(), []string{"g gauge,1", "o gauge,3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ForceFlush() exported %v, want %v", got, want)
+	}
+
+	gauge.Remove()
+	current.Unregister()
+	if err := r.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush() error = %v", err)
+	}
+	// nothing is left to export
+	if n := exp.count(); n != 1 {
+		t.Errorf("exports = %d, want 1", n)
+	}
+}
+
+func TestRegistry_KindMismatch(t *testing.T) {
+	exp := &fakeExporter{}
+	r := NewRegistry(exp, WithInterval(0), noEnrichment())
+
+	r.Counter("m", dims()).Inc()
+	r.Gauge("m", dims()).Set(1)
+
+	err := r.ForceFlush(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "recorded as gauge, but is a counter") {
+		t.Errorf("ForceFlush() error = %v, want kind mismatch", err)
+	}
+	if got, want := exp.last(), []string{"m count,delta=1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ForceFlush() exported %v, want %v", got, want)
+	}
+}
+
+func TestRegistry_Periodic(t *testing.T) {
+	exp := &fakeExporter{}
+	r := NewRegistry(exp, WithInterval(5*time.Millisecond), noEnrichment())
+	defer r.Shutdown(context.Background())
+
+	r.Gauge("g", dims()).Set(1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for exp.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := exp.count(); n < 2 {
+		t.Errorf("exports = %d, want periodic exports", n)
+	}
+}
+
+func TestRegistry_Shutdown(t *testing.T) {
+	exp := &fakeExporter{}
+	r := NewRegistry(exp, WithInterval(time.Hour), noEnrichment())
+
+	r.Counter("c", dims()).Inc()
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if got, want := exp.last(), []string{"c count,delta=1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Shutdown() exported %v, want %v", got, want)
+	}
+
+	if err := r.Shutdown(context.Background()); !errors.Is(err, ErrShutdown) {
+		t.Errorf("second Shutdown() error = %v, want %v", err, ErrShutdown)
+	}
+	if err := r.ForceFlush(context.Background()); !errors.Is(err, ErrShutdown) {
+		t.Errorf("ForceFlush() after Shutdown error = %v, want %v", err, ErrShutdown)
+	}
+}
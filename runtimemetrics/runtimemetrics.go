@@ -0,0 +1,305 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runtimemetrics collects Go runtime metrics, like goroutines, heap sizes and GC pauses, from runtime/metrics.
+package runtimemetrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/enrichment"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/exporter"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/estimate"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/oneagentenrichment"
+)
+
+const (
+	defaultPrefix   = "go.runtime"
+	defaultInterval = time.Minute
+)
+
+type kind int
+
+const (
+	kindGauge kind = iota
+	kindCounter
+	kindSummary
+)
+
+type descriptor struct {
+	// names are the runtime/metrics names, in order of preference. The first one supported by the runtime is used.
+	names []string
+	key   string
+	kind  kind
+}
+
+// descriptors lists the collected metrics. Names that were renamed in later Go versions list the new name first.
+var descriptors = []descriptor{
+	{names: []string{"/sched/goroutines:goroutines"}, key: "goroutines", kind: kindGauge},
+	{names: []string{"/memory/classes/heap/objects:bytes"}, key: "heap.objects.bytes", kind: kindGauge},
+	{names: []string{"/memory/classes/heap/free:bytes"}, key: "heap.free.bytes", kind: kindGauge},
+	{names: []string{"/memory/classes/heap/released:bytes"}, key: "heap.released.bytes", kind: kindGauge},
+	{names: []string{"/memory/classes/heap/unused:bytes"}, key: "heap.unused.bytes", kind: kindGauge},
+	{names: []string{"/memory/classes/total:bytes"}, key: "memory.total.bytes", kind: kindGauge},
+	{names: []string{"/gc/heap/objects:objects"}, key: "heap.objects", kind: kindGauge},
+	{names: []string{"/gc/heap/goal:bytes"}, key: "gc.heap.goal.bytes", kind: kindGauge},
+	{names: []string{"/gc/heap/allocs:bytes"}, key: "heap.allocs.bytes", kind: kindCounter},
+	{names: []string{"/gc/heap/allocs:objects"}, key: "heap.allocs.objects", kind: kindCounter},
+	{names: []string{"/gc/heap/frees:bytes"}, key: "heap.frees.bytes", kind: kindCounter},
+	{names: []string{"/gc/cycles/total:gc-cycles"}, key: "gc.cycles", kind: kindCounter},
+	{names: []string{"/sched/pauses/total/gc:seconds", "/gc/pauses:seconds"}, key: "gc.pause.seconds", kind: kindSummary},
+}
+
+// Option represents the function interface used to configure the Collector.
+type Option func(c *Collector)
+
+// WithPrefix sets the prefix of all metric keys. Defaults to "go.runtime".
+func WithPrefix(prefix string) Option {
+	return func(c *Collector) {
+		c.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(c *Collector) {
+		c.defaultDimensions = dims
+	}
+}
+
+// WithEnrichmentProvider sets the provider of the enrichment dimensions, which are read on every collection.
+// By default, the OneAgent metadata is read once when the Collector is created.
+func WithEnrichmentProvider(provider *enrichment.EnrichmentProvider) Option {
+	return func(c *Collector) {
+		c.enrichment = provider.Get
+	}
+}
+
+// WithInterval sets the interval in which Run collects and exports the metrics. Defaults to one minute.
+func WithInterval(interval time.Duration) Option {
+	return func(c *Collector) {
+		c.interval = interval
+	}
+}
+
+// WithErrorHandler sets a function that is called with errors that occur in Run. By default, errors are logged.
+func WithErrorHandler(handler func(error)) Option {
+	return func(c *Collector) {
+		c.errorHandler = handler
+	}
+}
+
+// Collector reads the Go runtime metrics. Gauges, like the number of goroutines and the heap sizes, are reported as
+// they are. Cumulative counters, like the allocated bytes and the GC cycles, are reported as deltas, and the GC pause
+// histogram is reported as summary of the pauses since the previous collection. Counters and pauses are therefore
+// only reported from the second collection on. It is safe for concurrent use.
+type Collector struct {
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	enrichment        func() dimensions.NormalizedDimensionList
+	interval          time.Duration
+	errorHandler      func(error)
+
+	descriptors []descriptor
+	samples     []metrics.Sample
+
+	mu             sync.Mutex
+	tracker        *aggregation.CumulativeTracker
+	previousPauses []uint64
+}
+
+// NewCollector creates a Collector for the metrics supported by the running Go version.
+func NewCollector(opts ...Option) *Collector {
+	c := &Collector{
+		prefix:            defaultPrefix,
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		interval:          defaultInterval,
+		errorHandler: func(err error) {
+			logging.GetLogger().Errorf("Could not export runtime metrics: %v", err)
+		},
+		tracker: aggregation.NewCumulativeTracker(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.enrichment == nil {
+		oneAgentDimensions := oneagentenrichment.GetOneAgentMetadata()
+		c.enrichment = func() dimensions.NormalizedDimensionList { return oneAgentDimensions }
+	}
+	if c.interval <= 0 {
+		c.interval = defaultInterval
+	}
+
+	supported := map[string]bool{}
+	for _, d := range metrics.All() {
+		supported[d.Name] = true
+	}
+	for _, d := range descriptors {
+		for _, name := range d.names {
+			if supported[name] {
+				c.descriptors = append(c.descriptors, d)
+				c.samples = append(c.samples, metrics.Sample{Name: name})
+				break
+			}
+		}
+	}
+
+	return c
+}
+
+func sampleValue(v metrics.Value) (float64, bool) {
+	switch v.Kind() {
+	case metrics.KindUint64:
+		return float64(v.Uint64()), true
+	case metrics.KindFloat64:
+		return v.Float64(), true
+	}
+	return 0, false
+}
+
+// Collect reads the runtime metrics and returns them.
+func (c *Collector) Collect() ([]*metric.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics.Read(c.samples)
+
+	dims := dimensions.MergeLists(c.defaultDimensions, c.enrichment())
+	result := make([]*metric.Metric, 0, len(c.samples))
+	errs := []string{}
+
+	for i, s := range c.samples {
+		d := c.descriptors[i]
+
+		var value metric.MetricOption
+		switch d.kind {
+		case kindGauge:
+			v, ok := sampleValue(s.Value)
+			if !ok {
+				continue
+			}
+			value = metric.WithFloatGaugeValue(v)
+		case kindCounter:
+			if s.Value.Kind() != metrics.KindUint64 {
+				continue
+			}
+			delta, ok := c.tracker.IntDelta(d.key, int64(s.Value.Uint64()))
+			if !ok {
+				continue
+			}
+			value = metric.WithIntCounterValueDelta(delta)
+		case kindSummary:
+			if s.Value.Kind() != metrics.KindFloat64Histogram {
+				continue
+			}
+			var ok bool
+			if value, ok = c.pauseSummary(s.Value.Float64Histogram()); !ok {
+				continue
+			}
+		}
+
+		m, err := metric.NewMetric(d.key, metric.WithPrefix(c.prefix), metric.WithDimensions(dims), value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("'%s': %v", d.key, err))
+			continue
+		}
+		result = append(result, m)
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("could not collect %d runtime metric(s): %s", len(errs), strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// pauseSummary derives a summary of the pauses since the previous collection from the cumulative histogram.
+// The exact pause durations are not known, so the sum uses the bucket midpoints, and min and max are estimated from
+// the bucket boundaries.
+func (c *Collector) pauseSummary(h *metrics.Float64Histogram) (metric.MetricOption, bool) {
+	previous := c.previousPauses
+	c.previousPauses = append(c.previousPauses[:0:0], h.Counts...)
+	if len(previous) != len(h.Counts) {
+		return nil, false
+	}
+
+	var (
+		count int64
+		sum   float64
+	)
+	buckets := make([]estimate.Bucket, 0, len(h.Counts))
+	for i, cumulative := range h.Counts {
+		if cumulative <= previous[i] {
+			continue
+		}
+		b := estimate.Bucket{Lower: h.Buckets[i], Upper: h.Buckets[i+1], Count: float64(cumulative - previous[i])}
+		buckets = append(buckets, b)
+
+		lower, upper := b.Bounds()
+		count += int64(cumulative - previous[i])
+		sum += b.Count * (lower + upper) / 2
+	}
+
+	if count == 0 {
+		return nil, false
+	}
+	min, max := estimate.MinMax(buckets, sum/float64(count))
+	return metric.WithFloatSummaryValue(min, max, sum, count), true
+}
+
+// Run collects and exports the runtime metrics right away and then once per interval, until ctx is done.
+// Errors are passed to the error handler. Run returns the context error.
+func (c *Collector) Run(ctx context.Context, exp exporter.LineExporter) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.export(ctx, exp); err != nil && ctx.Err() == nil && c.errorHandler != nil {
+			c.errorHandler(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Collector) export(ctx context.Context, exp exporter.LineExporter) error {
+	collected, err := c.Collect()
+	errs := []string{}
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if err := exporter.ExportMetrics(ctx, exp, collected...); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtimemetrics
+
+import (
+	"context"
+	"errors"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/enrichment"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// byKey returns the serialized lines by metric key and dimensions.
+func byKey(t *testing.T, metrics []*metric.Metric) map[string]string {
+	t.Helper()
+
+	result := map[string]string{}
+	for _, line := range linetest.Serialize(t, metrics) {
+		parts := strings.SplitN(line, " ", 2)
+		result[parts[0]] = parts[1]
+	}
+	return result
+}
+
+func TestCollector_Collect(t *testing.T) {
+	provider := enrichment.NewEnrichmentProvider([]enrichment.Source{
+		enrichment.SourceFunc(func() (dimensions.NormalizedDimensionList, error) {
+			return dimensions.NewNormalizedDimensionList(dimensions.NewDimension("dt.entity.process_group_instance", "PGI-1")), nil
+		}),
+	}, enrichment.WithRefreshInterval(0))
+
+	c := NewCollector(
+		WithPrefix("custom"),
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("service", "test"))),
+		WithEnrichmentProvider(provider),
+	)
+	const dims = ",dt.entity.process_group_instance=PGI-1,service=test"
+
+	first, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	lines := byKey(t, first)
+	if v, ok := lines["custom.goroutines"+dims]; !ok || !strings.HasPrefix(v, "gauge,") {
+		t.Errorf("goroutines missing in first collection: %v", lines)
+	}
+	if _, ok := lines["custom.heap.objects.bytes"+dims]; !ok {
+		t.Errorf("heap size missing in first collection: %v", lines)
+	}
+	// cumulative values only produce deltas from the second collection on
+	if _, ok := lines["custom.gc.cycles"+dims]; ok {
+		t.Errorf("gc cycles reported in first collection: %v", lines)
+	}
+
+	runtime.GC()
+	runtime.GC()
+
+	second, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	lines = byKey(t, second)
+	if v := lines["custom.gc.cycles"+dims]; !strings.HasPrefix(v, "count,delta=") || v == "count,delta=0" {
+		t.Errorf("gc cycles = %q, want positive delta", v)
+	}
+	if v := lines["custom.gc.pause.seconds"+dims]; !strings.HasPrefix(v, "gauge,min=") {
+		t.Errorf("gc pauses = %q, want summary", v)
+	}
+	if v := lines["custom.heap.allocs.bytes"+dims]; !strings.HasPrefix(v, "count,delta=") {
+		t.Errorf("allocated bytes = %q, want delta", v)
+	}
+}
+
+func TestCollector_DefaultPrefix(t *testing.T) {
+	c := NewCollector(WithEnrichmentProvider(enrichment.NewEnrichmentProvider(nil, enrichment.WithRefreshInterval(0))))
+	collected, err := c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := byKey(t, collected)["go.runtime.goroutines"]; !ok {
+		t.Errorf("go.runtime.goroutines missing: %v", byKey(t, collected))
+	}
+}
+
+func TestPauseSummary(t *testing.T) {
+	c := &Collector{}
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{0, 0, 0, 0},
+		Buckets: []float64{math.Inf(-1), 0.001, 0.01, 0.1, math.Inf(1)},
+	}
+
+	if _, ok := c.pauseSummary(h); ok {
+		t.Error("pauseSummary() reported a summary without previous histogram")
+	}
+
+	h.Counts = []uint64{0, 2, 1, 0}
+	value, ok := c.pauseSummary(h)
+	if !ok {
+		t.Fatal("pauseSummary() reported no summary")
+	}
+	m, err := metric.NewMetric("p", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _ := m.Serialize()
+	// two pauses in (0.001, 0.01], one in (0.01, 0.1]
+	if want := "p gauge,min=0.001,max=0.1,sum=0.066,count=3"; line != want {
+		t.Errorf("pauseSummary() = %q, want %q", line, want)
+	}
+
+	// no new pauses
+	if _, ok := c.pauseSummary(h); ok {
+		t.Error("pauseSummary() reported a summary without new pauses")
+	}
+
+	// pauses in the open-ended buckets use the finite boundary
+	h.Counts = []uint64{1, 2, 1, 1}
+	value, _ = c.pauseSummary(h)
+	m, _ = metric.NewMetric("p", value)
+	line, _ = m.Serialize()
+	if want := "p gauge,min=0.001,max=0.1,sum=0.101,count=2"; line != want {
+		t.Errorf("pauseSummary() = %q, want %q", line, want)
+	}
+}
+
+type fakeExporter struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (e *fakeExporter) Export(ctx context.Context, lines ...string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lines = append(e.lines, lines...)
+	return nil
+}
+
+func (e *fakeExporter) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.lines)
+}
+
+func TestCollector_Run(t *testing.T) {
+	c := NewCollector(
+		WithInterval(5*time.Millisecond),
+		WithEnrichmentProvider(enrichment.NewEnrichmentProvider(nil, enrichment.WithRefreshInterval(0))),
+	)
+	exp := &fakeExporter{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx, exp) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for exp.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	if exp.count() == 0 {
+		t.Error("Run() exported nothing")
+	}
+}
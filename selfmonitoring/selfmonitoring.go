@@ -0,0 +1,218 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package selfmonitoring reports metrics about the library itself, like the number of serialized and rejected lines,
+// sent payloads and queued lines.
+package selfmonitoring
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/exporter"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// Prefix is the reserved prefix of all self-monitoring metrics.
+const Prefix = "metric_utils.sfm"
+
+// Dimension keys.
+const (
+	ReasonDimension     = "reason"
+	StatusCodeDimension = "status_code"
+	AggregatorDimension = "aggregator"
+)
+
+// Option represents the function interface used to configure the Collector.
+type Option func(c *Collector)
+
+// WithDefaultDimensions sets dimensions that are added to all metrics.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(c *Collector) {
+		c.defaultDimensions = dims
+	}
+}
+
+// WithBatchExporter reports the lines and payloads handled by the exporter, and its queue depth.
+func WithBatchExporter(e *exporter.BatchExporter) Option {
+	return func(c *Collector) {
+		c.batchExporter = e
+	}
+}
+
+// WithClient reports the requests sent by the client, by HTTP status code.
+func WithClient(client *exporter.Client) Option {
+	return func(c *Collector) {
+		c.client = client
+	}
+}
+
+// WithDiskQueue reports the payloads handled by the disk queue, its retries and its size.
+func WithDiskQueue(q *exporter.DiskQueue) Option {
+	return func(c *Collector) {
+		c.diskQueue = q
+	}
+}
+
+// WithAggregator reports the series held by the aggregator, with name in the AggregatorDimension.
+// It can be passed multiple times with different names.
+func WithAggregator(name string, a *aggregation.Aggregator) Option {
+	return func(c *Collector) {
+		c.aggregators[name] = a
+	}
+}
+
+// Collector reports the statistics of the metric and dimensions packages, which are always included, and of the
+// components it was configured with. All metric keys start with Prefix. Counters are reported as the delta since
+// the previous Collect; the first Collect reports everything since the component was created.
+// It is safe for concurrent use.
+type Collector struct {
+	defaultDimensions dimensions.NormalizedDimensionList
+	batchExporter     *exporter.BatchExporter
+	client            *exporter.Client
+	diskQueue         *exporter.DiskQueue
+	aggregators       map[string]*aggregation.Aggregator
+
+	mu       sync.Mutex
+	previous map[string]uint64
+}
+
+// NewCollector creates a Collector.
+func NewCollector(opts ...Option) *Collector {
+	c := &Collector{
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		aggregators:       map[string]*aggregation.Aggregator{},
+		previous:          map[string]uint64{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// collection accumulates the metrics of one Collect.
+type collection struct {
+	c       *Collector
+	metrics []*metric.Metric
+	errs    []string
+}
+
+func (col *collection) add(key string, value metric.MetricOption, dims ...dimensions.Dimension) {
+	m, err := metric.NewMetric(
+		key,
+		metric.WithPrefix(Prefix),
+		metric.WithDimensions(dimensions.MergeLists(col.c.defaultDimensions, dimensions.NewNormalizedDimensionList(dims...))),
+		value,
+		// the self-monitoring lines would otherwise be counted by the next Collect.
+		metric.WithoutStats(),
+	)
+	if err != nil {
+		col.errs = append(col.errs, fmt.Sprintf("'%s': %v", key, err))
+		return
+	}
+	col.metrics = append(col.metrics, m)
+}
+
+// counter adds the difference of the cumulative value to the previous Collect.
+func (col *collection) counter(key string, value uint64, dims ...dimensions.Dimension) {
+	seriesKey := aggregation.SeriesKey(key, dimensions.NewNormalizedDimensionList(dims...))
+	delta := value - col.c.previous[seriesKey]
+	if value < col.c.previous[seriesKey] {
+		// the component was replaced
+		delta = value
+	}
+	col.c.previous[seriesKey] = value
+
+	col.add(key, metric.WithIntCounterValueDelta(int64(delta)), dims...)
+}
+
+func (col *collection) gauge(key string, value int64, dims ...dimensions.Dimension) {
+	col.add(key, metric.WithIntGaugeValue(value), dims...)
+}
+
+// Collect returns the self-monitoring metrics.
+func (c *Collector) Collect() ([]*metric.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	col := &collection{c: c}
+
+	metricStats := metric.GetStats()
+	col.counter("lines.serialized", metricStats.LinesSerialized)
+	for _, reason := range []metric.RejectReason{metric.RejectInvalidKey, metric.RejectMissingValue, metric.RejectLineTooLong, metric.RejectSerializationFailed} {
+		col.counter("lines.rejected", metricStats.LinesRejected[reason], dimensions.NewDimension(ReasonDimension, string(reason)))
+	}
+	col.counter("dimensions.dropped", dimensions.GetStats().DimensionsDropped)
+
+	if c.batchExporter != nil {
+		stats := c.batchExporter.Stats()
+		col.counter("exporter.lines.exported", stats.LinesExported)
+		col.counter("exporter.lines.dropped", stats.LinesDropped)
+		col.counter("exporter.lines.sent", stats.LinesSent)
+		col.counter("exporter.lines.failed", stats.LinesFailed)
+		col.counter("exporter.payloads.sent", stats.PayloadsSent)
+		col.counter("exporter.payloads.failed", stats.PayloadsFailed)
+		col.gauge("exporter.queue.lines", int64(stats.QueuedLines))
+		col.gauge("exporter.queue.bytes", int64(stats.QueuedBytes))
+	}
+
+	if c.client != nil {
+		stats := c.client.Stats()
+		codes := make([]int, 0, len(stats.StatusCodes))
+		for code := range stats.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			col.counter("client.requests", stats.StatusCodes[code], dimensions.NewDimension(StatusCodeDimension, strconv.Itoa(code)))
+		}
+		col.counter("client.transport_errors", stats.TransportErrors)
+	}
+
+	if c.diskQueue != nil {
+		stats := c.diskQueue.Stats()
+		col.counter("diskqueue.payloads.queued", stats.Queued)
+		col.counter("diskqueue.payloads.sent", stats.Sent)
+		col.counter("diskqueue.payloads.dropped", stats.Dropped)
+		col.counter("diskqueue.retries", stats.Retries)
+		col.counter("diskqueue.segments.dropped", stats.SegmentsDropped)
+		col.gauge("diskqueue.bytes", stats.Bytes)
+	}
+
+	names := make([]string, 0, len(c.aggregators))
+	for name := range c.aggregators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stats := c.aggregators[name].Stats()
+		dim := dimensions.NewDimension(AggregatorDimension, name)
+		col.gauge("aggregator.series", int64(stats.Series), dim)
+		col.counter("aggregator.recorded", stats.Recorded, dim)
+		col.counter("aggregator.kind_mismatches", stats.KindMismatches, dim)
+		col.counter("aggregator.series.dropped", stats.SeriesDropped, dim)
+	}
+
+	if len(col.errs) > 0 {
+		return col.metrics, fmt.Errorf("could not collect %d self-monitoring metric(s): %s", len(col.errs), strings.Join(col.errs, "; "))
+	}
+	return col.metrics, nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selfmonitoring
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/exporter"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+type nopSender struct{}
+
+func (nopSender) Send(ctx context.Context, lines []string) error { return nil }
+
+// byKey returns the values of the canonical lines by metric key and sorted dimensions.
+func byKey(lines []string) map[string]string {
+	result := map[string]string{}
+	for _, line := range linetest.CanonicalLines(lines) {
+		parts := strings.SplitN(line, " ", 2)
+		result[parts[0]] = parts[1]
+	}
+	return result
+}
+
+func collect(t *testing.T, c *Collector) map[string]string {
+	t.Helper()
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	return byKey(linetest.Serialize(t, metrics))
+}
+
+func expect(t *testing.T, got map[string]string, want map[string]string) {
+	t.Helper()
+
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/invalid" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := exporter.NewClient(exporter.WithEndpoint(server.URL))
+	_ = client.Send(ctx, []string{"a gauge,1"})
+	_ = exporter.NewClient(exporter.WithEndpoint(server.URL+"/invalid")).Send(ctx, []string{"a gauge,1"})
+	_ = client.Send(ctx, []string{"a gauge,1"})
+
+	exp := exporter.NewBatchExporter(nopSender{}, exporter.WithFlushInterval(time.Hour))
+	defer exp.Close()
+	if err := exp.Export(ctx, "a gauge,1", "b gauge,1", "c gauge,1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	agg := aggregation.NewAggregator()
+	agg.AddCount("requests", dimensions.NewNormalizedDimensionList(), 1)
+	agg.SetGauge("requests", dimensions.NewNormalizedDimensionList(), 1)
+
+	c := NewCollector(
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("service", "test"))),
+		WithBatchExporter(exp),
+		WithClient(client),
+		WithAggregator("http", agg),
+	)
+
+	expect(t, collect(t, c), map[string]string{
+		"metric_utils.sfm.client.requests,service=test,status_code=202":            "count,delta=2",
+		"metric_utils.sfm.client.transport_errors,service=test":                    "count,delta=0",
+		"metric_utils.sfm.exporter.lines.exported,service=test":                    "count,delta=3",
+		"metric_utils.sfm.exporter.lines.sent,service=test":                        "count,delta=3",
+		"metric_utils.sfm.exporter.payloads.sent,service=test":                     "count,delta=1",
+		"metric_utils.sfm.exporter.queue.lines,service=test":                       "gauge,0",
+		"metric_utils.sfm.aggregator.series,aggregator=http,service=test":          "gauge,1",
+		"metric_utils.sfm.aggregator.recorded,aggregator=http,service=test":        "count,delta=1",
+		"metric_utils.sfm.aggregator.kind_mismatches,aggregator=http,service=test": "count,delta=1",
+	})
+
+	// counters report the difference to the previous Collect
+	if err := exp.Export(ctx, "d gauge,1"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, collect(t, c), map[string]string{
+		"metric_utils.sfm.client.requests,service=test,status_code=202": "count,delta=0",
+		"metric_utils.sfm.exporter.lines.exported,service=test":         "count,delta=1",
+		"metric_utils.sfm.exporter.queue.lines,service=test":            "gauge,1",
+		"metric_utils.sfm.exporter.queue.bytes,service=test":            "gauge,9",
+	})
+}
+
+func TestCollector_PackageStats(t *testing.T) {
+	c := NewCollector()
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	// serializing the self-monitoring lines is not counted, but serializing other metrics and creating a list with
+	// an invalid dimension is counted by the second Collect
+	before := metric.GetStats().LinesSerialized
+	linetest.Serialize(t, metrics)
+	if got := metric.GetStats().LinesSerialized - before; got != 0 {
+		t.Errorf("serializing self-monitoring lines increased LinesSerialized by %d, want 0", got)
+	}
+	other, err := metric.NewMetric("other", metric.WithIntGaugeValue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	linetest.Serialize(t, []*metric.Metric{other})
+	dimensions.NewNormalizedDimensionList(dimensions.NewDimension("", "invalid"))
+
+	got := collect(t, c)
+	expect(t, got, map[string]string{
+		"metric_utils.sfm.lines.serialized":   "count,delta=1",
+		"metric_utils.sfm.dimensions.dropped": "count,delta=1",
+	})
+	for _, reason := range []string{"invalid_key", "missing_value", "line_too_long", "serialization_failed"} {
+		if _, ok := got["metric_utils.sfm.lines.rejected,reason="+reason]; !ok {
+			t.Errorf("missing rejected lines for reason %s", reason)
+		}
+	}
+}
+
+func TestCollector_DiskQueue(t *testing.T) {
+	q, err := exporter.NewDiskQueue(t.TempDir(), senderFunc(func(ctx context.Context, lines []string) error {
+		return errors.New("unavailable")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	_ = q.Send(context.Background(), []string{"a gauge,1"})
+	_ = q.Replay(context.Background())
+
+	got := collect(t, NewCollector(WithDiskQueue(q)))
+	expect(t, got, map[string]string{
+		"metric_utils.sfm.diskqueue.payloads.queued": "count,delta=1",
+		"metric_utils.sfm.diskqueue.payloads.sent":   "count,delta=0",
+		"metric_utils.sfm.diskqueue.retries":         "count,delta=1",
+	})
+	if got["metric_utils.sfm.diskqueue.bytes"] == "gauge,0" {
+		t.Error("diskqueue.bytes = 0, want the size of the queued payload")
+	}
+}
+
+type senderFunc func(ctx context.Context, lines []string) error
+
+func (f senderFunc) Send(ctx context.Context, lines []string) error { return f(ctx, lines) }
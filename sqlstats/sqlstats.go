@@ -0,0 +1,157 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlstats collects the connection pool statistics of database/sql handles.
+package sqlstats
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/sampling"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+const defaultPrefix = "db.pool"
+
+// NameDimension is the dimension key that holds the name under which a database handle was registered.
+const NameDimension = "db.name"
+
+// Option represents the function interface used to configure the Collector.
+type Option func(c *Collector)
+
+// WithPrefix sets the prefix of all metric keys. Defaults to "db.pool".
+func WithPrefix(prefix string) Option {
+	return func(c *Collector) {
+		c.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(c *Collector) {
+		c.defaultDimensions = dims
+	}
+}
+
+// Collector reads the sql.DBStats of registered database handles.
+// The current pool state is reported as gauges: the configured maximum (connections.max), and the open, in use and
+// idle connections (connections.open, connections.in_use, connections.idle).
+// The cumulative statistics are reported as deltas from the second collection of a handle on: the number of waits
+// for a connection and their total duration (wait.count, wait.duration.seconds), and the number of connections
+// closed because of the idle limit, the idle time and the lifetime (closed.max_idle, closed.max_idle_time,
+// closed.max_lifetime). It is safe for concurrent use.
+type Collector struct {
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+
+	mu      sync.Mutex
+	dbs     map[string]*sql.DB
+	tracker *aggregation.CumulativeTracker
+}
+
+// NewCollector creates a Collector without any registered handles.
+func NewCollector(opts ...Option) *Collector {
+	c := &Collector{
+		prefix:            defaultPrefix,
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		dbs:               map[string]*sql.DB{},
+		tracker:           aggregation.NewCumulativeTracker(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Register adds a database handle, whose statistics are reported with the name in the NameDimension.
+// Registering another handle with the same name replaces the previous one.
+func (c *Collector) Register(name string, db *sql.DB) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dbs[name] = db
+}
+
+// Unregister removes the database handle with the given name.
+func (c *Collector) Unregister(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.dbs, name)
+}
+
+// samples returns the values of stats.
+func samples(stats sql.DBStats) []sampling.Sample {
+	return []sampling.Sample{
+		{Key: "connections.max", Value: int64(stats.MaxOpenConnections)},
+		{Key: "connections.open", Value: int64(stats.OpenConnections)},
+		{Key: "connections.in_use", Value: int64(stats.InUse)},
+		{Key: "connections.idle", Value: int64(stats.Idle)},
+		{Key: "wait.count", Value: stats.WaitCount, Cumulative: true},
+		{Key: "wait.duration.seconds", Value: int64(stats.WaitDuration), Divisor: 1e9, Cumulative: true},
+		{Key: "closed.max_idle", Value: stats.MaxIdleClosed, Cumulative: true},
+		{Key: "closed.max_idle_time", Value: stats.MaxIdleTimeClosed, Cumulative: true},
+		{Key: "closed.max_lifetime", Value: stats.MaxLifetimeClosed, Cumulative: true},
+	}
+}
+
+// Collect reads the statistics of all registered handles.
+func (c *Collector) Collect() ([]*metric.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.dbs))
+	for name := range c.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := []*metric.Metric{}
+	errs := []string{}
+	for _, name := range names {
+		dims := dimensions.MergeLists(
+			c.defaultDimensions,
+			dimensions.NewNormalizedDimensionList(dimensions.NewDimension(NameDimension, name)),
+		)
+
+		for _, s := range samples(c.dbs[name].Stats()) {
+			value, ok := s.MetricValue(c.tracker, aggregation.SeriesKey(s.Key, dims))
+			if !ok {
+				continue
+			}
+
+			m, err := metric.NewMetric(s.Key, metric.WithPrefix(c.prefix), metric.WithDimensions(dims), value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("'%s' of '%s': %v", s.Key, name, err))
+				continue
+			}
+			result = append(result, m)
+		}
+	}
+	// forget the cumulative values of unregistered handles.
+	c.tracker.Sweep()
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("could not collect %d pool metrics: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return result, nil
+}
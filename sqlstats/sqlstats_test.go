@@ -0,0 +1,161 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlstats
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// fakeDriver opens connections that cannot execute anything, which is enough to exercise the pool.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("sqlstats_fake", fakeDriver{})
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlstats_fake", "")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func collectLines(t *testing.T, c *Collector) []string {
+	t.Helper()
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	return linetest.CanonicalLines(linetest.Serialize(t, metrics))
+}
+
+func TestCollector(t *testing.T) {
+	db := openDB(t)
+	db.SetMaxOpenConns(1)
+
+	c := NewCollector(WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("env", "test"))))
+	c.Register("users", db)
+
+	// cumulative statistics are only reported from the second collection on
+	want := linetest.CanonicalLines([]string{
+		"db.pool.connections.max,env=test,db.name=users gauge,1",
+		"db.pool.connections.open,env=test,db.name=users gauge,0",
+		"db.pool.connections.in_use,env=test,db.name=users gauge,0",
+		"db.pool.connections.idle,env=test,db.name=users gauge,0",
+	})
+	if got := collectLines(t, c); !reflect.DeepEqual(got, want) {
+		t.Errorf("first Collect() = %v, want %v", got, want)
+	}
+
+	// hold the only connection, so that a second caller has to wait for it
+	ctx := context.Background()
+	first, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Conn() error = %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		second, err := db.Conn(ctx)
+		if err == nil {
+			err = second.Close()
+		}
+		done <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for db.Stats().WaitCount == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	first.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("second Conn() error = %v", err)
+	}
+
+	got := collectLines(t, c)
+	// canonical lines have their dimensions sorted
+	durationPrefix := "db.pool.wait.duration.seconds,db.name=users,env=test count,delta="
+	remaining := []string{}
+	for _, line := range got {
+		if strings.HasPrefix(line, durationPrefix) {
+			if line == durationPrefix+"0" {
+				t.Errorf("wait duration = %s, want a positive delta", line)
+			}
+			continue
+		}
+		remaining = append(remaining, line)
+	}
+	want = linetest.CanonicalLines([]string{
+		"db.pool.connections.max,env=test,db.name=users gauge,1",
+		"db.pool.connections.open,env=test,db.name=users gauge,1",
+		"db.pool.connections.in_use,env=test,db.name=users gauge,0",
+		"db.pool.connections.idle,env=test,db.name=users gauge,1",
+		"db.pool.wait.count,env=test,db.name=users count,delta=1",
+		"db.pool.closed.max_idle,env=test,db.name=users count,delta=0",
+		"db.pool.closed.max_idle_time,env=test,db.name=users count,delta=0",
+		"db.pool.closed.max_lifetime,env=test,db.name=users count,delta=0",
+	})
+	if len(remaining) != len(got)-1 || !reflect.DeepEqual(remaining, want) {
+		t.Errorf("second Collect() = %v, want %v and the wait duration", got, want)
+	}
+}
+
+func TestCollector_Register(t *testing.T) {
+	c := NewCollector(WithPrefix("sql"))
+	c.Register("a", openDB(t))
+	c.Register("b", openDB(t))
+
+	if got := collectLines(t, c); len(got) != 8 {
+		t.Errorf("Collect() = %v, want 4 gauges per handle", got)
+	}
+
+	c.Unregister("a")
+	got := collectLines(t, c)
+	for _, line := range got {
+		if !strings.Contains(line, "db.name=b") || !strings.HasPrefix(line, "sql.") {
+			t.Errorf("Collect() after Unregister returned %s", line)
+		}
+	}
+	if len(got) != 9 {
+		t.Errorf("Collect() after Unregister = %v, want 9 lines of handle b", got)
+	}
+	// the cumulative values of the unregistered handle are forgotten
+	if n := c.tracker.Len(); n != 5 {
+		t.Errorf("tracked series = %d, want 5", n)
+	}
+}
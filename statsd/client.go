@@ -0,0 +1,169 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/apiconstants"
+)
+
+// defaultMaxDatagramSize keeps datagrams below an Ethernet MTU of 1500 bytes, minus the IP and UDP headers.
+const defaultMaxDatagramSize = 1432
+
+// ClientOption represents the function interface used to configure the Client.
+type ClientOption func(c *Client)
+
+// WithAddress sets the UDP address of the StatsD listener. Defaults to apiconstants.GetDefaultOneAgentStatsDAddress().
+func WithAddress(addr string) ClientOption {
+	return func(c *Client) {
+		c.addr = addr
+	}
+}
+
+// WithMaxDatagramSize sets the maximum size of a datagram in bytes. Defaults to 1432 bytes.
+func WithMaxDatagramSize(size int) ClientOption {
+	return func(c *Client) {
+		c.maxDatagramSize = size
+	}
+}
+
+// Client sends metrics to a StatsD listener, like the one of the OneAgent, over UDP.
+// Multiple lines are packed into one datagram, as long as it stays below the maximum datagram size.
+// Client implements exporter.Sender, so it can be used with an exporter.BatchExporter in place of the HTTP client.
+// It is safe for concurrent use.
+type Client struct {
+	addr            string
+	maxDatagramSize int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewClient creates a Client and connects it to the StatsD address.
+func NewClient(opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		addr:            apiconstants.GetDefaultOneAgentStatsDAddress(),
+		maxDatagramSize: defaultMaxDatagramSize,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	conn, err := net.Dial("udp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return c, nil
+}
+
+// Send converts serialized metric lines to StatsD and sends them.
+// Lines that cannot be converted or that do not fit into a datagram are skipped and reported in the returned error.
+func (c *Client) Send(ctx context.Context, lines []string) error {
+	statsdLines := make([]string, 0, len(lines))
+	errs := []string{}
+
+	for _, line := range lines {
+		encoded, err := EncodeLine(line)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		statsdLines = append(statsdLines, encoded...)
+	}
+
+	return c.send(ctx, statsdLines, errs)
+}
+
+// SendMetrics converts metrics to StatsD and sends them. See Send.
+func (c *Client) SendMetrics(ctx context.Context, metrics ...*metric.Metric) error {
+	statsdLines := make([]string, 0, len(metrics))
+	errs := []string{}
+
+	for _, m := range metrics {
+		encoded, err := Encode(m)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		statsdLines = append(statsdLines, encoded...)
+	}
+
+	return c.send(ctx, statsdLines, errs)
+}
+
+func (c *Client) send(ctx context.Context, statsdLines []string, errs []string) error {
+	datagrams, tooLarge := pack(statsdLines, c.maxDatagramSize)
+	for _, line := range tooLarge {
+		errs = append(errs, fmt.Sprintf("line exceeds maximum datagram size of %d bytes: '%s'", c.maxDatagramSize, line))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, datagram := range datagrams {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err.Error())
+			break
+		}
+		if _, err := c.conn.Write(datagram); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("could not send all metrics: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// pack joins lines with newlines into datagrams of at most maxSize bytes. Lines that are larger than maxSize on
+// their own are returned separately.
+func pack(lines []string, maxSize int) (datagrams [][]byte, tooLarge []string) {
+	var current []byte
+	for _, line := range lines {
+		if len(line) > maxSize {
+			tooLarge = append(tooLarge, line)
+			continue
+		}
+		if len(current) > 0 && len(current)+1+len(line) > maxSize {
+			datagrams = append(datagrams, current)
+			current = nil
+		}
+		if len(current) > 0 {
+			current = append(current, '\n')
+		}
+		current = append(current, line...)
+	}
+	if len(current) > 0 {
+		datagrams = append(datagrams, current)
+	}
+	return datagrams, tooLarge
+}
+
+// Close closes the connection. Metrics sent after Close return an error.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn.Close()
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+)
+
+func TestPack(t *testing.T) {
+	lines := []string{"aaaa", "bbbb", "cccc", "dddddddddddd", "ee"}
+
+	datagrams, tooLarge := pack(lines, 10)
+
+	got := []string{}
+	for _, d := range datagrams {
+		got = append(got, string(d))
+	}
+	want := []string{"aaaa\nbbbb", "cccc\nee"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pack() datagrams = %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(tooLarge, []string{"dddddddddddd"}) {
+		t.Errorf("pack() tooLarge = %q", tooLarge)
+	}
+}
+
+// listen starts a loopback listener and returns a channel that receives every datagram.
+func listen(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	datagrams := make(chan string, 100)
+	go func() {
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			datagrams <- string(buf[:n])
+		}
+	}()
+	return conn.LocalAddr().String(), datagrams
+}
+
+func receive(t *testing.T, datagrams <-chan string, n int) []string {
+	t.Helper()
+
+	result := []string{}
+	for i := 0; i < n; i++ {
+		select {
+		case d := <-datagrams:
+			result = append(result, d)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for datagram %d, got %q", i+1, result)
+		}
+	}
+	return result
+}
+
+func TestClient_Send(t *testing.T) {
+	addr, datagrams := listen(t)
+
+	c, err := NewClient(WithAddress(addr), WithMaxDatagramSize(40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Send(context.Background(), []string{
+		"requests,route=/ count,delta=5",
+		"temperature gauge,21.5",
+		"latency gauge,min=1,max=3,sum=4,count=2",
+		"invalid",
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("Send() error = %v, want error for invalid line", err)
+	}
+
+	got := receive(t, datagrams, 2)
+	want := []string{
+		"requests:5|c|#route:/\ntemperature:21.5|g",
+		"latency:1|ms\nlatency:3|ms",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("datagrams = %q, want %q", got, want)
+	}
+}
+
+func TestClient_SendMetrics(t *testing.T) {
+	addr, datagrams := listen(t)
+
+	c, err := NewClient(WithAddress(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	m, err := metric.NewMetric("requests", metric.WithIntCounterValueDelta(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendMetrics(context.Background(), m); err != nil {
+		t.Fatalf("SendMetrics() error = %v", err)
+	}
+
+	if got := receive(t, datagrams, 1); got[0] != "requests:2|c" {
+		t.Errorf("datagram = %q", got[0])
+	}
+}
+
+func TestClient_ToServer(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &fakeExporter{}
+	server := NewServer(exp, WithFlushInterval(time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.Serve(ctx, conn) }()
+
+	c, err := NewClient(WithAddress(conn.LocalAddr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	lines := []string{"requests,method=GET count,delta=5", "temperature gauge,21"}
+	if err := c.Send(context.Background(), lines); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.aggregator.Len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got := exp.take(); !reflect.DeepEqual(got, lines) {
+		t.Errorf("server exported %v, want %v", got, lines)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/serialize"
+)
+
+var tagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_")
+
+// splitUnescaped splits s at every occurrence of sep that is not escaped with a backslash.
+// At most limit parts are returned if limit is positive.
+func splitUnescaped(s string, sep byte, limit int) []string {
+	parts := []string{}
+	start := 0
+	escaped := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == sep && (limit <= 0 || len(parts) < limit-1):
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var sb strings.Builder
+	escaped := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// Encode converts a metric to the Dynatrace StatsD dialect. See EncodeLine.
+func Encode(m *metric.Metric) ([]string, error) {
+	line, err := m.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return EncodeLine(line)
+}
+
+// EncodeLine converts a serialized metric line, as created by metric.Metric.Serialize, to StatsD lines of the form
+// "<key>:<value>|<type>|#<dimension>:<value>,...":
+//
+//   - "count,delta=<value>" becomes a counter ("c")
+//   - "gauge,<value>" becomes a gauge ("g")
+//   - "gauge,min=,max=,sum=,count=" becomes up to three timer ("ms") samples: the minimum, the maximum, and the mean of
+//     the remaining observations with a sample rate of 1/(count-2). This way, the min, max, sum and count that
+//     are derived from the samples are the same as the ones of the summary.
+//
+// StatsD has no timestamps, so timestamps are dropped. Characters that separate tags (",", "|", "#") are replaced
+// with underscores in dimension values, and colons are replaced in dimension keys.
+func EncodeLine(line string) ([]string, error) {
+	parts := splitUnescaped(line, ' ', 3)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid metric line '%s'", line)
+	}
+
+	keyAndDims := splitUnescaped(parts[0], ',', -1)
+	key := keyAndDims[0]
+
+	tags := make([]string, 0, len(keyAndDims)-1)
+	for _, dim := range keyAndDims[1:] {
+		kv := splitUnescaped(dim, '=', 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid dimension '%s' in metric line '%s'", dim, line)
+		}
+		tags = append(tags, strings.ReplaceAll(kv[0], ":", "_")+":"+tagReplacer.Replace(unescape(kv[1])))
+	}
+	suffix := ""
+	if len(tags) > 0 {
+		suffix = "|#" + strings.Join(tags, ",")
+	}
+
+	valueType, value := parts[1], ""
+	if i := strings.IndexByte(parts[1], ','); i >= 0 {
+		valueType, value = parts[1][:i], parts[1][i+1:]
+	}
+
+	switch {
+	case valueType == "count" && strings.HasPrefix(value, "delta="):
+		return []string{key + ":" + strings.TrimPrefix(value, "delta=") + "|c" + suffix}, nil
+	case valueType == "gauge" && strings.HasPrefix(value, "min="):
+		return encodeSummary(key, value, suffix, line)
+	case valueType == "gauge" && value != "":
+		return []string{key + ":" + value + "|g" + suffix}, nil
+	}
+	return nil, fmt.Errorf("unsupported value '%s' in metric line '%s'", parts[1], line)
+}
+
+func encodeSummary(key, value, suffix, line string) ([]string, error) {
+	fields := map[string]float64{}
+	for _, field := range strings.Split(value, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid summary in metric line '%s'", line)
+		}
+		f, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid summary in metric line '%s'", line)
+		}
+		fields[kv[0]] = f
+	}
+
+	min, max, sum, count := fields["min"], fields["max"], fields["sum"], int64(fields["count"])
+	sample := func(v float64, rate string) string {
+		return key + ":" + serialize.SerializeFloat64(v) + "|ms" + rate + suffix
+	}
+
+	switch count {
+	case 0:
+		return []string{}, nil
+	case 1:
+		return []string{sample(min, "")}, nil
+	case 2:
+		return []string{sample(min, ""), sample(max, "")}, nil
+	}
+
+	remaining := count - 2
+	mean := (sum - min - max) / float64(remaining)
+	return []string{
+		sample(min, ""),
+		sample(max, ""),
+		sample(mean, "|@"+serialize.SerializeFloat64(1/float64(remaining))),
+	}, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestEncodeLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "counter", line: "requests count,delta=5", want: []string{"requests:5|c"}},
+		{name: "gauge", line: "temperature gauge,21.5", want: []string{"temperature:21.5|g"}},
+		{
+			name: "dimensions",
+			line: "requests,route=/home,k8s:name=pod count,delta=1",
+			want: []string{"requests:1|c|#route:/home,k8s_name:pod"},
+		},
+		{
+			name: "escaped dimension values",
+			line: `requests,dim=a\,b\ c\=d\\e count,delta=1`,
+			want: []string{`requests:1|c|#dim:a_b c=d\e`},
+		},
+		{name: "timestamp is dropped", line: "temperature gauge,21 1700000000000", want: []string{"temperature:21|g"}},
+		{name: "empty summary", line: "latency gauge,min=0,max=0,sum=0,count=0", want: []string{}},
+		{name: "summary with one value", line: "latency gauge,min=3,max=3,sum=3,count=1", want: []string{"latency:3|ms"}},
+		{
+			name: "summary with two values",
+			line: "latency gauge,min=1,max=3,sum=4,count=2",
+			want: []string{"latency:1|ms", "latency:3|ms"},
+		},
+		{
+			name: "summary",
+			line: "latency,route=/ gauge,min=1,max=4,sum=10,count=4",
+			want: []string{"latency:1|ms|#route:/", "latency:4|ms|#route:/", "latency:2.5|ms|@0.5|#route:/"},
+		},
+		{name: "missing value", line: "requests", wantErr: true},
+		{name: "unsupported value", line: "requests count,5", wantErr: true},
+		{name: "invalid summary", line: "latency gauge,min=a,max=1,sum=1,count=1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncodeLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EncodeLine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	m, err := metric.NewMetric("requests",
+		metric.WithPrefix("app"),
+		metric.WithDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("method", "GET"))),
+		metric.WithIntCounterValueDelta(3),
+		metric.WithCurrentTime(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Encode(m)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if want := []string{"app.requests:3|c|#method:GET"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Encode() = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeLine_RoundTrip(t *testing.T) {
+	encoded, err := EncodeLine("latency,route=/ gauge,min=1,max=9,sum=30,count=6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var min, max, sum, count float64
+	for i, line := range encoded {
+		s, err := ParseLine(line)
+		if err != nil {
+			t.Fatalf("ParseLine(%q) error = %v", line, err)
+		}
+		weight := 1 / s.SampleRate
+		if i == 0 || s.Value < min {
+			min = s.Value
+		}
+		if s.Value > max {
+			max = s.Value
+		}
+		sum += s.Value * weight
+		count += weight
+	}
+
+	if min != 1 || max != 9 || sum != 30 || count != 6 {
+		t.Errorf("decoded min=%v max=%v sum=%v count=%v, want min=1 max=9 sum=30 count=6", min, max, sum, count)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+// MetricType is the type of a StatsD metric, as given after the first pipe of a line.
+type MetricType string
+
+// The StatsD metric types that are supported.
+const (
+	TypeCounter      MetricType = "c"
+	TypeGauge        MetricType = "g"
+	TypeTimer        MetricType = "ms"
+	TypeHistogram    MetricType = "h"
+	TypeDistribution MetricType = "d"
+	TypeSet          MetricType = "s"
+)
+
+// Sample is a single parsed StatsD line.
+type Sample struct {
+	Name string
+	Type MetricType
+	// Value is the numeric value of the sample. It is not set for sets.
+	Value float64
+	// SetValue is the raw value of a set sample.
+	SetValue string
+	// Relative is true for gauges with a leading sign, which modify the current value instead of replacing it.
+	Relative bool
+	// SampleRate is the rate given by "|@<rate>", or 1 if no rate was given.
+	SampleRate float64
+	// Tags are the DogStatsD tags given by "|#key:value,...". Tags without a value are skipped.
+	Tags []dimensions.Dimension
+}
+
+// ParseError is returned if a line is not a valid StatsD line.
+type ParseError struct {
+	Line string
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid statsd line '%s': %s", e.Line, e.Msg)
+}
+
+// ParseLine parses a single StatsD line of the form "<name>:<value>|<type>[|@<rate>][|#<tags>]".
+// The name ends at the first colon. Lines with multiple values, like "<name>:<value>:<value>|<type>", are rejected,
+// except for sets, whose value can contain colons.
+// Unknown sections, like the DogStatsD container ID or timestamp, are ignored.
+func ParseLine(line string) (Sample, error) {
+	fail := func(msg string) (Sample, error) {
+		return Sample{}, &ParseError{Line: line, Msg: msg}
+	}
+
+	colon := strings.IndexByte(strings.SplitN(line, "|", 2)[0], ':')
+	if colon <= 0 {
+		return fail("missing name or value")
+	}
+
+	sections := strings.Split(line[colon+1:], "|")
+	if len(sections) < 2 {
+		return fail("missing type")
+	}
+
+	s := Sample{
+		Name:       line[:colon],
+		Type:       MetricType(sections[1]),
+		SampleRate: 1,
+	}
+	rawValue := sections[0]
+
+	switch s.Type {
+	case TypeSet:
+		if rawValue == "" {
+			return fail("empty set value")
+		}
+		s.SetValue = rawValue
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistribution:
+		if strings.IndexByte(rawValue, ':') >= 0 {
+			return fail("multiple values are not supported")
+		}
+		value, err := strconv.ParseFloat(rawValue, 64)
+		if err != nil {
+			return fail(fmt.Sprintf("invalid value '%s'", rawValue))
+		}
+		s.Value = value
+		s.Relative = s.Type == TypeGauge && (rawValue[0] == '+' || rawValue[0] == '-')
+	default:
+		return fail(fmt.Sprintf("unsupported type '%s'", s.Type))
+	}
+
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return fail(fmt.Sprintf("invalid sample rate '%s'", section[1:]))
+			}
+			s.SampleRate = rate
+		case strings.HasPrefix(section, "#"):
+			s.Tags = parseTags(section[1:])
+		}
+	}
+
+	return s, nil
+}
+
+func parseTags(s string) []dimensions.Dimension {
+	tags := []dimensions.Dimension{}
+	for _, tag := range strings.Split(s, ",") {
+		parts := strings.SplitN(tag, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		tags = append(tags, dimensions.NewDimension(parts[0], parts[1]))
+	}
+	return tags
+}
+
+// ParsePacket parses all newline-separated lines of a packet. DogStatsD events ("_e{") and service checks ("_sc|")
+// are skipped. If some lines are invalid, all other samples are returned together with an error.
+func ParsePacket(packet []byte) ([]Sample, error) {
+	samples := []Sample{}
+	errs := []string{}
+
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+			continue
+		}
+
+		s, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		samples = append(samples, s)
+	}
+
+	if len(errs) > 0 {
+		return samples, fmt.Errorf("could not parse %d line(s): %s", len(errs), strings.Join(errs, "; "))
+	}
+	return samples, nil
+}
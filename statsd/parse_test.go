@@ -0,0 +1,127 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{
+			name: "counter",
+			line: "page.views:1|c",
+			want: Sample{Name: "page.views", Type: TypeCounter, Value: 1, SampleRate: 1},
+		},
+		{
+			name: "counter with sample rate and tags",
+			line: "page.views:2|c|@0.5|#env:prod,region:eu-west-1",
+			want: Sample{Name: "page.views", Type: TypeCounter, Value: 2, SampleRate: 0.5, Tags: []dimensions.Dimension{
+				dimensions.NewDimension("env", "prod"),
+				dimensions.NewDimension("region", "eu-west-1"),
+			}},
+		},
+		{
+			name: "tags without value and colons in values",
+			line: "a:1|c|#novalue,url:http://host",
+			want: Sample{Name: "a", Type: TypeCounter, Value: 1, SampleRate: 1, Tags: []dimensions.Dimension{
+				dimensions.NewDimension("url", "http://host"),
+			}},
+		},
+		{
+			name: "gauge",
+			line: "temperature:21.5|g",
+			want: Sample{Name: "temperature", Type: TypeGauge, Value: 21.5, SampleRate: 1},
+		},
+		{
+			name: "relative gauge",
+			line: "queue:-3|g",
+			want: Sample{Name: "queue", Type: TypeGauge, Value: -3, Relative: true, SampleRate: 1},
+		},
+		{
+			name: "timer",
+			line: "request.time:320|ms",
+			want: Sample{Name: "request.time", Type: TypeTimer, Value: 320, SampleRate: 1},
+		},
+		{
+			name: "histogram",
+			line: "size:12|h",
+			want: Sample{Name: "size", Type: TypeHistogram, Value: 12, SampleRate: 1},
+		},
+		{
+			name: "set",
+			line: "users:alice|s",
+			want: Sample{Name: "users", Type: TypeSet, SetValue: "alice", SampleRate: 1},
+		},
+		{
+			name: "set value with colons",
+			line: "users:alice:admin|s",
+			want: Sample{Name: "users", Type: TypeSet, SetValue: "alice:admin", SampleRate: 1},
+		},
+		{
+			name: "unknown sections are ignored",
+			line: "a:1|c|c:83c0a99c0a54c0c187f461c7980e9b57f3f6a8b0c918c8d93df19a9de6f3fe1d|T1656581400",
+			want: Sample{Name: "a", Type: TypeCounter, Value: 1, SampleRate: 1},
+		},
+		{name: "missing value", line: "a|c", wantErr: true},
+		{name: "missing name", line: ":1|c", wantErr: true},
+		{name: "missing type", line: "a:1", wantErr: true},
+		{name: "invalid value", line: "a:x|c", wantErr: true},
+		{name: "unsupported type", line: "a:1|x", wantErr: true},
+		{name: "invalid sample rate", line: "a:1|c|@2", wantErr: true},
+		{name: "empty set value", line: "a:|s", wantErr: true},
+		{name: "multiple values", line: "a:1:2|c", wantErr: true},
+		{name: "colon in name", line: "a:b:1|c", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	packet := []byte("a:1|c\n\n_e{5,4}:title|text\n_sc|check|0\ninvalid\nb:2|g\n")
+
+	samples, err := ParsePacket(packet)
+	if err == nil {
+		t.Error("ParsePacket() expected error for invalid line")
+	}
+
+	want := []Sample{
+		{Name: "a", Type: TypeCounter, Value: 1, SampleRate: 1},
+		{Name: "b", Type: TypeGauge, Value: 2, SampleRate: 1},
+	}
+	if !reflect.DeepEqual(samples, want) {
+		t.Errorf("ParsePacket() = %+v, want %+v", samples, want)
+	}
+}
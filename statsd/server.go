@@ -0,0 +1,275 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statsd receives StatsD metrics over UDP, aggregates them, and exports them as Dynatrace metric lines.
+// It also contains a client that sends metrics to a StatsD listener, like the one of the OneAgent.
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/aggregation"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/exporter"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/logging"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Second
+	maxPacketSize        = 65535
+)
+
+// Option represents the function interface used to configure the Server.
+type Option func(s *Server)
+
+// WithFlushInterval sets the interval in which the aggregated metrics are exported. Defaults to ten seconds.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.flushInterval = interval
+	}
+}
+
+// WithPrefix sets a prefix that is prepended to all metric keys.
+func WithPrefix(prefix string) Option {
+	return func(s *Server) {
+		s.prefix = prefix
+	}
+}
+
+// WithDefaultDimensions sets dimensions that are added to all metrics. Tags overwrite default dimensions with the same key.
+func WithDefaultDimensions(dims dimensions.NormalizedDimensionList) Option {
+	return func(s *Server) {
+		s.defaultDimensions = dims
+	}
+}
+
+// WithErrorHandler sets a function that is called with errors that occur while receiving and flushing in Serve.
+// By default, errors are logged.
+func WithErrorHandler(handler func(error)) Option {
+	return func(s *Server) {
+		s.errorHandler = handler
+	}
+}
+
+type set struct {
+	name    string
+	dims    dimensions.NormalizedDimensionList
+	members map[string]struct{}
+}
+
+// Server aggregates StatsD samples and exports them once per flush interval:
+//
+//   - counters ("c") are divided by their sample rate and exported as "count,delta=<sum>"
+//   - gauges ("g") are exported as "gauge,<value>" with every flush until the Server is stopped; values with a
+//     leading sign modify the current value
+//   - timers ("ms"), histograms ("h") and distributions ("d") are exported as "gauge,min=,max=,sum=,count=", where
+//     a sampled value counts as 1/rate observations
+//   - sets ("s") are exported as "gauge,<number of unique values>"
+//
+// It is safe for concurrent use.
+type Server struct {
+	exporter          exporter.LineExporter
+	flushInterval     time.Duration
+	prefix            string
+	defaultDimensions dimensions.NormalizedDimensionList
+	errorHandler      func(error)
+
+	aggregator *aggregation.Aggregator
+
+	setsMu sync.Mutex
+	sets   map[string]*set
+}
+
+// NewServer creates a Server that exports to exporter.
+func NewServer(exp exporter.LineExporter, opts ...Option) *Server {
+	s := &Server{
+		exporter:          exp,
+		flushInterval:     defaultFlushInterval,
+		defaultDimensions: dimensions.NewNormalizedDimensionList(),
+		errorHandler: func(err error) {
+			logging.GetLogger().Errorf("StatsD error: %v", err)
+		},
+		sets: map[string]*set{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.flushInterval <= 0 {
+		s.flushInterval = defaultFlushInterval
+	}
+
+	s.aggregator = aggregation.NewAggregator(
+		aggregation.WithAggregatorPrefix(s.prefix),
+		aggregation.WithAggregatorDefaultDimensions(s.defaultDimensions),
+	)
+	return s
+}
+
+// Handle parses a packet and aggregates its samples. Invalid lines are reported in the returned error,
+// all valid lines of the packet are aggregated.
+func (s *Server) Handle(packet []byte) error {
+	samples, err := ParsePacket(packet)
+	for _, sample := range samples {
+		s.add(sample)
+	}
+	return err
+}
+
+func (s *Server) add(sample Sample) {
+	dims := dimensions.NewNormalizedDimensionList(sample.Tags...)
+
+	switch sample.Type {
+	case TypeCounter:
+		s.aggregator.AddCount(sample.Name, dims, sample.Value/sample.SampleRate)
+	case TypeGauge:
+		if sample.Relative {
+			s.aggregator.AdjustGauge(sample.Name, dims, sample.Value)
+		} else {
+			s.aggregator.SetGauge(sample.Name, dims, sample.Value)
+		}
+	case TypeTimer, TypeHistogram, TypeDistribution:
+		s.aggregator.RecordWeightedSummary(sample.Name, dims, sample.Value, 1/sample.SampleRate)
+	case TypeSet:
+		s.addSetMember(sample.Name, dims, sample.SetValue)
+	}
+}
+
+func (s *Server) addSetMember(name string, dims dimensions.NormalizedDimensionList, member string) {
+	s.setsMu.Lock()
+	defer s.setsMu.Unlock()
+
+	key := aggregation.SeriesKey(name, dims)
+	st, ok := s.sets[key]
+	if !ok {
+		st = &set{name: name, dims: dims, members: map[string]struct{}{}}
+		s.sets[key] = st
+	}
+	st.members[member] = struct{}{}
+}
+
+// collectSets returns a gauge with the number of unique members per set and resets all sets.
+func (s *Server) collectSets() ([]*metric.Metric, []string) {
+	s.setsMu.Lock()
+	sets := s.sets
+	s.sets = map[string]*set{}
+	s.setsMu.Unlock()
+
+	result := make([]*metric.Metric, 0, len(sets))
+	errs := []string{}
+	for _, st := range sets {
+		m, err := metric.NewMetric(
+			st.name,
+			metric.WithPrefix(s.prefix),
+			metric.WithDimensions(dimensions.MergeLists(s.defaultDimensions, st.dims)),
+			metric.WithIntGaugeValue(int64(len(st.members))),
+		)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("'%s': %v", st.name, err))
+			continue
+		}
+		result = append(result, m)
+	}
+	return result, errs
+}
+
+// Flush exports all aggregated metrics and resets the counters, timers and sets.
+// Metrics that cannot be serialized are skipped and reported in the returned error.
+func (s *Server) Flush(ctx context.Context) error {
+	errs := []string{}
+
+	metrics, err := s.aggregator.Collect()
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	setMetrics, setErrs := s.collectSets()
+	metrics = append(metrics, setMetrics...)
+	errs = append(errs, setErrs...)
+
+	if err := exporter.ExportMetrics(ctx, s.exporter, metrics...); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("flush failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *Server) handleError(err error) {
+	if err != nil && s.errorHandler != nil {
+		s.errorHandler(err)
+	}
+}
+
+// Serve reads packets from conn and flushes once per flush interval until ctx is done. conn is closed when ctx is
+// done, and the remaining metrics are flushed before Serve returns. Returns the context error, or the error that
+// stopped reading from conn.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	readErr := make(chan error, 1)
+	go func() {
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if n > 0 {
+				s.handleError(s.Handle(buf[:n]))
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	var result error
+	for result == nil {
+		select {
+		case <-ctx.Done():
+			result = ctx.Err()
+			conn.Close()
+			// wait for the reader to stop, so that no packet that was already read is lost.
+			<-readErr
+		case err := <-readErr:
+			result = err
+			conn.Close()
+		case <-ticker.C:
+			s.handleError(s.Flush(ctx))
+		}
+	}
+
+	// the context might be done already, so the last flush gets its own deadline.
+	flushCtx, cancel := context.WithTimeout(context.Background(), s.flushInterval)
+	defer cancel()
+	s.handleError(s.Flush(flushCtx))
+
+	return result
+}
+
+// ListenAndServe listens on the UDP address addr, e.g. ":8125", and calls Serve.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, conn)
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Dynatrace LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/internal/linetest"
+	"github.com/dynatrace-oss/dynatrace-metric-utils-go/metric/dimensions"
+)
+
+type fakeExporter struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (e *fakeExporter) Export(ctx context.Context, lines ...string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lines = append(e.lines, lines...)
+	return nil
+}
+
+func (e *fakeExporter) take() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	lines := linetest.CanonicalLines(e.lines)
+	e.lines = nil
+	return lines
+}
+
+func TestServer_Flush(t *testing.T) {
+	exp := &fakeExporter{}
+	s := NewServer(exp,
+		WithPrefix("statsd"),
+		WithDefaultDimensions(dimensions.NewNormalizedDimensionList(dimensions.NewDimension("env", "test"))),
+	)
+
+	packets := []string{
+		"requests:1|c|#route:/home\nrequests:1|c|@0.5|#route:/home",
+		"requests:3|c|#route:/login",
+		"latency:10|ms\nlatency:30|ms\nlatency:20|h",
+		"connections:10|g\nconnections:-3|g",
+		"users:alice|s\nusers:bob|s\nusers:alice|s",
+		// tags overwrite default dimensions
+		"overwritten:1|g|#env:prod",
+	}
+	for _, p := range packets {
+		if err := s.Handle([]byte(p)); err != nil {
+			t.Fatalf("Handle(%q) error = %v", p, err)
+		}
+	}
+
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	want := linetest.CanonicalLines([]string{
+		"statsd.requests,env=test,route=/home count,delta=3",
+		"statsd.requests,env=test,route=/login count,delta=3",
+		"statsd.latency,env=test gauge,min=10,max=30,sum=60,count=3",
+		"statsd.connections,env=test gauge,7",
+		"statsd.users,env=test gauge,2",
+		"statsd.overwritten,env=prod gauge,1",
+	})
+	if got := exp.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("first flush = %v, want %v", got, want)
+	}
+
+	// only gauges are repeated
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	want = linetest.CanonicalLines([]string{
+		"statsd.connections,env=test gauge,7",
+		"statsd.overwritten,env=prod gauge,1",
+	})
+	if got := exp.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("second flush = %v, want %v", got, want)
+	}
+}
+
+func TestServer_SampledSummaries(t *testing.T) {
+	exp := &fakeExporter{}
+	s := NewServer(exp)
+
+	// each sampled observation stands for 1/rate observations
+	if err := s.Handle([]byte("latency:10|ms|@0.1\nlatency:30|h|@0.5\nlatency:20|d")); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	want := []string{"latency gauge,min=10,max=30,sum=180,count=13"}
+	if got := exp.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Flush() = %v, want %v", got, want)
+	}
+}
+
+func TestServer_HandleInvalid(t *testing.T) {
+	exp := &fakeExporter{}
+	s := NewServer(exp)
+
+	if err := s.Handle([]byte("valid:1|c\ninvalid")); err == nil {
+		t.Error("Handle() expected error for invalid line")
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := exp.take(); !reflect.DeepEqual(got, []string{"valid count,delta=1"}) {
+		t.Errorf("Flush() = %v", got)
+	}
+}
+
+func TestServer_Serve(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &fakeExporter{}
+	s := NewServer(exp, WithFlushInterval(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Serve(ctx, conn) }()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("hits:1|c|#code:200\nhits:2|c|#code:200")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the packet is aggregated asynchronously, so wait until the aggregator holds it.
+	deadline := time.Now().Add(5 * time.Second)
+	for s.aggregator.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Serve() error = %v, want %v", err, context.Canceled)
+	}
+
+	// Serve flushes before returning.
+	if got := exp.take(); !reflect.DeepEqual(got, []string{"hits,code=200 count,delta=3"}) {
+		t.Errorf("exported = %v", got)
+	}
+}
+
+func TestServer_ServePeriodicFlush(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &fakeExporter{}
+	s := NewServer(exp, WithFlushInterval(5*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("temperature:21|g")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := exp.take(); len(got) > 0 {
+			if got[0] != "temperature gauge,21" {
+				t.Errorf("exported = %v", got)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("timed out waiting for periodic flush")
+}